@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"goproject/internal/auth"
+)
+
+// adminRoutes manage accounts. Every route requires the admin role.
+func adminRoutes() []route {
+	admin := func(h http.HandlerFunc) http.HandlerFunc { return withRole(auth.RoleAdmin, h) }
+	return []route{
+		{http.MethodGet, "/admin/users", admin(handleAdminListUsers)},
+		{http.MethodGet, "/admin/users/{id}", admin(handleAdminGetUser)},
+		{http.MethodPost, "/admin/users/{id}/disable", admin(handleAdminDisableUser)},
+		{http.MethodPost, "/admin/users/{id}/enable", admin(handleAdminEnableUser)},
+		{http.MethodPost, "/admin/users/{id}/reset-password", admin(handleAdminResetPassword)},
+		{http.MethodDelete, "/admin/users/{id}", admin(handleAdminDeleteUser)},
+	}
+}
+
+var adminDocs = map[string]operation{
+	"GET /admin/users": {
+		id: "adminListUsers", tag: "admin", summary: "List every account, oldest first, with its note count", auth: true,
+		responses: map[int]any{200: adminUserListV1{}, 403: problem{}},
+	},
+	"GET /admin/users/{id}": {
+		id: "adminGetUser", tag: "admin", summary: "Get an account", auth: true,
+		responses: map[int]any{200: adminUserV1{}, 403: problem{}, 404: problem{}},
+	},
+	"POST /admin/users/{id}/disable": {
+		id: "adminDisableUser", tag: "admin", summary: "Disable an account: its tokens stop working and it cannot log in", auth: true,
+		responses: map[int]any{200: adminUserV1{}, 403: problem{}, 404: problem{}, 409: problem{}},
+	},
+	"POST /admin/users/{id}/enable": {
+		id: "adminEnableUser", tag: "admin", summary: "Re-enable a disabled account", auth: true,
+		responses: map[int]any{200: adminUserV1{}, 403: problem{}, 404: problem{}},
+	},
+	"POST /admin/users/{id}/reset-password": {
+		id: "adminResetPassword", tag: "admin", auth: true,
+		summary: "Replace an account's password with a temporary one and revoke its tokens. " +
+			"The response holds the temporary password, which is not shown again.",
+		responses: map[int]any{200: passwordResetV1{}, 403: problem{}, 404: problem{}},
+	},
+	"DELETE /admin/users/{id}": {
+		id: "adminDeleteUser", tag: "admin", summary: "Delete an account with its notes, webhooks and API keys", auth: true,
+		responses: map[int]any{200: messageV1{}, 403: problem{}, 404: problem{}, 409: problem{}},
+	},
+}
+
+// bootstrapAdmin creates the admin account named in the config, if any.
+func bootstrapAdmin(c authConfig) error {
+	if c.AdminUsername == "" {
+		return nil
+	}
+	user, err := users.Register(context.Background(), c.AdminUsername, c.AdminPassword)
+	if err != nil {
+		return fmt.Errorf("bootstrap admin %q: %w", c.AdminUsername, err)
+	}
+	if _, err := users.SetRole(context.Background(), user.ID, auth.RoleAdmin); err != nil {
+		return fmt.Errorf("bootstrap admin %q: %w", c.AdminUsername, err)
+	}
+	logger.Info("bootstrapped admin account", "username", c.AdminUsername)
+	return nil
+}
+
+// ─── wire types ───────────────────────────────────────────────────────────────
+
+type adminUserV1 struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Role      auth.Role `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	Notes     int       `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAdminUserV1(u auth.User, noteCount int) adminUserV1 {
+	return adminUserV1{
+		ID:        u.ID,
+		Username:  u.Username,
+		Role:      u.Role,
+		Disabled:  u.Disabled,
+		Notes:     noteCount,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+type adminUserListV1 struct {
+	Users []adminUserV1 `json:"users"`
+	Count int           `json:"count"`
+}
+
+type passwordResetV1 struct {
+	User              adminUserV1 `json:"user"`
+	TemporaryPassword string      `json:"temporary_password"`
+}
+
+// ─── handlers ─────────────────────────────────────────────────────────────────
+
+// adminAudit logs an action taken by the admin making the request.
+func adminAudit(r *http.Request, action, userID string) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	loggerFrom(r.Context()).Info("admin action", "action", action, "admin", claims.Username, "user_id", userID)
+}
+
+// adminUser writes the account after a successful change, or the error.
+func adminUser(w http.ResponseWriter, u auth.User, err error) {
+	if err == auth.ErrUserNotFound {
+		errJSON(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		errJSON(w, http.StatusInternalServerError, "could not update user")
+		return
+	}
+	writeJSON(w, http.StatusOK, newAdminUserV1(u, store.CountByUser()[u.ID]))
+}
+
+// notSelf rejects actions that would lock the calling admin out.
+func notSelf(w http.ResponseWriter, r *http.Request, verb string) bool {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	if claims.UserID == r.PathValue("id") {
+		errJSON(w, http.StatusConflict, "you cannot "+verb+" your own account")
+		return false
+	}
+	return true
+}
+
+func handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	list := users.List(r.Context())
+	counts := store.CountByUser()
+	out := adminUserListV1{Users: make([]adminUserV1, len(list)), Count: len(list)}
+	for i, u := range list {
+		out.Users[i] = newAdminUserV1(u, counts[u.ID])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func handleAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	u, err := users.Get(r.Context(), r.PathValue("id"))
+	adminUser(w, u, err)
+}
+
+func handleAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	if !notSelf(w, r, "disable") {
+		return
+	}
+	u, err := users.SetDisabled(r.Context(), r.PathValue("id"), true)
+	if err == nil {
+		adminAudit(r, "disable", u.ID)
+	}
+	adminUser(w, u, err)
+}
+
+func handleAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	u, err := users.SetDisabled(r.Context(), r.PathValue("id"), false)
+	if err == nil {
+		adminAudit(r, "enable", u.ID)
+	}
+	adminUser(w, u, err)
+}
+
+func handleAdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 12)
+	rand.Read(b)
+	password := base64.RawURLEncoding.EncodeToString(b)
+
+	u, err := users.SetPassword(r.Context(), r.PathValue("id"), password)
+	if err == auth.ErrUserNotFound {
+		errJSON(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		errJSON(w, http.StatusInternalServerError, "could not reset password")
+		return
+	}
+	adminAudit(r, "reset_password", u.ID)
+	writeJSON(w, http.StatusOK, passwordResetV1{
+		User:              newAdminUserV1(u, store.CountByUser()[u.ID]),
+		TemporaryPassword: password,
+	})
+}
+
+// deleteAccount removes the account first, so its tokens and API keys stop
+// working, then its webhooks, so that deleting its notes sends no
+// deliveries, then its notes. It returns how many notes went.
+func deleteAccount(ctx context.Context, id string) (int, error) {
+	if err := users.Delete(ctx, id); err != nil {
+		return 0, err
+	}
+	apiKeys.DeleteUser(ctx, id)
+	for _, h := range webhooks.List(ctx, id) {
+		webhooks.Delete(ctx, id, h.ID)
+	}
+	n := store.DeleteUser(ctx, id)
+	bus.Remove(id) // after the deletions above were published
+	return n, nil
+}
+
+func handleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	if !notSelf(w, r, "delete") {
+		return
+	}
+	id := r.PathValue("id")
+	n, err := deleteAccount(r.Context(), id)
+	if err == auth.ErrUserNotFound {
+		errJSON(w, http.StatusNotFound, "user not found")
+		return
+	}
+	adminAudit(r, "delete", id)
+	writeJSON(w, http.StatusOK, messageV1{Message: fmt.Sprintf("deleted user and %d notes", n)})
+}
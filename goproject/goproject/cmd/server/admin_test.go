@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"goproject/internal/auth"
+)
+
+func TestAdminManagesUsers(t *testing.T) {
+	srv := newTestServer(t)
+	if err := bootstrapAdmin(authConfig{AdminUsername: "root-admin", AdminPassword: "secret123"}); err != nil {
+		t.Fatal(err)
+	}
+	login := call(t, srv, "", "POST", "/v1/auth/login", `{"username":"root-admin","password":"secret123"}`)
+	if login["user"].(map[string]any)["role"] != "admin" {
+		t.Fatalf("bootstrap login = %v", login)
+	}
+	admin := login["token"].(string)
+
+	token := registerToken(t, srv, "managed")
+	note := call(t, srv, token, "POST", "/v1/notes", `{"title":"mine"}`)
+	call(t, srv, token, "POST", "/v1/webhooks", `{"url":"https://example.com/hook","events":["note.deleted"]}`)
+	me := call(t, srv, token, "GET", "/v1/notes/"+note["id"].(string), "")
+	id := me["user_id"].(string)
+
+	if got := call(t, srv, token, "GET", "/v1/admin/users", ""); got["status"] != 403.0 {
+		t.Errorf("non-admin list = %v", got)
+	}
+	list := call(t, srv, admin, "GET", "/v1/admin/users", "")
+	var found map[string]any
+	for _, u := range list["users"].([]any) {
+		if u := u.(map[string]any); u["id"] == id {
+			found = u
+		}
+	}
+	if found == nil || found["notes"] != 1.0 || found["role"] != "user" || found["disabled"] != false {
+		t.Errorf("listed user = %v", found)
+	}
+
+	// Disabling revokes tokens and blocks login until re-enabled.
+	call(t, srv, admin, "POST", "/v1/admin/users/"+id+"/disable", "")
+	if got := call(t, srv, token, "GET", "/v1/notes", ""); got["status"] != 401.0 {
+		t.Errorf("disabled user's token = %v", got)
+	}
+	if got := call(t, srv, "", "POST", "/v1/auth/login", `{"username":"managed","password":"secret123"}`); got["status"] != 403.0 {
+		t.Errorf("disabled login = %v", got)
+	}
+	call(t, srv, admin, "POST", "/v1/admin/users/"+id+"/enable", "")
+	token = call(t, srv, "", "POST", "/v1/auth/login", `{"username":"managed","password":"secret123"}`)["token"].(string)
+
+	// A reset invalidates the old password and tokens.
+	reset := call(t, srv, admin, "POST", "/v1/admin/users/"+id+"/reset-password", "")
+	temp, _ := reset["temporary_password"].(string)
+	if temp == "" {
+		t.Fatalf("reset = %v", reset)
+	}
+	if got := call(t, srv, token, "GET", "/v1/notes", ""); got["status"] != 401.0 {
+		t.Errorf("token after reset = %v", got)
+	}
+	if got := call(t, srv, "", "POST", "/v1/auth/login", `{"username":"managed","password":"`+temp+`"}`); got["token"] == nil {
+		t.Errorf("login with temporary password = %v", got)
+	}
+
+	if got := call(t, srv, admin, "DELETE", "/v1/admin/users/"+login["user"].(map[string]any)["id"].(string), ""); got["status"] != 409.0 {
+		t.Errorf("deleting yourself = %v", got)
+	}
+	if got := call(t, srv, admin, "DELETE", "/v1/admin/users/"+id, ""); got["message"] != "deleted user and 1 notes" {
+		t.Errorf("delete = %v", got)
+	}
+	if n := len(store.List(context.Background(), id)); n != 0 {
+		t.Errorf("%d notes survived their owner", n)
+	}
+	if n := len(webhooks.List(context.Background(), id)); n != 0 {
+		t.Errorf("%d webhooks survived their owner", n)
+	}
+	if _, err := users.Get(context.Background(), id); err != auth.ErrUserNotFound {
+		t.Errorf("Get after delete: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/validation"
+)
+
+// apiKeys holds the personal API keys accepted by withScope.
+var apiKeys = tracedAPIKeys{auth.NewAPIKeyStore()}
+
+// ─── wire types ───────────────────────────────────────────────────────────────
+
+type apiKeyInputV1 struct {
+	Name      string       `json:"name"`
+	Scopes    []auth.Scope `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"` // absent for no expiry
+}
+
+type apiKeyV1 struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Scopes     []auth.Scope `json:"scopes"`
+	Key        string       `json:"key,omitempty"` // only when created
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+}
+
+func newAPIKeyV1(k auth.APIKey) apiKeyV1 {
+	out := apiKeyV1{ID: k.ID, Name: k.Name, Scopes: k.Scopes, CreatedAt: k.CreatedAt}
+	if !k.ExpiresAt.IsZero() {
+		out.ExpiresAt = &k.ExpiresAt
+	}
+	if !k.LastUsedAt.IsZero() {
+		out.LastUsedAt = &k.LastUsedAt
+	}
+	return out
+}
+
+type apiKeyListV1 struct {
+	Keys []apiKeyV1 `json:"keys"`
+}
+
+// ─── handlers ─────────────────────────────────────────────────────────────────
+
+// errAPIKey maps API key errors to responses.
+func errAPIKey(w http.ResponseWriter, err error) {
+	field := func(name string) {
+		errInput(w, validation.Field(name, err.Error()))
+	}
+	switch {
+	case err == auth.ErrKeyName:
+		field("name")
+	case err == auth.ErrNoScopes, errors.Is(err, auth.ErrScope):
+		field("scopes")
+	case err == auth.ErrKeyExpiry:
+		field("expires_at")
+	case err == auth.ErrKeyNotFound:
+		errJSON(w, http.StatusNotFound, "API key not found")
+	case err == auth.ErrKeyLimit:
+		errJSON(w, http.StatusConflict, "API key limit reached")
+	default:
+		errJSON(w, http.StatusInternalServerError, "could not create API key")
+	}
+}
+
+func handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	list := apiKeys.List(r.Context(), claims.UserID)
+	out := apiKeyListV1{Keys: make([]apiKeyV1, len(list))}
+	for i, k := range list {
+		out.Keys[i] = newAPIKeyV1(k)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCreateAPIKey makes a key. The response is the only one that
+// includes the key itself.
+func handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var input apiKeyInputV1
+	if err := readJSON(w, r, &input); err != nil {
+		errInput(w, err)
+		return
+	}
+	var expires time.Time
+	if input.ExpiresAt != nil {
+		expires = *input.ExpiresAt
+	}
+	k, secret, err := apiKeys.Create(r.Context(), claims.UserID, input.Name, input.Scopes, expires)
+	if err != nil {
+		errAPIKey(w, err)
+		return
+	}
+	out := newAPIKeyV1(k)
+	out.Key = secret
+	writeJSON(w, http.StatusCreated, out)
+}
+
+func handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	if err := apiKeys.Delete(r.Context(), claims.UserID, r.PathValue("id")); err != nil {
+		errAPIKey(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, messageV1{Message: "revoked"})
+}
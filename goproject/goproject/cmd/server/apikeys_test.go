@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestAPIKeysAreScoped(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "scripter")
+	call(t, srv, token, "POST", "/v1/notes", `{"title":"existing"}`)
+
+	created := call(t, srv, token, "POST", "/v1/api-keys", `{"name":"backup","scopes":["notes:read"]}`)
+	key, _ := created["key"].(string)
+	if key == "" {
+		t.Fatalf("create = %v", created)
+	}
+	if list := call(t, srv, token, "GET", "/v1/api-keys", ""); len(list["keys"].([]any)) != 1 || list["keys"].([]any)[0].(map[string]any)["key"] != nil {
+		t.Errorf("list = %v", list)
+	}
+
+	if got := call(t, srv, key, "GET", "/v1/notes", ""); got["count"] != 1.0 {
+		t.Errorf("list with key = %v", got)
+	}
+	if got := call(t, srv, key, "POST", "/v1/notes", `{"title":"nope"}`); got["status"] != 403.0 {
+		t.Errorf("write with read-only key = %v", got)
+	}
+	if got := call(t, srv, key, "GET", "/v1/api-keys", ""); got["status"] != 403.0 {
+		t.Errorf("key managing keys = %v", got)
+	}
+	if got := call(t, srv, key, "GET", "/v1/webhooks", ""); got["status"] != 403.0 {
+		t.Errorf("key outside its scopes = %v", got)
+	}
+	if used := call(t, srv, token, "GET", "/v1/api-keys", "")["keys"].([]any)[0].(map[string]any); used["last_used_at"] == nil {
+		t.Errorf("last_used_at not recorded: %v", used)
+	}
+
+	call(t, srv, token, "DELETE", "/v1/api-keys/"+created["id"].(string), "")
+	if got := call(t, srv, key, "GET", "/v1/notes", ""); got["status"] != 401.0 {
+		t.Errorf("revoked key = %v", got)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is the complete server configuration. Values are layered, each
+// overriding the previous: defaults, the JSON file named by -config (or
+// NOTES_CONFIG), NOTES_* environment variables, then command-line flags.
+//
+// Every leaf field is addressable by its JSON path. auth.token_ttl, for
+// example, is set by NOTES_AUTH_TOKEN_TTL or -auth-token-ttl. Fields tagged
+// secret are redacted by -print-config.
+type config struct {
+	Addr      string          `json:"addr"`
+	LogLevel  string          `json:"log_level"`
+	TLS       tlsConfig       `json:"tls"`
+	Auth      authConfig      `json:"auth"`
+	Storage   storageConfig   `json:"storage"`
+	CORS      corsConfig      `json:"cors"`
+	RateLimit rateLimitConfig `json:"rate_limit"`
+	HTTP      httpConfig      `json:"http"`
+	Tracing   tracingConfig   `json:"tracing"`
+	Events    eventsConfig    `json:"events"`
+	Webhooks  webhooksConfig  `json:"webhooks"`
+	GraphQL   graphqlConfig   `json:"graphql"`
+	GRPC      grpcConfig      `json:"grpc"`
+	OIDC      oidcConfig      `json:"oidc"`
+}
+
+type authConfig struct {
+	TokenSecret string   `json:"token_secret" secret:"true"`
+	TokenTTL    duration `json:"token_ttl"`
+	// AdminUsername and AdminPassword, if set, create an admin account at
+	// startup.
+	AdminUsername string `json:"admin_username"`
+	AdminPassword string `json:"admin_password" secret:"true"`
+}
+
+type storageConfig struct {
+	Backend string `json:"backend"`
+}
+
+type corsConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           duration `json:"max_age"`
+}
+
+func defaultConfig() config {
+	return config{
+		Addr:     ":8080",
+		LogLevel: "info",
+		Auth: authConfig{
+			TokenTTL: duration{24 * time.Hour},
+		},
+		Storage: storageConfig{Backend: "memory"},
+		CORS: corsConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", requestIDHeader},
+			MaxAge:         duration{10 * time.Minute},
+		},
+		RateLimit: defaultRateLimitConfig(),
+		HTTP:      defaultHTTPConfig(),
+		Tracing:   defaultTracingConfig(),
+		Events:    defaultEventsConfig(),
+		Webhooks:  defaultWebhooksConfig(),
+		GraphQL:   defaultGraphQLConfig(),
+		OIDC:      defaultOIDCConfig(),
+	}
+}
+
+// duration is a time.Duration written as a string such as "15s" in config
+// files, environment variables and flags.
+type duration struct {
+	time.Duration
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15s\": %w", err)
+	}
+	return d.Set(s)
+}
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// ─── loading ──────────────────────────────────────────────────────────────────
+
+// loadConfig builds the effective configuration from args and the
+// environment. It also reports whether -print-config was given.
+func loadConfig(args []string, getenv func(string) string) (config, bool, error) {
+	cfg := defaultConfig()
+	fields := leaves(reflect.ValueOf(&cfg).Elem(), nil)
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", getenv("NOTES_CONFIG"), "Path to a JSON config file")
+	port := fs.String("port", "", "Port to listen on (shorthand for -addr :PORT)")
+	devTLS := fs.Bool("dev-tls", false, "Serve HTTPS with an in-memory self-signed certificate (shorthand for -tls-dev)")
+	printConfig := fs.Bool("print-config", false, "Print the effective config with secrets redacted and exit")
+	for _, f := range fields {
+		fs.Var(&pendingFlag{def: f.String(), isBool: f.v.Kind() == reflect.Bool}, f.flagName(), "Config "+f.jsonPath()+" (env "+f.envName()+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	if *path != "" {
+		if err := loadConfigFile(*path, &cfg); err != nil {
+			return cfg, false, err
+		}
+	}
+
+	for _, f := range fields {
+		if s, ok := lookupEnv(getenv, f.envName()); ok {
+			if err := f.set(s); err != nil {
+				return cfg, false, fmt.Errorf("%s: %w", f.envName(), err)
+			}
+		}
+	}
+
+	var errs []error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flagName() == fl.Name {
+				if err := f.set(fl.Value.String()); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", fl.Name, err))
+				}
+			}
+		}
+	})
+	if *port != "" {
+		cfg.Addr = ":" + *port
+	}
+	if *devTLS {
+		cfg.TLS.Dev = true
+	}
+	if err := errors.Join(errs...); err != nil {
+		return cfg, false, err
+	}
+	return cfg, *printConfig, nil
+}
+
+func lookupEnv(getenv func(string) string, name string) (string, bool) {
+	s := getenv(name)
+	return s, s != ""
+}
+
+func loadConfigFile(path string, cfg *config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// pendingFlag holds a flag's raw value until the file and environment layers
+// have been applied.
+type pendingFlag struct {
+	def, val string
+	set      bool
+	isBool   bool
+}
+
+func (p *pendingFlag) IsBoolFlag() bool { return p.isBool }
+
+func (p *pendingFlag) String() string {
+	if p == nil {
+		return ""
+	}
+	if p.set {
+		return p.val
+	}
+	return p.def
+}
+
+func (p *pendingFlag) Set(s string) error {
+	p.val, p.set = s, true
+	return nil
+}
+
+// ─── validation ───────────────────────────────────────────────────────────────
+
+// validate checks the configuration and fills in values that can only be
+// chosen at startup, such as a random token secret.
+func (c *config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("addr: %w", err))
+	}
+	if err := c.TLS.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level: unknown level %q", c.LogLevel)
+
+	if c.Auth.TokenSecret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		c.Auth.TokenSecret = base64.RawStdEncoding.EncodeToString(secret)
+		logger.Warn("auth.token_secret not set; using a random secret, tokens will not survive a restart")
+	}
+	check(len(c.Auth.TokenSecret) >= 16, "auth.token_secret: must be at least 16 bytes")
+	check(c.Auth.TokenTTL.Duration > 0, "auth.token_ttl: must be positive")
+	check((c.Auth.AdminUsername == "") == (c.Auth.AdminPassword == ""), "auth: admin_username and admin_password must be set together")
+
+	check(c.Storage.Backend == "memory", "storage.backend: unsupported backend %q (supported: memory)", c.Storage.Backend)
+
+	for _, o := range c.CORS.AllowedOrigins {
+		if o == "*" {
+			continue
+		}
+		u, err := url.Parse(strings.Replace(o, "*.", "", 1))
+		check(err == nil && u.Scheme != "" && u.Host != "" && u.Path == "", "cors.allowed_origins: %q is not an origin like https://app.example.com", o)
+	}
+	check(!(c.CORS.AllowCredentials && contains(c.CORS.AllowedOrigins, "*")), "cors: allow_credentials cannot be used with origin \"*\"")
+	check(c.CORS.MaxAge.Duration >= 0, "cors.max_age: must not be negative")
+
+	rl := c.RateLimit
+	check(rl.IPRequests > 0 && rl.IPBurst > 0 && rl.UsernameRequests > 0 && rl.UsernameBurst > 0, "rate_limit: requests and bursts must be positive")
+	check(rl.Per.Duration > 0, "rate_limit.per: must be positive")
+	check(rl.LockoutAfter > 0, "rate_limit.lockout_after: must be positive")
+	check(rl.LockoutBase.Duration > 0 && rl.LockoutMax.Duration >= rl.LockoutBase.Duration, "rate_limit: lockout_base must be positive and not above lockout_max")
+
+	h := c.HTTP
+	check(h.ReadHeaderTimeout.Duration > 0 && h.ReadTimeout.Duration >= 0 && h.WriteTimeout.Duration >= 0 && h.IdleTimeout.Duration >= 0, "http: timeouts must not be negative and read_header_timeout must be set")
+	check(h.MaxHeaderBytes > 0, "http.max_header_bytes: must be positive")
+	check(h.ShutdownTimeout.Duration > 0, "http.shutdown_timeout: must be positive")
+	check(h.DrainDelay.Duration >= 0, "http.drain_delay: must not be negative")
+
+	check(c.Events.History > 0 && c.Events.Buffer > 0, "events: history and buffer must be positive")
+	check(c.Events.Retain.Duration > 0, "events.retain: must be positive")
+	check(c.Events.Heartbeat.Duration > 0, "events.heartbeat: must be positive")
+
+	if err := c.Tracing.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Webhooks.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.GraphQL.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.GRPC.validate(c.TLS); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.OIDC.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *config) slogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// redacted returns a copy of c with every non-empty secret replaced.
+func (c config) redacted() config {
+	for _, f := range leaves(reflect.ValueOf(&c).Elem(), nil) {
+		if f.secret && f.v.String() != "" {
+			f.v.SetString("[REDACTED]")
+		}
+	}
+	return c
+}
+
+// ─── reflection over config fields ────────────────────────────────────────────
+
+var durationType = reflect.TypeOf(duration{})
+
+// configField is one settable leaf of config, such as auth.token_ttl.
+type configField struct {
+	path   []string
+	v      reflect.Value
+	secret bool
+}
+
+func leaves(v reflect.Value, path []string) []configField {
+	var out []configField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		p := append(append([]string(nil), path...), name)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			out = append(out, leaves(fv, p)...)
+			continue
+		}
+		out = append(out, configField{path: p, v: fv, secret: sf.Tag.Get("secret") == "true"})
+	}
+	return out
+}
+
+func (f configField) jsonPath() string { return strings.Join(f.path, ".") }
+
+func (f configField) flagName() string {
+	return strings.ReplaceAll(strings.Join(f.path, "-"), "_", "-")
+}
+
+func (f configField) envName() string {
+	return "NOTES_" + strings.ToUpper(strings.Join(f.path, "_"))
+}
+
+func (f configField) String() string {
+	switch f.v.Kind() {
+	case reflect.Slice:
+		return strings.Join(f.v.Interface().([]string), ",")
+	case reflect.Struct:
+		return f.v.Interface().(duration).String()
+	}
+	if f.secret {
+		return ""
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+// set parses s into the field. Lists are comma separated.
+func (f configField) set(s string) error {
+	switch f.v.Kind() {
+	case reflect.String:
+		f.v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(n))
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetFloat(x)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.v.Set(reflect.ValueOf(list))
+	case reflect.Struct:
+		return f.v.Addr().Interface().(*duration).Set(s)
+	default:
+		return fmt.Errorf("unsupported config field type %s", f.v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{
+		"addr": ":9000",
+		"auth": {"token_secret": "from-file-0123456789", "token_ttl": "1h"},
+		"rate_limit": {"ip_burst": 3}
+	}`), 0o600)
+
+	env := map[string]string{
+		"NOTES_AUTH_TOKEN_TTL":       "2h",
+		"NOTES_CORS_ALLOWED_ORIGINS": "https://a.example.com, https://*.b.example.com",
+		"NOTES_TRACING_SAMPLE_RATIO": "0.25",
+	}
+	args := []string{"-config", path, "-auth-token-ttl", "3h", "-log-level", "debug"}
+
+	cfg, printConfig, err := loadConfig(args, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if printConfig {
+		t.Error("print-config should be off")
+	}
+	if cfg.Addr != ":9000" {
+		t.Errorf("file should set addr, got %q", cfg.Addr)
+	}
+	if cfg.Auth.TokenTTL.Duration != 3*time.Hour {
+		t.Errorf("flag should beat env and file, got %v", cfg.Auth.TokenTTL)
+	}
+	if cfg.RateLimit.IPBurst != 3 || cfg.RateLimit.IPRequests != defaultRateLimitConfig().IPRequests {
+		t.Errorf("file should override only the fields it sets, got %+v", cfg.RateLimit)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://*.b.example.com" {
+		t.Errorf("env list not parsed: %v", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("env float not parsed: %v", cfg.Tracing.SampleRatio)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+
+	red := cfg.redacted()
+	if red.Auth.TokenSecret != "[REDACTED]" || cfg.Auth.TokenSecret != "from-file-0123456789" {
+		t.Errorf("redaction wrong: %q / %q", red.Auth.TokenSecret, cfg.Auth.TokenSecret)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Auth.TokenSecret = "short"
+	cfg.LogLevel = "loud"
+	cfg.Storage.Backend = "sql"
+	cfg.CORS.AllowedOrigins = []string{"*", "not-an-origin"}
+	cfg.CORS.AllowCredentials = true
+	cfg.TLS.CertFile = "server.pem"
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.GRPC.Addr = "9090"
+	cfg.Auth.AdminUsername = "root"
+	cfg.OIDC.Issuer = "http://idp.example.com"
+
+	err := cfg.validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"token_secret", "log_level", "storage.backend", "not-an-origin", "allow_credentials", "key_file", "tracing.exporter", "grpc.addr", "admin_password", "oidc.issuer", "oidc.client_id", "oidc.redirect_url"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected an error mentioning %s, got:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// exposedHeaders are response headers browser clients may read.
+var exposedHeaders = []string{
+	requestIDHeader, "Retry-After", "Allow", "Accept-Patch",
+	"Deprecation", "Sunset", "Link",
+}
+
+// withCORS answers preflight requests and adds CORS headers for allowed
+// origins. It runs before routing, so OPTIONS preflights never reach
+// withAuth or a method-restricted route. With no allowed origins it does
+// nothing.
+func withCORS(c corsConfig) middleware {
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+	expose := strings.Join(exposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		if len(c.AllowedOrigins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" || !originAllowed(c.AllowedOrigins, origin) {
+				if preflight {
+					errJSON(w, http.StatusForbidden, "origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if contains(c.AllowedOrigins, "*") && !c.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if c.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if c.MaxAge.Duration > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.Set("Access-Control-Expose-Headers", expose)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// originAllowed matches origin against the configured list. An entry of "*"
+// allows everything; "https://*.example.com" allows any subdomain of
+// example.com over https, but not example.com itself.
+func originAllowed(allowed []string, origin string) bool {
+	o, err := url.Parse(strings.ToLower(origin))
+	if err != nil || o.Scheme == "" || o.Host == "" {
+		return false
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == "*" || a == o.Scheme+"://"+o.Host {
+			return true
+		}
+		scheme, host, ok := strings.Cut(a, "://*.")
+		if ok && scheme == o.Scheme && strings.HasSuffix(o.Host, "."+host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://*.example.org", "http://localhost:3000"}
+	cases := map[string]bool{
+		"https://app.example.com":   true,
+		"https://APP.example.com":   true,
+		"http://app.example.com":    false,
+		"https://a.example.org":     true,
+		"https://a.b.example.org":   true,
+		"https://example.org":       false,
+		"https://evil-example.org":  false,
+		"http://localhost:3000":     true,
+		"http://localhost:3001":     false,
+		"https://app.example.com.x": false,
+	}
+	for origin, want := range cases {
+		if got := originAllowed(allowed, origin); got != want {
+			t.Errorf("originAllowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCORSPreflightSkipsHandler(t *testing.T) {
+	c := defaultConfig().CORS
+	c.AllowedOrigins = []string{"https://*.example.com"}
+	c.AllowCredentials = true
+	c.MaxAge = duration{time.Hour}
+
+	called := false
+	h := withCORS(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/notes", nil)
+	req.Header.Set("Origin", "https://web.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if called {
+		t.Error("preflight reached the wrapped handler")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://web.example.com" {
+		t.Errorf("unexpected allow-origin %q", got)
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "true" || rec.Header().Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("missing credentials or max-age: %v", rec.Header())
+	}
+
+	req.Header.Set("Origin", "https://evil.test")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin got %d %v", rec.Code, rec.Header())
+	}
+}
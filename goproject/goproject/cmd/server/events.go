@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/events"
+	"goproject/internal/notes"
+	"goproject/internal/oidc"
+	"goproject/internal/websocket"
+)
+
+// eventsConfig sizes the change stream. History is how many recent events
+// per user are kept for Last-Event-ID resume, and Retain how long they are
+// kept once the user has no stream open and nothing changes; Buffer is how
+// many events a subscriber may fall behind before it is disconnected.
+type eventsConfig struct {
+	History   int      `json:"history"`
+	Retain    duration `json:"retain"`
+	Buffer    int      `json:"buffer"`
+	Heartbeat duration `json:"heartbeat"`
+}
+
+func defaultEventsConfig() eventsConfig {
+	return eventsConfig{History: 1000, Retain: duration{time.Hour}, Buffer: 64, Heartbeat: duration{25 * time.Second}}
+}
+
+// bus carries note changes to GET /events subscribers.
+var bus = newBus(defaultEventsConfig())
+
+func newBus(c eventsConfig) *events.Bus {
+	return events.NewBus(c.History, c.Buffer, c.Retain.Duration)
+}
+
+func init() {
+	store.OnChange(func(c notes.Change) {
+		bus.Publish(c.Note.UserID, c.Type, c)
+	})
+}
+
+// noteEventV1 is one message on the stream. Besides note changes there are
+// two control types: "reset" when the requested resume point is no longer
+// retained, so the client must refetch its notes, and "lagged" just before
+// a slow client is disconnected.
+type noteEventV1 struct {
+	ID      uint64  `json:"id,omitempty"`
+	Type    string  `json:"type"`
+	NoteID  string  `json:"note_id,omitempty"`
+	Version int     `json:"version,omitempty"`
+	Note    *noteV1 `json:"note,omitempty"` // absent for deleted
+}
+
+func newNoteEventV1(ev events.Event) noteEventV1 {
+	c := ev.Data.(notes.Change)
+	out := noteEventV1{ID: ev.ID, Type: ev.Type, NoteID: c.Note.ID, Version: c.Note.Version}
+	if c.Type != notes.ChangeDeleted {
+		n := newNoteV1(&c.Note)
+		out.Note = &n
+	}
+	return out
+}
+
+// lastEventID reads the resume point from the Last-Event-ID header, or the
+// last_event_id query parameter for clients that cannot set headers.
+func lastEventID(r *http.Request) (uint64, error) {
+	s := r.Header.Get("Last-Event-ID")
+	if s == "" {
+		s = r.URL.Query().Get("last_event_id")
+	}
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// ─── tickets ─────────────────────────────────────────────────────────────────
+
+// Browsers cannot set the Authorization header on an EventSource or a
+// WebSocket handshake, so such clients first trade their token for a ticket
+// and pass it as ?ticket=. A ticket works once and only briefly, because
+// URLs end up in history and proxy logs.
+const (
+	eventsTicketTTL  = 30 * time.Second
+	maxEventsTickets = 10000
+)
+
+type eventsTicket struct {
+	claims  *auth.Claims
+	expires time.Time
+}
+
+var eventsTickets = struct {
+	mu      sync.Mutex
+	tickets map[string]eventsTicket
+}{tickets: make(map[string]eventsTicket)}
+
+type eventsTicketV1 struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func handleEventsTicket(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	ticket, t := oidc.RandomString(24), eventsTicket{claims: claims, expires: time.Now().Add(eventsTicketTTL)}
+
+	eventsTickets.mu.Lock()
+	defer eventsTickets.mu.Unlock()
+	if len(eventsTickets.tickets) >= maxEventsTickets {
+		for s, old := range eventsTickets.tickets {
+			if time.Now().After(old.expires) {
+				delete(eventsTickets.tickets, s)
+			}
+		}
+		if len(eventsTickets.tickets) >= maxEventsTickets {
+			errJSON(w, http.StatusServiceUnavailable, "too many tickets outstanding, retry later")
+			return
+		}
+	}
+	eventsTickets.tickets[ticket] = t
+	writeJSON(w, http.StatusCreated, eventsTicketV1{Ticket: ticket, ExpiresAt: t.expires})
+}
+
+// takeEventsTicket removes a ticket and returns its claims if it had not
+// expired.
+func takeEventsTicket(ticket string) (*auth.Claims, bool) {
+	eventsTickets.mu.Lock()
+	defer eventsTickets.mu.Unlock()
+	t, ok := eventsTickets.tickets[ticket]
+	delete(eventsTickets.tickets, ticket)
+	return t.claims, ok && time.Now().Before(t.expires)
+}
+
+// withEventsAuth is withScope(auth.ScopeNotesRead, next) that also accepts
+// a ticket in place of the Authorization header.
+func withEventsAuth(next http.HandlerFunc) http.HandlerFunc {
+	bearer := withScope(auth.ScopeNotesRead, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" || r.Header.Get("Authorization") != "" {
+			bearer(w, r)
+			return
+		}
+		claims, ok := takeEventsTicket(ticket)
+		if ok {
+			ok = users.Check(r.Context(), claims) == nil
+		}
+		authResult("events_ticket", ok)
+		if !ok {
+			errJSON(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		infoFrom(r.Context()).userID = claims.UserID
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+	}
+}
+
+// ─── stream ──────────────────────────────────────────────────────────────────
+
+// handleEvents streams the caller's note changes, as Server-Sent Events or,
+// if the request is a WebSocket handshake, as JSON text messages.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	after, err := lastEventID(r)
+	if err != nil {
+		errJSON(w, http.StatusBadRequest, "Last-Event-ID must be an event id")
+		return
+	}
+	if websocket.IsUpgrade(r) {
+		serveEventsWebSocket(w, r, claims.UserID, after)
+		return
+	}
+	serveEventsSSE(w, r, claims.UserID, after)
+}
+
+func serveEventsSSE(w http.ResponseWriter, r *http.Request, userID string, after uint64) {
+	sub, missed := bus.Subscribe(userID, after)
+	defer sub.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Each write gets a fresh deadline, so a long-lived stream outlives
+	// the server's write timeout but a stalled client still times out.
+	rc := http.NewResponseController(w)
+	write := func(s string) error {
+		if d := cfg.HTTP.WriteTimeout.Duration; d > 0 {
+			rc.SetWriteDeadline(time.Now().Add(d))
+		}
+		if _, err := fmt.Fprint(w, s); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(ev noteEventV1) error {
+		data, _ := json.Marshal(ev)
+		id := ""
+		if ev.ID != 0 {
+			id = fmt.Sprintf("id: %d\n", ev.ID)
+		}
+		return write(fmt.Sprintf("%sevent: %s\ndata: %s\n\n", id, ev.Type, data))
+	}
+
+	if write("retry: 2000\n\n") != nil {
+		return
+	}
+	if missed && send(noteEventV1{Type: "reset"}) != nil {
+		return
+	}
+	heartbeat := time.NewTicker(cfg.Events.Heartbeat.Duration)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				if sub.Err() == events.ErrSlowConsumer {
+					send(noteEventV1{Type: "lagged"})
+				}
+				return
+			}
+			err = send(newNoteEventV1(ev))
+		case <-heartbeat.C:
+			err = write(": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func serveEventsWebSocket(w http.ResponseWriter, r *http.Request, userID string, after uint64) {
+	conn, err := websocket.Upgrade(w, r)
+	switch {
+	case err == websocket.ErrVersion:
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		errJSON(w, http.StatusUpgradeRequired, "only WebSocket version 13 is supported")
+		return
+	case err == websocket.ErrNotWebSocket:
+		errJSON(w, http.StatusBadRequest, "invalid WebSocket handshake")
+		return
+	case err != nil:
+		errJSON(w, http.StatusInternalServerError, "WebSocket is not available on this connection")
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	sub, missed := bus.Subscribe(userID, after)
+	defer sub.Close()
+
+	// Client messages are not used, but reading is what answers pings and
+	// notices that the client went away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(op int, p []byte) error {
+		if d := cfg.HTTP.WriteTimeout.Duration; d > 0 {
+			conn.SetWriteDeadline(time.Now().Add(d))
+		}
+		return conn.WriteMessage(op, p)
+	}
+	send := func(ev noteEventV1) error {
+		data, _ := json.Marshal(ev)
+		return write(websocket.TextMessage, data)
+	}
+
+	if missed && send(noteEventV1{Type: "reset"}) != nil {
+		return
+	}
+	heartbeat := time.NewTicker(cfg.Events.Heartbeat.Duration)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				switch sub.Err() {
+				case events.ErrSlowConsumer:
+					send(noteEventV1{Type: "lagged"})
+					conn.Close(websocket.CloseTryAgainLater, "lagged")
+				case events.ErrRemoved:
+					conn.Close(websocket.CloseNormal, "account deleted")
+				default:
+					conn.Close(websocket.CloseGoingAway, "server shutting down")
+				}
+				return
+			}
+			err = send(newNoteEventV1(ev))
+		case <-heartbeat.C:
+			err = write(websocket.PingMessage, nil)
+		case <-gone:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
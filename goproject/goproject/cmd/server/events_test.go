@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goproject/internal/auth"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	if tokens.TokenManager == nil {
+		tokens = tracedTokens{auth.NewTokenManager("events-test-secret")}
+	}
+	// Every test registers from 127.0.0.1; give each its own budget.
+	limits = newAuthLimits(defaultRateLimitConfig())
+	srv := httptest.NewServer(chain(newRouter(), withRequestID))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func registerToken(t *testing.T, srv *httptest.Server, username string) string {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/v1/auth/register", "application/json",
+		strings.NewReader(`{"username":"`+username+`","password":"secret123"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body authResponseV1
+	json.NewDecoder(resp.Body).Decode(&body)
+	return body.Token
+}
+
+func call(t *testing.T, srv *httptest.Server, token, method, path, body string) map[string]any {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return out
+}
+
+// readEvent returns the id, event type and data of the next SSE event.
+func readEvent(t *testing.T, r *bufio.Reader) (id, typ string, data noteEventV1) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			typ = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			json.Unmarshal([]byte(line[6:]), &data)
+		case line == "" && typ != "":
+			return id, typ, data
+		}
+	}
+}
+
+func openStream(t *testing.T, srv *httptest.Server, token, lastID string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest("GET", srv.URL+"/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventStreamAndResume(t *testing.T) {
+	srv := newTestServer(t)
+	alice := registerToken(t, srv, "events-alice")
+	bob := registerToken(t, srv, "events-bob")
+
+	stream := openStream(t, srv, alice, "")
+	call(t, srv, bob, "POST", "/v1/notes", `{"title":"not for alice"}`)
+	note := call(t, srv, alice, "POST", "/v1/notes", `{"title":"a"}`)
+
+	id, typ, ev := readEvent(t, stream)
+	if typ != "created" || ev.NoteID != note["id"] || ev.Version != 1 || ev.Note == nil || ev.Note.Title != "a" {
+		t.Fatalf("first event = %s %+v", typ, ev)
+	}
+
+	noteID := note["id"].(string)
+	call(t, srv, alice, "PUT", "/v1/notes/"+noteID, `{"title":"b"}`)
+	call(t, srv, alice, "DELETE", "/v1/notes/"+noteID, "")
+
+	resumed := openStream(t, srv, alice, id)
+	_, typ, ev = readEvent(t, resumed)
+	if typ != "updated" || ev.Version != 2 || ev.Note.Title != "b" {
+		t.Errorf("resumed stream started with %s %+v", typ, ev)
+	}
+	_, typ, ev = readEvent(t, resumed)
+	if typ != "deleted" || ev.Version != 3 || ev.Note != nil {
+		t.Errorf("expected deletion, got %s %+v", typ, ev)
+	}
+
+	_, typ, _ = readEvent(t, openStream(t, srv, alice, "999999"))
+	if typ != "reset" {
+		t.Errorf("unknown resume point should reset, got %s", typ)
+	}
+}
+
+func TestEventStreamTicket(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "events-ticket")
+
+	ticket, _ := call(t, srv, token, "POST", "/v1/events/ticket", "")["ticket"].(string)
+	if ticket == "" {
+		t.Fatal("no ticket issued")
+	}
+	get := func(query string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/v1/events" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("?ticket=" + ticket)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream with ticket = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	note := call(t, srv, token, "POST", "/v1/notes", `{"title":"via ticket"}`)
+	if _, typ, ev := readEvent(t, bufio.NewReader(resp.Body)); typ != "created" || ev.NoteID != note["id"] {
+		t.Errorf("first event = %s %+v", typ, ev)
+	}
+
+	if resp := get("?ticket=" + ticket); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("reused ticket = %d", resp.StatusCode)
+	}
+	if resp := get(""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no credentials = %d", resp.StatusCode)
+	}
+}
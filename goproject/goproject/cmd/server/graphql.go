@@ -0,0 +1,866 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/graphql"
+	"goproject/internal/notes"
+	"goproject/internal/validation"
+	"goproject/internal/websocket"
+)
+
+// graphqlConfig limits what a single GraphQL request may ask for. Depth
+// counts nested fields; complexity is one per field, with list fields
+// multiplied by the number of items they ask for.
+type graphqlConfig struct {
+	MaxDepth      int  `json:"max_depth"`
+	MaxComplexity int  `json:"max_complexity"`
+	Introspection bool `json:"introspection"`
+}
+
+func defaultGraphQLConfig() graphqlConfig {
+	return graphqlConfig{MaxDepth: 10, MaxComplexity: 1000, Introspection: true}
+}
+
+func (c graphqlConfig) validate() error {
+	if c.MaxDepth < 1 || c.MaxComplexity < 1 {
+		return errors.New("graphql: max_depth and max_complexity must be positive")
+	}
+	return nil
+}
+
+// gqlSchema serves /graphql.
+var gqlSchema = newGraphQLSchema(defaultGraphQLConfig())
+
+// Error codes in the "code" extension of GraphQL errors, besides those of
+// the graphql package.
+const (
+	gqlUnauthenticated = "UNAUTHENTICATED"
+	gqlForbidden       = "FORBIDDEN"
+	gqlNotFound        = "NOT_FOUND"
+)
+
+func gqlError(code, msg string) *graphql.Error {
+	return &graphql.Error{Message: msg, Extensions: map[string]any{"code": code}}
+}
+
+// gqlNoteError translates store and validation errors.
+func gqlNoteError(err error) error {
+	var verr *validation.Error
+	switch {
+	case err == notes.ErrNotFound:
+		return gqlError(gqlNotFound, "note not found")
+	case err == notes.ErrForbidden:
+		return gqlError(gqlForbidden, "access denied")
+	case errors.As(err, &verr):
+		e := gqlError(graphql.CodeBadUserInput, "one or more fields are invalid")
+		e.Extensions["fields"] = verr.Fields
+		return e
+	}
+	return err
+}
+
+// viewer returns the caller's claims. Fields that need a signed-in user
+// call it first, so anonymous requests get UNAUTHENTICATED errors field by
+// field instead of a 401.
+func viewer(p graphql.Params) (*auth.Claims, error) {
+	claims, _ := p.Context.Value(claimsKey).(*auth.Claims)
+	if claims == nil {
+		return nil, gqlError(gqlUnauthenticated, "sign in to read this field")
+	}
+	return claims, nil
+}
+
+// self checks that a User field is read by that user.
+func self(p graphql.Params) (*auth.Claims, error) {
+	claims, err := viewer(p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Source.(*auth.Claims).UserID != claims.UserID {
+		return nil, gqlError(gqlForbidden, "access denied")
+	}
+	return claims, nil
+}
+
+// ─── aggregations ─────────────────────────────────────────────────────────────
+
+type tagCount struct {
+	Tag   string
+	Count int
+	Open  int
+}
+
+// tagCounts counts notes per tag, most used first.
+func tagCounts(list []*notes.Note) []tagCount {
+	byTag := make(map[string]*tagCount)
+	for _, n := range list {
+		for _, tag := range n.Tags {
+			tc := byTag[tag]
+			if tc == nil {
+				tc = &tagCount{Tag: tag}
+				byTag[tag] = tc
+			}
+			tc.Count++
+			if !n.Done {
+				tc.Open++
+			}
+		}
+	}
+	out := make([]tagCount, 0, len(byTag))
+	for _, tc := range byTag {
+		out = append(out, *tc)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Tag < out[j].Tag
+	})
+	return out
+}
+
+type noteStats struct {
+	Total, Done, Open, Pinned int
+	ByPriority                map[notes.Priority]int
+}
+
+func statsOf(list []*notes.Note) noteStats {
+	s := noteStats{Total: len(list), ByPriority: make(map[notes.Priority]int)}
+	for _, n := range list {
+		if n.Done {
+			s.Done++
+		}
+		if n.Pinned {
+			s.Pinned++
+		}
+		s.ByPriority[n.Priority]++
+	}
+	s.Open = s.Total - s.Done
+	return s
+}
+
+// filterNotes applies the filter arguments of notes fields.
+func filterNotes(list []*notes.Note, args map[string]any) []*notes.Note {
+	out := list[:0:0]
+	for _, n := range list {
+		if done, ok := args["done"].(bool); ok && n.Done != done {
+			continue
+		}
+		if pinned, ok := args["pinned"].(bool); ok && n.Pinned != pinned {
+			continue
+		}
+		if p, ok := args["priority"].(notes.Priority); ok && n.Priority != p {
+			continue
+		}
+		if tag, ok := args["tag"].(string); ok && !slices.Contains(n.Tags, tag) {
+			continue
+		}
+		out = append(out, n)
+	}
+	offset := min(args["offset"].(int), len(out))
+	return out[offset:min(offset+args["first"].(int), len(out))]
+}
+
+// ─── schema ───────────────────────────────────────────────────────────────────
+
+// maxNotesPage bounds the first argument of notes fields.
+const maxNotesPage = 500
+
+func newGraphQLSchema(c graphqlConfig) *graphql.Schema {
+	nonNull := graphql.NonNullOf
+	listOf := func(t graphql.Type) graphql.Type { return nonNull(graphql.ListOf(nonNull(t))) }
+	src := func(get func(n *notes.Note) any) func(graphql.Params) (any, error) {
+		return func(p graphql.Params) (any, error) { return get(p.Source.(*notes.Note)), nil }
+	}
+
+	dateTime := &graphql.Scalar{
+		Name:        "DateTime",
+		Description: "An RFC 3339 timestamp.",
+		Parse: func(v any) (any, bool) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, false
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			return t, err == nil
+		},
+		Serialize: func(v any) (any, bool) {
+			t, ok := v.(time.Time)
+			return t.Format(time.RFC3339Nano), ok
+		},
+	}
+	priority := &graphql.Enum{Name: "Priority", Values: []graphql.EnumValue{
+		{Name: "LOW", Value: notes.PriorityLow},
+		{Name: "MEDIUM", Value: notes.PriorityMedium},
+		{Name: "HIGH", Value: notes.PriorityHigh},
+	}}
+	changeType := &graphql.Enum{Name: "ChangeType", Values: []graphql.EnumValue{
+		{Name: "CREATED", Value: notes.ChangeCreated},
+		{Name: "UPDATED", Value: notes.ChangeUpdated},
+		{Name: "DELETED", Value: notes.ChangeDeleted},
+	}}
+
+	tagCountType := &graphql.Object{Name: "TagCount", Description: "How many notes carry a tag.", Fields: []*graphql.Field{
+		{Name: "tag", Type: nonNull(graphql.String), Resolve: func(p graphql.Params) (any, error) { return p.Source.(tagCount).Tag, nil }},
+		{Name: "count", Type: nonNull(graphql.Int), Resolve: func(p graphql.Params) (any, error) { return p.Source.(tagCount).Count, nil }},
+		{Name: "open", Type: nonNull(graphql.Int), Description: "Notes with the tag that are not done.",
+			Resolve: func(p graphql.Params) (any, error) { return p.Source.(tagCount).Open, nil }},
+	}}
+	priorityCount := &graphql.Object{Name: "PriorityCount", Fields: []*graphql.Field{
+		{Name: "priority", Type: nonNull(priority)},
+		{Name: "count", Type: nonNull(graphql.Int)},
+	}}
+	statsType := &graphql.Object{Name: "NoteStats", Fields: []*graphql.Field{
+		{Name: "total", Type: nonNull(graphql.Int), Resolve: func(p graphql.Params) (any, error) { return p.Source.(noteStats).Total, nil }},
+		{Name: "done", Type: nonNull(graphql.Int), Resolve: func(p graphql.Params) (any, error) { return p.Source.(noteStats).Done, nil }},
+		{Name: "open", Type: nonNull(graphql.Int), Resolve: func(p graphql.Params) (any, error) { return p.Source.(noteStats).Open, nil }},
+		{Name: "pinned", Type: nonNull(graphql.Int), Resolve: func(p graphql.Params) (any, error) { return p.Source.(noteStats).Pinned, nil }},
+		{Name: "byPriority", Type: listOf(priorityCount), Resolve: func(p graphql.Params) (any, error) {
+			s := p.Source.(noteStats)
+			out := make([]map[string]any, 0, 3)
+			for _, pr := range []notes.Priority{notes.PriorityLow, notes.PriorityMedium, notes.PriorityHigh} {
+				out = append(out, map[string]any{"priority": pr, "count": s.ByPriority[pr]})
+			}
+			return out, nil
+		}},
+	}}
+
+	noteArgs := []*graphql.Argument{
+		{Name: "done", Type: graphql.Boolean},
+		{Name: "pinned", Type: graphql.Boolean},
+		{Name: "priority", Type: priority},
+		{Name: "tag", Type: graphql.String},
+		{Name: "first", Type: graphql.Int, Default: 50, Description: "At most 500."},
+		{Name: "offset", Type: graphql.Int, Default: 0},
+	}
+	// notes fields cost their page size times the cost of one note.
+	notesComplexity := func(args map[string]any, child int) int {
+		return 1 + args["first"].(int)*child
+	}
+	listNotes := func(p graphql.Params, userID string) (any, error) {
+		first, offset := p.Args["first"].(int), p.Args["offset"].(int)
+		if first < 0 || first > maxNotesPage || offset < 0 {
+			return nil, gqlError(graphql.CodeBadUserInput, "first must be between 0 and 500 and offset must not be negative")
+		}
+		return filterNotes(store.List(p.Context, userID), p.Args), nil
+	}
+
+	user := &graphql.Object{Name: "User", Description: "A user. Only the signed-in user can read their notes, tags and stats."}
+	note := &graphql.Object{Name: "Note", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID), Resolve: src(func(n *notes.Note) any { return n.ID })},
+		{Name: "title", Type: nonNull(graphql.String), Resolve: src(func(n *notes.Note) any { return n.Title })},
+		{Name: "body", Type: nonNull(graphql.String), Resolve: src(func(n *notes.Note) any { return n.Body })},
+		{Name: "done", Type: nonNull(graphql.Boolean), Resolve: src(func(n *notes.Note) any { return n.Done })},
+		{Name: "priority", Type: nonNull(priority), Resolve: src(func(n *notes.Note) any { return n.Priority })},
+		{Name: "tags", Type: listOf(graphql.String), Resolve: src(func(n *notes.Note) any { return n.Tags })},
+		{Name: "pinned", Type: nonNull(graphql.Boolean), Resolve: src(func(n *notes.Note) any { return n.Pinned })},
+		{Name: "position", Type: nonNull(graphql.String), Resolve: src(func(n *notes.Note) any { return n.Position })},
+		{Name: "version", Type: nonNull(graphql.Int), Resolve: src(func(n *notes.Note) any { return n.Version })},
+		{Name: "createdAt", Type: nonNull(dateTime), Resolve: src(func(n *notes.Note) any { return n.CreatedAt })},
+		{Name: "updatedAt", Type: nonNull(dateTime), Resolve: src(func(n *notes.Note) any { return n.UpdatedAt })},
+		{Name: "owner", Type: nonNull(user), Resolve: func(p graphql.Params) (any, error) {
+			claims, err := viewer(p)
+			if err != nil {
+				return nil, err
+			}
+			if p.Source.(*notes.Note).UserID != claims.UserID {
+				return nil, gqlError(gqlForbidden, "access denied")
+			}
+			return claims, nil
+		}},
+	}}
+	user.Fields = []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID), Resolve: func(p graphql.Params) (any, error) { return p.Source.(*auth.Claims).UserID, nil }},
+		{Name: "username", Type: nonNull(graphql.String), Resolve: func(p graphql.Params) (any, error) { return p.Source.(*auth.Claims).Username, nil }},
+		{Name: "notes", Type: listOf(note), Args: noteArgs, Complexity: notesComplexity, Resolve: func(p graphql.Params) (any, error) {
+			claims, err := self(p)
+			if err != nil {
+				return nil, err
+			}
+			return listNotes(p, claims.UserID)
+		}},
+		{Name: "tags", Type: listOf(tagCountType), Resolve: func(p graphql.Params) (any, error) {
+			claims, err := self(p)
+			if err != nil {
+				return nil, err
+			}
+			return tagCounts(store.List(p.Context, claims.UserID)), nil
+		}},
+		{Name: "stats", Type: nonNull(statsType), Resolve: func(p graphql.Params) (any, error) {
+			claims, err := self(p)
+			if err != nil {
+				return nil, err
+			}
+			return statsOf(store.List(p.Context, claims.UserID)), nil
+		}},
+	}
+
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "me", Type: user, Resolve: func(p graphql.Params) (any, error) {
+			return viewer(p)
+		}},
+		{Name: "note", Type: note, Args: []*graphql.Argument{{Name: "id", Type: nonNull(graphql.ID)}},
+			Description: "A note by ID, or null if there is none.",
+			Resolve: func(p graphql.Params) (any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				n, err := store.Get(p.Context, claims.UserID, p.Args["id"].(string))
+				if err == notes.ErrNotFound {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, gqlNoteError(err)
+				}
+				return n, nil
+			}},
+		{Name: "notes", Type: listOf(note), Args: noteArgs, Complexity: notesComplexity,
+			Description: "Your notes, pinned first, in position order.",
+			Resolve: func(p graphql.Params) (any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				return listNotes(p, claims.UserID)
+			}},
+		{Name: "tags", Type: listOf(tagCountType), Description: "Your tags, most used first.",
+			Resolve: func(p graphql.Params) (any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				return tagCounts(store.List(p.Context, claims.UserID)), nil
+			}},
+		{Name: "stats", Type: nonNull(statsType), Resolve: func(p graphql.Params) (any, error) {
+			claims, err := viewer(p)
+			if err != nil {
+				return nil, err
+			}
+			return statsOf(store.List(p.Context, claims.UserID)), nil
+		}},
+	}}
+
+	createInput := &graphql.InputObject{Name: "CreateNoteInput", Fields: []*graphql.Argument{
+		{Name: "title", Type: nonNull(graphql.String)},
+		{Name: "body", Type: graphql.String},
+		{Name: "priority", Type: priority},
+		{Name: "tags", Type: graphql.ListOf(nonNull(graphql.String))},
+		{Name: "pinned", Type: graphql.Boolean},
+	}}
+	updateInput := &graphql.InputObject{Name: "UpdateNoteInput", Description: "Fields to change; omitted fields keep their value.", Fields: []*graphql.Argument{
+		{Name: "title", Type: graphql.String},
+		{Name: "body", Type: graphql.String},
+		{Name: "done", Type: graphql.Boolean},
+		{Name: "priority", Type: priority},
+		{Name: "tags", Type: graphql.ListOf(nonNull(graphql.String))},
+		{Name: "pinned", Type: graphql.Boolean},
+	}}
+	mutation := &graphql.Object{Name: "Mutation", Fields: []*graphql.Field{
+		{Name: "createNote", Type: nonNull(note), Args: []*graphql.Argument{{Name: "input", Type: nonNull(createInput)}},
+			Resolve: func(p graphql.Params) (any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				in := p.Args["input"].(map[string]any)
+				input := notes.CreateInput{Title: in["title"].(string)}
+				input.Body, _ = in["body"].(string)
+				input.Priority, _ = in["priority"].(notes.Priority)
+				input.Tags = stringList(in["tags"])
+				input.Pinned, _ = in["pinned"].(bool)
+				if err := input.Validate(); err != nil {
+					return nil, gqlNoteError(err)
+				}
+				n := store.Create(p.Context, claims.UserID, input)
+				return n, nil
+			}},
+		{Name: "updateNote", Type: nonNull(note), Args: []*graphql.Argument{{Name: "id", Type: nonNull(graphql.ID)}, {Name: "input", Type: nonNull(updateInput)}},
+			Resolve: func(p graphql.Params) (any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				input, err := updateInputOf(p.Args["input"].(map[string]any))
+				if err == nil {
+					err = input.Validate()
+				}
+				if err != nil {
+					return nil, gqlNoteError(err)
+				}
+				n, err := store.Update(p.Context, claims.UserID, p.Args["id"].(string), input)
+				if err != nil {
+					return nil, gqlNoteError(err)
+				}
+				return n, nil
+			}},
+		{Name: "deleteNote", Type: nonNull(graphql.ID), Args: []*graphql.Argument{{Name: "id", Type: nonNull(graphql.ID)}},
+			Description: "Delete a note and return its ID.",
+			Resolve: func(p graphql.Params) (any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				id := p.Args["id"].(string)
+				if err := store.Delete(p.Context, claims.UserID, id); err != nil {
+					return nil, gqlNoteError(err)
+				}
+				return id, nil
+			}},
+	}}
+
+	noteChange := &graphql.Object{Name: "NoteChange", Fields: []*graphql.Field{
+		{Name: "type", Type: nonNull(changeType), Resolve: func(p graphql.Params) (any, error) { return p.Source.(*notes.Change).Type, nil }},
+		{Name: "note", Type: nonNull(note), Description: "For DELETED, the note as it was.",
+			Resolve: func(p graphql.Params) (any, error) { return &p.Source.(*notes.Change).Note, nil }},
+		{Name: "fields", Type: listOf(graphql.String), Description: "The fields the write changed.",
+			Resolve: func(p graphql.Params) (any, error) { return p.Source.(*notes.Change).Fields, nil }},
+	}}
+	subscription := &graphql.Object{Name: "Subscription", Fields: []*graphql.Field{
+		{Name: "noteChanged", Type: nonNull(noteChange), Description: "Your note changes as they happen.",
+			Subscribe: func(p graphql.Params) (<-chan any, error) {
+				claims, err := viewer(p)
+				if err != nil {
+					return nil, err
+				}
+				sub, _ := bus.Subscribe(claims.UserID, 0)
+				out := make(chan any)
+				go func() {
+					defer close(out)
+					defer sub.Close()
+					for {
+						select {
+						case ev, ok := <-sub.C:
+							if !ok {
+								return
+							}
+							c := ev.Data.(notes.Change)
+							select {
+							case out <- &c:
+							case <-p.Context.Done():
+								return
+							}
+						case <-p.Context.Done():
+							return
+						}
+					}
+				}()
+				return out, nil
+			}},
+	}}
+
+	s, err := graphql.NewSchema(query, mutation, subscription)
+	if err != nil {
+		panic(err)
+	}
+	s.MaxDepth = c.MaxDepth
+	s.MaxComplexity = c.MaxComplexity
+	s.DisableIntrospection = !c.Introspection
+	return s
+}
+
+// stringList converts a coerced [String!] argument.
+func stringList(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = s.(string)
+	}
+	return out
+}
+
+// updateInputOf converts UpdateNoteInput. Explicit nulls are refused
+// rather than taken to mean "unchanged".
+func updateInputOf(in map[string]any) (notes.UpdateInput, error) {
+	var out notes.UpdateInput
+	var verr validation.Error
+	for name, v := range in {
+		if v == nil {
+			verr.Add(name, "must not be null")
+			continue
+		}
+		switch name {
+		case "title":
+			s := v.(string)
+			out.Title = &s
+		case "body":
+			s := v.(string)
+			out.Body = &s
+		case "done":
+			b := v.(bool)
+			out.Done = &b
+		case "priority":
+			p := v.(notes.Priority)
+			out.Priority = &p
+		case "tags":
+			out.Tags = stringList(v)
+		case "pinned":
+			b := v.(bool)
+			out.Pinned = &b
+		}
+	}
+	return out, verr.Err()
+}
+
+// ─── HTTP ─────────────────────────────────────────────────────────────────────
+
+// graphqlRoutes is mounted at the root: the schema is versioned by evolving
+// it, not by path.
+func graphqlRoutes() []route {
+	return []route{
+		{http.MethodPost, "/graphql", handleGraphQL},
+		{http.MethodGet, "/graphql", handleGraphQL},
+	}
+}
+
+var graphqlDocs = map[string]operation{
+	"POST /graphql": {
+		id: "graphql", tag: "graphql",
+		summary: "Run a GraphQL query or mutation. Send a token to read your notes; fields that need one fail with UNAUTHENTICATED without it. " +
+			"Errors are reported in the response with status 200; data is absent if the request could not run at all.",
+		request:   jsonBody(graphqlRequestV1{}),
+		responses: map[int]any{200: graphqlResponseV1{}, 401: problem{}},
+	},
+	"GET /graphql": {
+		id: "graphqlGet", tag: "graphql",
+		summary: "Run a query given as ?query=, ?operationName= and ?variables= (JSON). " +
+			"A WebSocket upgrade with the graphql-transport-ws subprotocol runs subscriptions.",
+		responses: map[int]any{101: nil, 200: graphqlResponseV1{}, 400: problem{}, 401: problem{}, 405: problem{}},
+	},
+}
+
+// The GraphQL wire types, named for the OpenAPI document. Response data
+// is an object, or null when a non-null root field failed.
+type (
+	graphqlRequestV1  graphql.Request
+	graphqlErrorV1    graphql.Error
+	graphqlResponseV1 struct {
+		Data   any              `json:"data,omitempty"`
+		Errors []graphqlErrorV1 `json:"errors,omitempty"`
+	}
+)
+
+// graphqlContext adds the caller's claims, if any, to ctx. ok is false for
+// an Authorization header with a bad token: that is an error rather than
+// an anonymous request.
+func graphqlContext(r *http.Request) (ctx context.Context, ok bool) {
+	claims, valid := getUser(r)
+	if !valid {
+		return r.Context(), r.Header.Get("Authorization") == ""
+	}
+	infoFrom(r.Context()).userID = claims.UserID
+	return context.WithValue(r.Context(), claimsKey, claims), true
+}
+
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsUpgrade(r) {
+		serveGraphQLWebSocket(w, r)
+		return
+	}
+	ctx, ok := graphqlContext(r)
+	if !ok {
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := decodeJSON([]byte(v), &req.Variables); err != nil {
+				errJSON(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	} else {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBody))
+		if err == nil {
+			err = decodeJSON(body, &req)
+		}
+		if err != nil {
+			errInput(w, err)
+			return
+		}
+	}
+
+	p, resp := gqlSchema.Prepare(req)
+	if resp != nil {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	switch {
+	case p.Type() == "subscription":
+		writeJSON(w, http.StatusOK, &graphql.Response{Errors: []*graphql.Error{
+			gqlError(graphql.CodeValidationFailed, "subscriptions need a WebSocket with the graphql-transport-ws subprotocol"),
+		}})
+		return
+	case p.Type() == "mutation" && r.Method == http.MethodGet:
+		w.Header().Set("Allow", http.MethodPost)
+		errJSON(w, http.StatusMethodNotAllowed, "mutations must be sent with POST")
+		return
+	}
+	span := childSpan(r.Context(), "graphql.Execute")
+	resp = p.Execute(ctx)
+	span.End()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decodeJSON decodes numbers as json.Number, which is what the graphql
+// package expects of variables.
+func decodeJSON(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// ─── graphql-transport-ws ─────────────────────────────────────────────────────
+
+// The WebSocket subprotocol for subscriptions, as used by graphql-ws and
+// Apollo.
+const graphqlWSProtocol = "graphql-transport-ws"
+
+// Close codes of graphql-transport-ws.
+const (
+	wsBadRequest         = 4400
+	wsUnauthorized       = 4401
+	wsForbidden          = 4403
+	wsInitTimeout        = 4408
+	wsSubscriberExists   = 4409
+	wsTooManyInitRequest = 4429
+)
+
+// graphqlInitTimeout is how long a client has to send connection_init.
+var graphqlInitTimeout = 10 * time.Second
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// serveGraphQLWebSocket speaks graphql-transport-ws. The token may come
+// from the handshake's Authorization header or from an "Authorization" or
+// "authorization" key in the connection_init payload, since browsers
+// cannot set headers on WebSockets.
+func serveGraphQLWebSocket(w http.ResponseWriter, r *http.Request) {
+	if websocket.Subprotocol(r, graphqlWSProtocol) == "" {
+		errJSON(w, http.StatusBadRequest, "use the "+graphqlWSProtocol+" subprotocol")
+		return
+	}
+	ctx, ok := graphqlContext(r)
+	if !ok {
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	w.Header().Set("Sec-WebSocket-Protocol", graphqlWSProtocol)
+	conn, err := websocket.Upgrade(w, r)
+	switch {
+	case err == websocket.ErrVersion:
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		errJSON(w, http.StatusUpgradeRequired, "only WebSocket version 13 is supported")
+		return
+	case err == websocket.ErrNotWebSocket:
+		errJSON(w, http.StatusBadRequest, "invalid WebSocket handshake")
+		return
+	case err != nil:
+		errJSON(w, http.StatusInternalServerError, "WebSocket is not available on this connection")
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+	s := &gqlSession{conn: conn, ops: make(map[string]context.CancelFunc)}
+	defer s.wg.Wait()
+	opCtx := ctx // gets the connection_init token, if any
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	messages := make(chan wsMessage)
+	go func() {
+		defer close(messages)
+		for {
+			op, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var m wsMessage
+			if op != websocket.TextMessage || json.Unmarshal(p, &m) != nil || m.Type == "" {
+				conn.Close(wsBadRequest, "invalid message")
+				return
+			}
+			select {
+			case messages <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	initTimeout := time.NewTimer(graphqlInitTimeout)
+	defer initTimeout.Stop()
+	heartbeat := time.NewTicker(cfg.Events.Heartbeat.Duration)
+	defer heartbeat.Stop()
+	acked := false
+	for {
+		select {
+		case <-initTimeout.C:
+			if !acked {
+				conn.Close(wsInitTimeout, "connection initialisation timeout")
+				return
+			}
+		case <-heartbeat.C:
+			if s.write(websocket.PingMessage, nil) != nil {
+				return
+			}
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			switch m.Type {
+			case "connection_init":
+				if acked {
+					conn.Close(wsTooManyInitRequest, "too many initialisation requests")
+					return
+				}
+				var payload map[string]any
+				json.Unmarshal(m.Payload, &payload)
+				claims, ok := initClaims(payload)
+				if !ok {
+					conn.Close(wsForbidden, "forbidden")
+					return
+				}
+				if claims != nil {
+					opCtx = context.WithValue(opCtx, claimsKey, claims)
+				}
+				acked = true
+				s.send(wsMessage{Type: "connection_ack"})
+			case "ping":
+				s.send(wsMessage{Type: "pong"})
+			case "pong":
+			case "subscribe":
+				if !acked {
+					conn.Close(wsUnauthorized, "unauthorized")
+					return
+				}
+				var req graphql.Request
+				if m.ID == "" || decodeJSON(m.Payload, &req) != nil {
+					conn.Close(wsBadRequest, "invalid subscribe message")
+					return
+				}
+				if !s.start(opCtx, m.ID, req) {
+					conn.Close(wsSubscriberExists, "subscriber for "+m.ID+" already exists")
+					return
+				}
+			case "complete":
+				s.stop(m.ID)
+			default:
+				conn.Close(wsBadRequest, "unknown message type "+m.Type)
+				return
+			}
+		}
+	}
+}
+
+// initClaims reads a token from a connection_init payload. It returns nil
+// claims and true when there is none, keeping the handshake's claims.
+func initClaims(payload map[string]any) (*auth.Claims, bool) {
+	header, _ := payload["Authorization"].(string)
+	if header == "" {
+		header, _ = payload["authorization"].(string)
+	}
+	if header == "" {
+		return nil, true
+	}
+	r := &http.Request{Header: http.Header{"Authorization": {header}}}
+	return getUser(r.WithContext(context.Background()))
+}
+
+// gqlSession tracks the operations running on one WebSocket.
+type gqlSession struct {
+	conn *websocket.Conn
+	wg   sync.WaitGroup
+
+	mu  sync.Mutex
+	ops map[string]context.CancelFunc
+}
+
+func (s *gqlSession) write(op int, p []byte) error {
+	if d := cfg.HTTP.WriteTimeout.Duration; d > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(d))
+	}
+	return s.conn.WriteMessage(op, p)
+}
+
+func (s *gqlSession) send(m wsMessage) error {
+	b, _ := json.Marshal(m)
+	return s.write(websocket.TextMessage, b)
+}
+
+func (s *gqlSession) sendJSON(id, typ string, payload any) error {
+	b, _ := json.Marshal(payload)
+	return s.send(wsMessage{ID: id, Type: typ, Payload: b})
+}
+
+// start runs an operation until it completes or the client stops it. It
+// reports false if id is already in use.
+func (s *gqlSession) start(ctx context.Context, id string, req graphql.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.ops[id]; dup {
+		return false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.ops[id] = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.stop(id)
+		s.run(ctx, id, req)
+	}()
+	return true
+}
+
+func (s *gqlSession) stop(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.ops[id]; ok {
+		cancel()
+		delete(s.ops, id)
+	}
+}
+
+func (s *gqlSession) run(ctx context.Context, id string, req graphql.Request) {
+	p, resp := gqlSchema.Prepare(req)
+	if resp != nil {
+		s.sendJSON(id, "error", resp.Errors)
+		return
+	}
+	if p.Type() != "subscription" {
+		s.sendJSON(id, "next", p.Execute(ctx))
+		s.send(wsMessage{ID: id, Type: "complete"})
+		return
+	}
+	events, resp := p.Subscribe(ctx)
+	if resp != nil {
+		s.sendJSON(id, "error", resp.Errors)
+		return
+	}
+	for resp := range events {
+		if s.sendJSON(id, "next", resp) != nil {
+			return
+		}
+	}
+	if ctx.Err() == nil {
+		s.send(wsMessage{ID: id, Type: "complete"})
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gql posts a query, anonymously if token is empty.
+func gql(t *testing.T, srv *httptest.Server, token, query string) map[string]any {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	if token != "" {
+		return call(t, srv, token, "POST", "/graphql", string(body))
+	}
+	resp, err := http.Post(srv.URL+"/graphql", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return out
+}
+
+func TestGraphQLQueriesAndMutations(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "gql-user")
+
+	created := gql(t, srv, token, `mutation {
+		a: createNote(input: {title: "a", tags: ["work", "home"], priority: HIGH}) { id priority }
+		b: createNote(input: {title: "b", tags: ["work"]}) { id }
+	}`)
+	data := created["data"].(map[string]any)
+	a := data["a"].(map[string]any)
+	if a["priority"] != "HIGH" {
+		t.Fatalf("createNote = %v", created)
+	}
+	id := a["id"].(string)
+	gql(t, srv, token, `mutation { updateNote(id: "`+id+`", input: {done: true}) { version } }`)
+
+	got := gql(t, srv, token, `{
+		me { username tags { tag count open } }
+		notes(done: true) { title owner { username } }
+		stats { total done byPriority { priority count } }
+	}`)
+	raw, _ := json.Marshal(got)
+	for _, want := range []string{
+		`"tags":[{"count":2,"open":1,"tag":"work"},{"count":1,"open":0,"tag":"home"}]`,
+		`"notes":[{"owner":{"username":"gql-user"},"title":"a"}]`,
+		`{"count":1,"priority":"HIGH"}`,
+		`"done":1`,
+	} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("query result lacks %s: %s", want, raw)
+		}
+	}
+
+	invalid := gql(t, srv, token, `mutation { updateNote(id: "`+id+`", input: {title: ""}) { id } }`)
+	if e := invalid["errors"].([]any)[0].(map[string]any); dig(e, "extensions", "code") != "BAD_USER_INPUT" || dig(e, "extensions", "fields") == nil {
+		t.Errorf("invalid update = %v", invalid)
+	}
+	if del := gql(t, srv, token, `mutation { deleteNote(id: "`+id+`") }`); dig(del, "data", "deleteNote") != id {
+		t.Errorf("deleteNote = %v", del)
+	}
+	if missing := gql(t, srv, token, `{ note(id: "`+id+`") { id } }`); dig(missing, "data", "note") != nil || missing["errors"] != nil {
+		t.Errorf("deleted note = %v", missing)
+	}
+}
+
+func TestGraphQLAuthAndLimits(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "gql-limits")
+
+	anon := gql(t, srv, "", `{ me { id } stats { total } }`)
+	if errs := anon["errors"].([]any); len(errs) != 2 || dig(errs[0].(map[string]any), "extensions", "code") != "UNAUTHENTICATED" {
+		t.Errorf("anonymous query = %v", anon)
+	}
+	if bad := gql(t, srv, "not-a-token", `{ me { id } }`); bad["status"] != float64(http.StatusUnauthorized) {
+		t.Errorf("bad token = %v", bad)
+	}
+
+	deep := gql(t, srv, token, `{ notes { owner { notes { owner { notes { owner { notes { owner { notes { owner { id } } } } } } } } } } }`)
+	if e := deep["errors"].([]any)[0].(map[string]any); !strings.Contains(e["message"].(string), "depth") {
+		t.Errorf("deep query = %v", deep)
+	}
+	wide := gql(t, srv, token, `{ notes(first: 500) { owner { notes(first: 500) { id } } } }`)
+	if e := wide["errors"].([]any)[0].(map[string]any); !strings.Contains(e["message"].(string), "complexity") {
+		t.Errorf("expensive query = %v", wide)
+	}
+}
+
+// wsClient is just enough of a WebSocket client for graphql-transport-ws.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialGraphQL(t *testing.T, srv *httptest.Server) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	io.WriteString(conn, "GET /graphql HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: graphql-transport-ws\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Protocol") != "graphql-transport-ws" {
+		t.Fatalf("handshake: %s %v", resp.Status, resp.Header)
+	}
+	return &wsClient{conn: conn, br: br}
+}
+
+func (c *wsClient) send(msg string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x81, 0x80 | 126, byte(len(msg) >> 8), byte(len(msg))}
+	frame = append(frame, mask...)
+	for i := range len(msg) {
+		frame = append(frame, msg[i]^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+// next returns the next text message as JSON, skipping pings.
+func (c *wsClient) next(t *testing.T) map[string]any {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(c.br, h[:]); err != nil {
+			t.Fatal(err)
+		}
+		n := int(h[1] & 0x7F)
+		if n == 126 {
+			var b [2]byte
+			io.ReadFull(c.br, b[:])
+			n = int(b[0])<<8 | int(b[1])
+		}
+		p := make([]byte, n)
+		io.ReadFull(c.br, p)
+		if h[0]&0x0F == 1 {
+			var m map[string]any
+			json.Unmarshal(p, &m)
+			return m
+		}
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "gql-sub")
+
+	c := dialGraphQL(t, srv)
+	c.send(`{"type":"connection_init","payload":{"Authorization":"Bearer ` + token + `"}}`)
+	if m := c.next(t); m["type"] != "connection_ack" {
+		t.Fatalf("init reply = %v", m)
+	}
+	c.send(`{"id":"1","type":"subscribe","payload":{"query":"subscription { noteChanged { type fields note { title } } }"}}`)
+	c.send(`{"id":"2","type":"subscribe","payload":{"query":"{ me { username } }"}}`)
+	if m := c.next(t); m["id"] != "2" || dig(m, "payload", "data", "me", "username") != "gql-sub" {
+		t.Fatalf("query over WebSocket = %v", m)
+	}
+	if m := c.next(t); m["id"] != "2" || m["type"] != "complete" {
+		t.Fatalf("query completion = %v", m)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); bus.Subscribers() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	call(t, srv, token, "POST", "/v1/notes", `{"title":"live"}`)
+	m := c.next(t)
+	if m["id"] != "1" || m["type"] != "next" || dig(m, "payload", "data", "noteChanged", "type") != "CREATED" ||
+		dig(m, "payload", "data", "noteChanged", "note", "title") != "live" {
+		t.Fatalf("event = %v", m)
+	}
+
+	c.send(`{"id":"1","type":"complete"}`)
+	c.send(`{"type":"ping"}`)
+	if m := c.next(t); m["type"] != "pong" {
+		t.Errorf("ping reply = %v", m)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"goproject/internal/auth"
+	"goproject/internal/events"
+	"goproject/internal/grpc"
+	"goproject/internal/notes"
+	"goproject/internal/validation"
+	notesv1 "goproject/proto/notes/v1"
+)
+
+// grpcConfig enables the gRPC API of proto/notes/v1/notes.proto on a
+// listener of its own. It shares the TLS settings of the HTTP server, which
+// it requires: net/http speaks HTTP/2 only over TLS.
+type grpcConfig struct {
+	Addr string `json:"addr"` // empty disables gRPC
+}
+
+func (c grpcConfig) validate(tls tlsConfig) error {
+	if c.Addr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return fmt.Errorf("grpc.addr: %w", err)
+	}
+	if !tls.enabled() {
+		return errors.New("grpc.addr: requires TLS to be enabled")
+	}
+	return nil
+}
+
+// grpcPublic lists the methods callable without a token.
+var grpcPublic = map[string]bool{
+	notesv1.AuthRegister: true,
+	notesv1.AuthLogin:    true,
+}
+
+func newGRPCServer() *grpc.Server {
+	s := grpc.NewServer()
+	s.Unary = func(ctx context.Context, req []byte, info *grpc.Info, next grpc.UnaryHandler) (resp []byte, err error) {
+		defer grpcRecover(ctx, info, &err)
+		return grpcUnaryAuth(ctx, req, info, next)
+	}
+	s.Stream = func(req []byte, ss grpc.Stream, info *grpc.Info, next grpc.StreamHandler) (err error) {
+		defer grpcRecover(ss.Context(), info, &err)
+		return grpcStreamAuth(req, ss, info, next)
+	}
+
+	s.HandleUnary(notesv1.AuthRegister, grpcRegister)
+	s.HandleUnary(notesv1.AuthLogin, grpcLogin)
+	s.HandleUnary(notesv1.NotesList, grpcListNotes)
+	s.HandleUnary(notesv1.NotesGet, grpcGetNote)
+	s.HandleUnary(notesv1.NotesCreate, grpcCreateNote)
+	s.HandleUnary(notesv1.NotesUpdate, grpcUpdateNote)
+	s.HandleUnary(notesv1.NotesDelete, grpcDeleteNote)
+	s.HandleUnary(notesv1.NotesMove, grpcMoveNote)
+	s.HandleStream(notesv1.NotesWatch, grpcWatchNotes)
+	return s
+}
+
+// ─── auth interceptors ────────────────────────────────────────────────────────
+
+// grpcClaims validates the bearer token in the "authorization" metadata,
+// as withAuth does for the Authorization header.
+func grpcClaims(ctx context.Context) (context.Context, error) {
+	header := grpc.MetadataFromContext(ctx).Get("authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		authResult("token", false)
+		return nil, grpc.Errorf(grpc.Unauthenticated, "missing bearer token")
+	}
+	claims, err := tokens.ValidateToken(ctx, token)
+	if err == nil {
+		err = users.Check(ctx, claims)
+	}
+	authResult("token", err == nil)
+	if err != nil {
+		return nil, grpc.Errorf(grpc.Unauthenticated, "unauthorized")
+	}
+	infoFrom(ctx).userID = claims.UserID
+	return context.WithValue(ctx, claimsKey, claims), nil
+}
+
+func grpcUnaryAuth(ctx context.Context, req []byte, info *grpc.Info, next grpc.UnaryHandler) ([]byte, error) {
+	if grpcPublic[info.FullMethod] {
+		return next(ctx, req)
+	}
+	ctx, err := grpcClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
+
+func grpcStreamAuth(req []byte, s grpc.Stream, info *grpc.Info, next grpc.StreamHandler) error {
+	ctx, err := grpcClaims(s.Context())
+	if err != nil {
+		return err
+	}
+	return next(req, grpc.WithContext(s, ctx))
+}
+
+// grpcRecover, deferred by the interceptors, turns a panic in a call into
+// INTERNAL, which the server sends in the trailers like any other status.
+// withRecover would answer with a JSON 500 that gRPC clients cannot read.
+func grpcRecover(ctx context.Context, info *grpc.Info, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	loggerFrom(ctx).Error("panic",
+		"method", info.FullMethod,
+		"panic", v,
+		"stack", string(debug.Stack()),
+	)
+	*err = grpc.Errorf(grpc.Internal, "internal error")
+}
+
+// ─── messages ─────────────────────────────────────────────────────────────────
+
+var grpcPriorities = map[notes.Priority]notesv1.Priority{
+	notes.PriorityLow:    notesv1.PriorityLow,
+	notes.PriorityMedium: notesv1.PriorityMedium,
+	notes.PriorityHigh:   notesv1.PriorityHigh,
+}
+
+// priorityOf maps a request priority; unspecified becomes "" so that the
+// store applies its default.
+func priorityOf(p notesv1.Priority) (notes.Priority, error) {
+	if p == notesv1.PriorityUnspecified {
+		return "", nil
+	}
+	for k, v := range grpcPriorities {
+		if v == p {
+			return k, nil
+		}
+	}
+	return "", grpc.Errorf(grpc.InvalidArgument, "priority: unknown value %d", p)
+}
+
+func newNotePB(n *notes.Note) *notesv1.Note {
+	return &notesv1.Note{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Title:     n.Title,
+		Body:      n.Body,
+		Done:      n.Done,
+		Priority:  grpcPriorities[n.Priority],
+		Tags:      n.Tags,
+		Pinned:    n.Pinned,
+		Position:  n.Position,
+		Version:   int64(n.Version),
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+}
+
+// grpcNoteError maps store errors to status codes.
+func grpcNoteError(err error) error {
+	var verr *validation.Error
+	switch {
+	case err == notes.ErrNotFound:
+		return grpc.Errorf(grpc.NotFound, "note not found")
+	case err == notes.ErrForbidden:
+		return grpc.Errorf(grpc.PermissionDenied, "access denied")
+	case err == notes.ErrInvalidMove:
+		return grpc.Errorf(grpc.InvalidArgument, "exactly one of before or after must name another note")
+	case errors.As(err, &verr):
+		return grpc.Errorf(grpc.InvalidArgument, "%s", verr.Error())
+	}
+	return err
+}
+
+// decode unmarshals a request message.
+func decode(req []byte, m interface{ Unmarshal([]byte) error }) error {
+	if err := m.Unmarshal(req); err != nil {
+		return grpc.Errorf(grpc.InvalidArgument, "malformed request: %v", err)
+	}
+	return nil
+}
+
+func grpcUser(ctx context.Context) *auth.Claims {
+	return ctx.Value(claimsKey).(*auth.Claims)
+}
+
+// ─── AuthService ──────────────────────────────────────────────────────────────
+
+// grpcThrottle applies the per-IP and per-username limits of throttleAuth.
+func grpcThrottle(ctx context.Context, username string) error {
+	ip := grpc.PeerFromContext(ctx)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if ok, _ := limits.perIP.Allow(ip); !ok {
+		return grpc.Errorf(grpc.ResourceExhausted, "too many requests, retry later")
+	}
+	if username != "" {
+		if ok, _ := limits.perUsername.Allow(strings.ToLower(username)); !ok {
+			return grpc.Errorf(grpc.ResourceExhausted, "too many requests, retry later")
+		}
+	}
+	return nil
+}
+
+func authResponsePB(ctx context.Context, user *auth.User) ([]byte, error) {
+	token, err := tokens.CreateToken(ctx, user, cfg.Auth.TokenTTL.Duration)
+	if err != nil {
+		return nil, grpc.Errorf(grpc.Internal, "could not issue token")
+	}
+	resp := &notesv1.AuthResponse{Token: token, User: &notesv1.User{ID: user.ID, Username: user.Username}}
+	return resp.Marshal(), nil
+}
+
+func grpcRegister(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.Credentials
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	if err := grpcThrottle(ctx, in.Username); err != nil {
+		return nil, err
+	}
+	if in.Username == "" || in.Password == "" {
+		return nil, grpc.Errorf(grpc.InvalidArgument, "username and password are required")
+	}
+	user, err := users.Register(ctx, in.Username, in.Password)
+	authResult("register", err == nil)
+	if err == auth.ErrUserExists {
+		return nil, grpc.Errorf(grpc.AlreadyExists, "username already taken")
+	}
+	if err != nil {
+		return nil, grpc.Errorf(grpc.Internal, "registration failed")
+	}
+	return authResponsePB(ctx, user)
+}
+
+// grpcLogin shares the lockouts of POST /v1/auth/login.
+func grpcLogin(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.Credentials
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	if err := grpcThrottle(ctx, in.Username); err != nil {
+		return nil, err
+	}
+	key := strings.ToLower(in.Username)
+	if locked, _ := limits.loginBackoff.Locked(key); locked {
+		return nil, grpc.Errorf(grpc.ResourceExhausted, "too many requests, retry later")
+	}
+	user, err := users.Login(ctx, in.Username, in.Password)
+	authResult("login", err == nil)
+	if err == auth.ErrWrongPassword || err == auth.ErrUserNotFound {
+		if wait := limits.loginBackoff.Fail(key); wait > 0 {
+			return nil, grpc.Errorf(grpc.ResourceExhausted, "too many requests, retry later")
+		}
+	}
+	if err == auth.ErrUserDisabled {
+		return nil, grpc.Errorf(grpc.PermissionDenied, "account disabled")
+	}
+	if err != nil {
+		return nil, grpc.Errorf(grpc.Unauthenticated, "invalid credentials")
+	}
+	limits.loginBackoff.Reset(key)
+	if user.TwoFactorEnabled() {
+		return nil, grpc.Errorf(grpc.FailedPrecondition, "account uses two-factor authentication; log in over /v1/auth/login")
+	}
+	return authResponsePB(ctx, user)
+}
+
+// ─── NotesService ─────────────────────────────────────────────────────────────
+
+func grpcListNotes(ctx context.Context, req []byte) ([]byte, error) {
+	list := store.List(ctx, grpcUser(ctx).UserID)
+	resp := &notesv1.ListNotesResponse{Notes: make([]*notesv1.Note, len(list))}
+	for i, n := range list {
+		resp.Notes[i] = newNotePB(n)
+	}
+	return resp.Marshal(), nil
+}
+
+func grpcGetNote(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.IDRequest
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	note, err := store.Get(ctx, grpcUser(ctx).UserID, in.ID)
+	if err != nil {
+		return nil, grpcNoteError(err)
+	}
+	return newNotePB(note).Marshal(), nil
+}
+
+func grpcCreateNote(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.CreateNoteRequest
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	priority, err := priorityOf(in.Priority)
+	if err != nil {
+		return nil, err
+	}
+	input := notes.CreateInput{Title: in.Title, Body: in.Body, Priority: priority, Tags: in.Tags, Pinned: in.Pinned}
+	if err := input.Validate(); err != nil {
+		return nil, grpcNoteError(err)
+	}
+	note := store.Create(ctx, grpcUser(ctx).UserID, input)
+	return newNotePB(note).Marshal(), nil
+}
+
+func grpcUpdateNote(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.UpdateNoteRequest
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	input := notes.UpdateInput{Title: in.Title, Body: in.Body, Done: in.Done, Pinned: in.Pinned}
+	if in.Priority != nil {
+		p, err := priorityOf(*in.Priority)
+		if err != nil || p == "" {
+			return nil, grpc.Errorf(grpc.InvalidArgument, "priority: must be low, medium or high")
+		}
+		input.Priority = &p
+	}
+	if in.Tags != nil {
+		input.Tags = append([]string{}, *in.Tags...)
+	}
+	if err := input.Validate(); err != nil {
+		return nil, grpcNoteError(err)
+	}
+	note, err := store.Update(ctx, grpcUser(ctx).UserID, in.ID, input)
+	if err != nil {
+		return nil, grpcNoteError(err)
+	}
+	return newNotePB(note).Marshal(), nil
+}
+
+func grpcDeleteNote(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.IDRequest
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	err := store.Delete(ctx, grpcUser(ctx).UserID, in.ID)
+	if err != nil {
+		return nil, grpcNoteError(err)
+	}
+	return nil, nil
+}
+
+func grpcMoveNote(ctx context.Context, req []byte) ([]byte, error) {
+	var in notesv1.MoveNoteRequest
+	if err := decode(req, &in); err != nil {
+		return nil, err
+	}
+	note, err := store.Move(ctx, grpcUser(ctx).UserID, in.ID, notes.MoveInput{Before: in.Before, After: in.After})
+	if err != nil {
+		return nil, grpcNoteError(err)
+	}
+	return newNotePB(note).Marshal(), nil
+}
+
+// grpcWatchNotes is GET /v1/events as a server stream. A client that falls
+// behind is ended with RESOURCE_EXHAUSTED, and every stream with
+// UNAVAILABLE when the server shuts down; both may resume from the last
+// event ID they saw.
+func grpcWatchNotes(req []byte, s grpc.Stream) error {
+	var in notesv1.WatchNotesRequest
+	if err := decode(req, &in); err != nil {
+		return err
+	}
+	sub, missed := bus.Subscribe(grpcUser(s.Context()).UserID, in.AfterEventID)
+	defer sub.Close()
+
+	if missed {
+		if err := s.Send((&notesv1.NoteEvent{Type: "reset"}).Marshal()); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				if sub.Err() == events.ErrSlowConsumer {
+					return grpc.Errorf(grpc.ResourceExhausted, "watcher fell behind")
+				}
+				return grpc.Errorf(grpc.Unavailable, "server shutting down")
+			}
+			if err := s.Send(noteEventPB(ev).Marshal()); err != nil {
+				return err
+			}
+		case <-s.Context().Done():
+			return s.Context().Err()
+		}
+	}
+}
+
+func noteEventPB(ev events.Event) *notesv1.NoteEvent {
+	c := ev.Data.(notes.Change)
+	out := &notesv1.NoteEvent{ID: ev.ID, Type: ev.Type, NoteID: c.Note.ID, Version: int64(c.Note.Version)}
+	if c.Type != notes.ChangeDeleted {
+		out.Note = newNotePB(&c.Note)
+	}
+	return out
+}
+
+// newGRPCHandler wraps the gRPC server in the middleware of the HTTP API,
+// so calls get request IDs, spans, access log lines, metrics and panic
+// recovery. Registered methods are reported as the route "POST <method>".
+func newGRPCHandler() http.Handler {
+	srv := newGRPCServer()
+	methods := make(map[string]bool)
+	for _, m := range srv.Methods() {
+		methods[m] = true
+	}
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if methods[r.URL.Path] {
+			infoFrom(r.Context()).route = "POST " + r.URL.Path
+		}
+		srv.ServeHTTP(w, r)
+	})
+	// No withRecover: the interceptors recover, see grpcRecover.
+	return chain(routed,
+		withRequestID,
+		withTracing,
+		withLogging(logger),
+		withMetrics,
+	)
+}
+
+// newGRPCHTTPServer serves h at addr. Streams are long-lived, so there
+// is no write timeout.
+func newGRPCHTTPServer(addr string, h http.Handler, c httpConfig) *http.Server {
+	hs := newHTTPServer(addr, h, c)
+	hs.ReadTimeout = 0
+	hs.WriteTimeout = 0
+	return hs
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/grpc"
+	"goproject/internal/trace"
+	notesv1 "goproject/proto/notes/v1"
+)
+
+type grpcClient struct {
+	t     *testing.T
+	srv   *httptest.Server
+	token string
+}
+
+func newGRPCTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	if tokens.TokenManager == nil {
+		tokens = tracedTokens{auth.NewTokenManager("events-test-secret")}
+	}
+	srv := httptest.NewUnstartedServer(newGRPCHandler())
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (c *grpcClient) metadata() grpc.Metadata {
+	if c.token == "" {
+		return nil
+	}
+	return grpc.Metadata{"authorization": {"Bearer " + c.token}}
+}
+
+func (c *grpcClient) invoke(method string, req []byte) ([]byte, error) {
+	return grpc.Invoke(context.Background(), c.srv.Client(), c.srv.URL, method, c.metadata(), req)
+}
+
+func TestGRPCAuthAndNotes(t *testing.T) {
+	srv := newGRPCTestServer(t)
+	c := &grpcClient{t: t, srv: srv}
+
+	_, err := c.invoke(notesv1.NotesList, nil)
+	if st := grpc.StatusOf(err); st.Code != grpc.Unauthenticated {
+		t.Fatalf("ListNotes without token: %+v", st)
+	}
+
+	creds := (&notesv1.Credentials{Username: "grpc-alice", Password: "secret123"}).Marshal()
+	if _, err := c.invoke(notesv1.AuthRegister, creds); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.invoke(notesv1.AuthRegister, creds)
+	if st := grpc.StatusOf(err); st.Code != grpc.AlreadyExists {
+		t.Errorf("duplicate Register: %+v", st)
+	}
+	resp, err := c.invoke(notesv1.AuthLogin, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var auth notesv1.AuthResponse
+	if err := auth.Unmarshal(resp); err != nil || auth.Token == "" || auth.User.Username != "grpc-alice" {
+		t.Fatalf("Login = %+v, %v", auth, err)
+	}
+	c.token = auth.Token
+
+	resp, err = c.invoke(notesv1.NotesCreate, (&notesv1.CreateNoteRequest{Title: "Hello", Priority: notesv1.PriorityHigh, Tags: []string{"a"}}).Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var note notesv1.Note
+	note.Unmarshal(resp)
+	if note.Title != "Hello" || note.Priority != notesv1.PriorityHigh || note.Version != 1 || note.CreatedAt.IsZero() {
+		t.Errorf("CreateNote = %+v", note)
+	}
+
+	_, err = c.invoke(notesv1.NotesCreate, (&notesv1.CreateNoteRequest{Title: " "}).Marshal())
+	if st := grpc.StatusOf(err); st.Code != grpc.InvalidArgument {
+		t.Errorf("CreateNote with blank title: %+v", st)
+	}
+
+	done, tags := true, []string{}
+	resp, err = c.invoke(notesv1.NotesUpdate, (&notesv1.UpdateNoteRequest{ID: note.ID, Done: &done, Tags: &tags}).Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updated notesv1.Note
+	updated.Unmarshal(resp)
+	if !updated.Done || len(updated.Tags) != 0 || updated.Title != "Hello" {
+		t.Errorf("UpdateNote = %+v", updated)
+	}
+
+	resp, err = c.invoke(notesv1.NotesList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list notesv1.ListNotesResponse
+	list.Unmarshal(resp)
+	if len(list.Notes) != 1 || list.Notes[0].ID != note.ID {
+		t.Errorf("ListNotes = %+v", list.Notes)
+	}
+
+	bob := &grpcClient{t: t, srv: srv, token: registerToken(t, newTestServer(t), "grpc-bob")}
+	_, err = bob.invoke(notesv1.NotesGet, (&notesv1.IDRequest{ID: note.ID}).Marshal())
+	if st := grpc.StatusOf(err); st.Code != grpc.PermissionDenied {
+		t.Errorf("GetNote of another user's note: %+v", st)
+	}
+
+	if _, err := c.invoke(notesv1.NotesDelete, (&notesv1.IDRequest{ID: note.ID}).Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.invoke(notesv1.NotesGet, (&notesv1.IDRequest{ID: note.ID}).Marshal())
+	if st := grpc.StatusOf(err); st.Code != grpc.NotFound {
+		t.Errorf("GetNote after delete: %+v", st)
+	}
+}
+
+func TestGRPCWatchNotes(t *testing.T) {
+	srv := newGRPCTestServer(t)
+	c := &grpcClient{t: t, srv: srv, token: registerToken(t, newTestServer(t), "grpc-watcher")}
+
+	// Write before watching, and resume from before the write, so the test
+	// does not race the subscription.
+	resp, err := c.invoke(notesv1.NotesCreate, (&notesv1.CreateNoteRequest{Title: "Watched"}).Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var note notesv1.Note
+	note.Unmarshal(resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := grpc.NewStream(ctx, srv.Client(), srv.URL, notesv1.NotesWatch, c.metadata(), (&notesv1.WatchNotesRequest{AfterEventID: 1}).Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var ev notesv1.NoteEvent
+	for ev.NoteID != note.ID {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev = notesv1.NoteEvent{}
+		if err := ev.Unmarshal(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ev.Type != "created" || ev.ID == 0 || ev.Note == nil || ev.Note.Title != "Watched" {
+		t.Errorf("event = %+v", ev)
+	}
+
+	_, err = grpc.Invoke(ctx, srv.Client(), srv.URL, notesv1.NotesWatch, nil, nil)
+	if st := grpc.StatusOf(err); st.Code != grpc.Unauthenticated {
+		t.Errorf("WatchNotes without token: %+v", st)
+	}
+}
+
+func TestGRPCMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	savedLogger, savedTracer := logger, tracer
+	exp := &memExporter{}
+	logger, tracer = slog.New(slog.NewJSONHandler(&buf, nil)), trace.NewTracer("notes-test", 1, exp)
+	t.Cleanup(func() { logger, tracer = savedLogger, savedTracer })
+	token := registerToken(t, newTestServer(t), "grpc-logged")
+	buf.Reset()
+
+	srv := newGRPCTestServer(t)
+	c := &grpcClient{t: t, srv: srv, token: token}
+	if _, err := c.invoke(notesv1.NotesList, nil); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close() // waits for the handler, and so for the log line and span
+	tracer.Shutdown(context.Background())
+
+	lines := logLines(t, &buf)
+	got := lines[len(lines)-1]
+	if got["msg"] != "request" || got["route"] != "POST "+notesv1.NotesList || got["user_id"] == "" || got["request_id"] == "" {
+		t.Errorf("access log = %v", got)
+	}
+	if !strings.Contains(exp.spans.String(), `"name":"POST `+notesv1.NotesList+`"`) {
+		t.Errorf("no server span for the call in %s", exp.spans.String())
+	}
+}
+
+func TestGRPCPanicIsInternal(t *testing.T) {
+	var buf bytes.Buffer
+	savedLogger, savedUsers := logger, users
+	logger, users = slog.New(slog.NewJSONHandler(&buf, nil)), tracedUsers{} // Register panics on the nil store
+	t.Cleanup(func() { logger, users = savedLogger, savedUsers })
+
+	srv := newGRPCTestServer(t)
+	c := &grpcClient{t: t, srv: srv}
+	creds := (&notesv1.Credentials{Username: "grpc-panic", Password: "secret123"}).Marshal()
+	_, err := c.invoke(notesv1.AuthRegister, creds)
+	if st := grpc.StatusOf(err); st.Code != grpc.Internal || st.Message != "internal error" {
+		t.Errorf("Register that panics: %+v", st)
+	}
+	srv.Close()
+
+	var logged bool
+	for _, line := range logLines(t, &buf) {
+		logged = logged || line["msg"] == "panic" && line["method"] == notesv1.AuthRegister && line["request_id"] != nil
+	}
+	if !logged {
+		t.Errorf("panic not logged: %s", buf.String())
+	}
+}
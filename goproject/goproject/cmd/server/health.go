@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"goproject/internal/health"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+var (
+	checks    = health.NewRegistry()
+	startedAt = time.Now()
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: version, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.time":
+				b.BuildTime = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	return b
+}
+
+// registerHealthChecks registers the checks for the stores, the event bus
+// and the webhook dispatcher, and for OIDC discovery when it is configured.
+// Each in-memory check takes its component's lock, so one that is wedged or
+// heavily contended shows up as a timeout.
+func registerHealthChecks() {
+	checks.Register("notes_store", 2*time.Second, func(context.Context) error {
+		store.CountByUser()
+		return nil
+	})
+	checks.Register("user_store", 2*time.Second, func(context.Context) error {
+		users.Count()
+		return nil
+	})
+	checks.Register("event_bus", 2*time.Second, func(context.Context) error {
+		return bus.Err()
+	})
+	checks.Register("webhooks", 2*time.Second, func(context.Context) error {
+		return webhooks.Err()
+	})
+	if cfg.OIDC.Issuer != "" {
+		// Discovery happens once and is then cached, so this fails only
+		// until the provider has been reached.
+		checks.Register("oidc_discovery", 5*time.Second, func(ctx context.Context) error {
+			_, err := oidcProvider(ctx)
+			return err
+		})
+	}
+}
+
+type healthResponse struct {
+	health.Report
+	Build  buildInfo `json:"build"`
+	Uptime string    `json:"uptime"`
+	Time   string    `json:"time"`
+}
+
+func newHealthResponse(report health.Report) healthResponse {
+	if report.Checks == nil {
+		report.Checks = []health.Result{}
+	}
+	return healthResponse{
+		Report: report,
+		Build:  readBuildInfo(),
+		Uptime: time.Since(startedAt).Round(time.Second).String(),
+		Time:   time.Now().Format(time.RFC3339),
+	}
+}
+
+// handleLivez reports that the process is up and serving. It runs no checks,
+// so a failing dependency never gets the process restarted.
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newHealthResponse(health.Report{Status: health.StatusOK}))
+}
+
+// handleReadyz runs every registered check and fails while the server is
+// draining for shutdown, so load balancers stop sending new traffic.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, newHealthResponse(health.Report{Status: "draining"}))
+		return
+	}
+	report := checks.Run(r.Context())
+	code := http.StatusOK
+	if report.Status != health.StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, newHealthResponse(report))
+}
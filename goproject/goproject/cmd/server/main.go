@@ -3,21 +3,30 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
-	"time"
+	_ "time/tzdata" // profile timezones validate without system zoneinfo
 
 	"goproject/internal/auth"
 	"goproject/internal/notes"
+	"goproject/internal/trace"
+	"goproject/internal/validation"
 )
 
+// Shared state. main replaces the defaults below once the config is loaded.
 var (
-	users  = auth.NewUserStore()
-	store  = notes.NewStore()
-	tokens = auth.NewTokenManager("super-secret-change-me")
+	cfg    = defaultConfig()
+	users  = tracedUsers{auth.NewUserStore()}
+	store  = tracedNotes{notes.NewStore()}
+	tokens tracedTokens
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	limits = newAuthLimits(cfg.RateLimit)
 )
 
 // ─── helpers ──────────────────────────────────────────────────────────────────
@@ -25,15 +34,48 @@ var (
 func writeJSON(w http.ResponseWriter, code int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(v)
+	encodeJSON(w, v)
 }
 
-func readJSON(r *http.Request, v any) error {
-	return json.NewDecoder(r.Body).Decode(v)
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	return json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBody)).Decode(v)
 }
 
+// errJSON writes an RFC 7807 problem with msg as its detail.
 func errJSON(w http.ResponseWriter, code int, msg string) {
-	writeJSON(w, code, map[string]string{"error": msg})
+	writeProblem(w, problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+		Detail: msg,
+	})
+}
+
+// errInput reports a request body that could not be decoded or validated.
+// Validation errors are listed field by field.
+func errInput(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		errJSON(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	var verr *validation.Error
+	if errors.As(err, &verr) {
+		writeProblem(w, problem{
+			Type:   problemValidation,
+			Title:  "Validation failed",
+			Status: http.StatusUnprocessableEntity,
+			Detail: "one or more fields are invalid",
+			Errors: verr.Fields,
+		})
+		return
+	}
+	writeProblem(w, problem{
+		Type:   problemMalformed,
+		Title:  "Malformed request body",
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	})
 }
 
 func getUser(r *http.Request) (*auth.Claims, bool) {
@@ -41,25 +83,79 @@ func getUser(r *http.Request) (*auth.Claims, bool) {
 	if !strings.HasPrefix(header, "Bearer ") {
 		return nil, false
 	}
-	claims, err := tokens.ValidateToken(strings.TrimPrefix(header, "Bearer "))
+	claims, err := tokens.ValidateToken(r.Context(), strings.TrimPrefix(header, "Bearer "))
+	if err == nil {
+		err = users.Check(r.Context(), claims)
+	}
 	if err != nil {
 		return nil, false
 	}
 	return claims, true
 }
 
+// getKeyUser authenticates an API key sent as a bearer token.
+func getKeyUser(r *http.Request) (*auth.Claims, bool) {
+	k, err := apiKeys.Authenticate(r.Context(), strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if err != nil {
+		return nil, false
+	}
+	user, err := users.Get(r.Context(), k.UserID)
+	if err != nil || user.Disabled {
+		return nil, false
+	}
+	return k.Claims(&user), true
+}
+
+// withAuth requires a bearer token. API keys are refused; see withScope.
 func withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return withScope("", next)
+}
+
+// withScope requires a bearer token, or an API key that grants scope.
+func withScope(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := getUser(r)
+		ctx, span := tracer.Start(r.Context(), "withAuth", trace.KindInternal)
+		var claims *auth.Claims
+		var ok bool
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "+auth.APIKeyPrefix) {
+			claims, ok = getKeyUser(r.WithContext(ctx))
+			authResult("api_key", ok)
+		} else {
+			claims, ok = getUser(r.WithContext(ctx))
+			authResult("token", ok)
+		}
+		span.SetAttr("auth.ok", ok)
+		span.End()
 		if !ok {
 			errJSON(w, http.StatusUnauthorized, "unauthorized")
 			return
 		}
-		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		if !claims.HasScope(scope) {
+			if scope == "" {
+				errJSON(w, http.StatusForbidden, "API keys cannot be used for this endpoint; use a token")
+			} else {
+				errJSON(w, http.StatusForbidden, "API key lacks the "+string(scope)+" scope")
+			}
+			return
+		}
+		infoFrom(r.Context()).userID = claims.UserID
+		ctx = context.WithValue(r.Context(), claimsKey, claims)
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// withRole is withAuth for endpoints that also require role.
+func withRole(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return withAuth(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(claimsKey).(*auth.Claims)
+		if !claims.HasRole(role) {
+			errJSON(w, http.StatusForbidden, "requires the "+string(role)+" role")
+			return
+		}
+		next(w, r)
+	})
+}
+
 // ─── context helpers ──────────────────────────────────────────────────────────
 
 type contextKey string
@@ -68,185 +164,123 @@ const claimsKey contextKey = "claims"
 
 // ─── handlers ─────────────────────────────────────────────────────────────────
 
-func handleRegister(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		errJSON(w, http.StatusMethodNotAllowed, "method not allowed")
-		return
-	}
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-	if err := readJSON(r, &body); err != nil {
-		errJSON(w, http.StatusBadRequest, "invalid JSON")
-		return
-	}
-	if body.Username == "" || body.Password == "" {
-		errJSON(w, http.StatusBadRequest, "username and password required")
-		return
-	}
+// ─── main ─────────────────────────────────────────────────────────────────────
 
-	user, err := users.Register(body.Username, body.Password)
-	if err == auth.ErrUserExists {
-		errJSON(w, http.StatusConflict, "username already taken")
+func main() {
+	var printConfig bool
+	var err error
+	cfg, printConfig, err = loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
 		return
 	}
 	if err != nil {
-		errJSON(w, http.StatusInternalServerError, "registration failed")
-		return
+		log.Fatal(err)
 	}
-
-	token, _ := tokens.CreateToken(user, 24*time.Hour)
-	writeJSON(w, http.StatusCreated, map[string]any{
-		"message": "registered successfully",
-		"token":   token,
-		"user":    map[string]string{"id": user.ID, "username": user.Username},
-	})
-}
-
-func handleLogin(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		errJSON(w, http.StatusMethodNotAllowed, "method not allowed")
-		return
-	}
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
 	}
-	if err := readJSON(r, &body); err != nil {
-		errJSON(w, http.StatusBadRequest, "invalid JSON")
+	if printConfig {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(cfg.redacted())
 		return
 	}
 
-	user, err := users.Login(body.Username, body.Password)
-	if err != nil {
-		errJSON(w, http.StatusUnauthorized, "invalid credentials")
-		return
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.slogLevel()}))
+	tokens = tracedTokens{auth.NewTokenManager(cfg.Auth.TokenSecret)}
+	limits = newAuthLimits(cfg.RateLimit)
+	bus = newBus(cfg.Events)
+	webhooks = tracedWebhooks{newWebhookDispatcher(cfg.Webhooks)}
+	gqlSchema = newGraphQLSchema(cfg.GraphQL)
+	if err := bootstrapAdmin(cfg.Auth); err != nil {
+		log.Fatal(err)
 	}
-
-	token, _ := tokens.CreateToken(user, 24*time.Hour)
-	writeJSON(w, http.StatusOK, map[string]any{
-		"token": token,
-		"user":  map[string]string{"id": user.ID, "username": user.Username},
-	})
-}
-
-func handleNotes(w http.ResponseWriter, r *http.Request) {
-	claims := r.Context().Value(claimsKey).(*auth.Claims)
-
-	switch r.Method {
-	case http.MethodGet:
-		noteList := store.List(claims.UserID)
-		if noteList == nil {
-			noteList = []*notes.Note{}
-		}
-		writeJSON(w, http.StatusOK, map[string]any{"notes": noteList, "count": len(noteList)})
-
-	case http.MethodPost:
-		var input notes.CreateInput
-		if err := readJSON(r, &input); err != nil {
-			errJSON(w, http.StatusBadRequest, "invalid JSON")
-			return
+	if tracer, err = newTracer(cfg.Tracing); err != nil {
+		log.Fatal(err)
+	}
+	registerHealthChecks()
+
+	handler := chain(newRouter(),
+		withRequestID,
+		withTracing,
+		withLogging(logger),
+		withMetrics,
+		withRecover(logger),
+		withCORS(cfg.CORS),
+	)
+
+	addr := cfg.Addr
+	srv := newHTTPServer(addr, handler, cfg.HTTP)
+	srv.RegisterOnShutdown(bus.Close)
+	onShutdown(webhooks.Close)
+	listen := srv.ListenAndServe
+	scheme := "http"
+	if cfg.TLS.enabled() {
+		tc, err := buildTLSConfig(cfg.TLS)
+		if err != nil {
+			log.Fatal(err)
 		}
-		if input.Title == "" {
-			errJSON(w, http.StatusBadRequest, "title is required")
-			return
+		srv.TLSConfig = tc
+		listen = func() error { return srv.ListenAndServeTLS("", "") }
+		scheme = "https"
+		if cfg.TLS.Dev {
+			logger.Warn("serving a self-signed development certificate")
 		}
-		note := store.Create(claims.UserID, input)
-		writeJSON(w, http.StatusCreated, note)
-
-	default:
-		errJSON(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
-}
-
-func handleNote(w http.ResponseWriter, r *http.Request) {
-	claims := r.Context().Value(claimsKey).(*auth.Claims)
-	noteID := strings.TrimPrefix(r.URL.Path, "/notes/")
-	if noteID == "" {
-		errJSON(w, http.StatusBadRequest, "note id required")
-		return
+	if cfg.TLS.RedirectAddr != "" {
+		redirect := newHTTPServer(cfg.TLS.RedirectAddr, redirectToHTTPS(addr), cfg.HTTP)
+		go func() {
+			if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("http redirect listener failed", "error", err)
+			}
+		}()
+		onShutdown(redirect.Shutdown)
 	}
-
-	switch r.Method {
-	case http.MethodGet:
-		note, err := store.Get(claims.UserID, noteID)
-		if err == notes.ErrNotFound {
-			errJSON(w, http.StatusNotFound, "note not found")
-			return
-		}
-		if err == notes.ErrForbidden {
-			errJSON(w, http.StatusForbidden, "access denied")
-			return
-		}
-		writeJSON(w, http.StatusOK, note)
-
-	case http.MethodPut:
-		var input notes.UpdateInput
-		if err := readJSON(r, &input); err != nil {
-			errJSON(w, http.StatusBadRequest, "invalid JSON")
-			return
-		}
-		note, err := store.Update(claims.UserID, noteID, input)
-		if err == notes.ErrNotFound {
-			errJSON(w, http.StatusNotFound, "note not found")
-			return
-		}
-		if err == notes.ErrForbidden {
-			errJSON(w, http.StatusForbidden, "access denied")
-			return
-		}
-		writeJSON(w, http.StatusOK, note)
-
-	case http.MethodDelete:
-		err := store.Delete(claims.UserID, noteID)
-		if err == notes.ErrNotFound {
-			errJSON(w, http.StatusNotFound, "note not found")
-			return
-		}
-		if err == notes.ErrForbidden {
-			errJSON(w, http.StatusForbidden, "access denied")
-			return
-		}
-		writeJSON(w, http.StatusOK, map[string]string{"message": "deleted"})
-
-	default:
-		errJSON(w, http.StatusMethodNotAllowed, "method not allowed")
+	if cfg.GRPC.Addr != "" {
+		grpcSrv := newGRPCHTTPServer(cfg.GRPC.Addr, newGRPCHandler(), cfg.HTTP)
+		grpcSrv.TLSConfig = srv.TLSConfig
+		grpcSrv.RegisterOnShutdown(bus.Close)
+		go func() {
+			if err := grpcSrv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				logger.Error("grpc listener failed", "error", err)
+			}
+		}()
+		onShutdown(grpcSrv.Shutdown)
 	}
-}
 
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "time": time.Now().Format(time.RFC3339)})
-}
-
-// ─── main ─────────────────────────────────────────────────────────────────────
-
-func main() {
-	port := flag.String("port", "8080", "Port to listen on")
-	flag.Parse()
-
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/health", handleHealth)
-	mux.HandleFunc("/auth/register", handleRegister)
-	mux.HandleFunc("/auth/login", handleLogin)
-	mux.HandleFunc("/notes", withAuth(handleNotes))
-	mux.HandleFunc("/notes/", withAuth(handleNote))
-
-	addr := fmt.Sprintf(":%s", *port)
-	fmt.Printf("🚀 Notes API running on http://localhost%s\n", addr)
+	fmt.Printf("🚀 Notes API running on %s://localhost%s\n", scheme, addr)
 	fmt.Println()
 	fmt.Println("Endpoints:")
-	fmt.Println("  POST   /auth/register  — create account")
-	fmt.Println("  POST   /auth/login     — get token")
-	fmt.Println("  GET    /notes          — list notes")
-	fmt.Println("  POST   /notes          — create note")
-	fmt.Println("  GET    /notes/:id      — get note")
-	fmt.Println("  PUT    /notes/:id      — update note")
-	fmt.Println("  DELETE /notes/:id      — delete note")
-	fmt.Println("  GET    /health         — health check")
+	fmt.Println("  POST   /v1/auth/register  — create account")
+	fmt.Println("  POST   /v1/auth/login     — get token (or a 2FA challenge for /v1/auth/login/2fa)")
+	fmt.Println("  GET    /v1/me             — your account (PUT profile, PUT /me/password, DELETE)")
+	fmt.Println("  GET    /v1/notes          — list notes")
+	fmt.Println("  POST   /v1/notes          — create note")
+	fmt.Println("  GET    /v1/notes/:id      — get note")
+	fmt.Println("  PUT    /v1/notes/:id      — replace note")
+	fmt.Println("  PATCH  /v1/notes/:id      — patch note (merge-patch or json-patch)")
+	fmt.Println("  DELETE /v1/notes/:id      — delete note")
+	fmt.Println("  POST   /v1/notes/:id/move — reorder note")
+	fmt.Println("  GET    /v1/events         — note changes (SSE or WebSocket)")
+	fmt.Println("  POST   /v1/api-keys       — create a scoped API key")
+	if cfg.OIDC.Issuer != "" {
+		fmt.Println("  GET    /v1/auth/oidc/login — log in with", cfg.OIDC.Issuer)
+	}
+	fmt.Println("  GET    /v1/admin/users    — manage users (admin role)")
+	fmt.Println("  POST   /graphql           — GraphQL (subscriptions over WebSocket)")
+	if cfg.GRPC.Addr != "" {
+		fmt.Printf("  gRPC   %-18s — NotesService and AuthService (proto/notes/v1)\n", cfg.GRPC.Addr)
+	}
+	fmt.Println("  GET    /livez             — liveness")
+	fmt.Println("  GET    /readyz            — readiness with dependency checks (/health is an alias)")
+	fmt.Println("  GET    /metrics           — Prometheus metrics")
+	fmt.Println("  GET    /openapi.json      — OpenAPI 3.1 document")
+	fmt.Println("  GET    /docs              — interactive API docs")
 	fmt.Println()
+	fmt.Println("Unversioned paths (/notes, /auth/...) are deprecated aliases of /v1.")
 	fmt.Println("Auth: Bearer token in Authorization header")
 
-	log.Fatal(http.ListenAndServe(addr, mux))
+	if err := run(srv, cfg.HTTP, listen); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/validation"
+)
+
+// ─── wire types ───────────────────────────────────────────────────────────────
+
+type meV1 struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Role        auth.Role `json:"role"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email"`
+	Timezone    string    `json:"timezone"`
+	TwoFactor   bool      `json:"two_factor"`
+	HasPassword bool      `json:"has_password"` // false for accounts made by an identity provider login
+	Notes       int       `json:"notes"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newMeV1(u *auth.User) meV1 {
+	return meV1{
+		ID:          u.ID,
+		Username:    u.Username,
+		Role:        u.Role,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Timezone:    u.Timezone,
+		TwoFactor:   u.TwoFactorEnabled(),
+		HasPassword: u.HasPassword(),
+		Notes:       store.CountByUser()[u.ID],
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+type profileInputV1 struct {
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Timezone    string `json:"timezone"`
+}
+
+type passwordChangeV1 struct {
+	CurrentPassword string `json:"current_password"` // required once the account has a password
+	NewPassword     string `json:"new_password"`
+}
+
+type accountDeletionV1 struct {
+	Confirm  string `json:"confirm"`  // the account's username
+	Password string `json:"password"` // required if the account has one
+}
+
+// ─── handlers ─────────────────────────────────────────────────────────────────
+
+// currentUser loads the account behind the request, or writes 401.
+func currentUser(w http.ResponseWriter, r *http.Request) (auth.User, bool) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	user, err := users.Get(r.Context(), claims.UserID)
+	if err != nil {
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+		return auth.User{}, false
+	}
+	return user, true
+}
+
+// checkPassword confirms a sensitive change with the account's password.
+// Wrong guesses count towards the login lockout of the account.
+func checkPassword(w http.ResponseWriter, r *http.Request, user auth.User, field, password string) bool {
+	key := strings.ToLower(user.Username)
+	if locked, wait := limits.loginBackoff.Locked(key); locked {
+		errTooManyRequests(w, wait)
+		return false
+	}
+	if password == "" {
+		errInput(w, validation.Field(field, "is required"))
+		return false
+	}
+	if users.CheckPassword(r.Context(), user.ID, password) != nil {
+		if wait := limits.loginBackoff.Fail(key); wait > 0 {
+			errTooManyRequests(w, wait)
+			return false
+		}
+		errJSON(w, http.StatusForbidden, "wrong password")
+		return false
+	}
+	limits.loginBackoff.Reset(key)
+	return true
+}
+
+func handleGetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newMeV1(&user))
+}
+
+// handleUpdateMe replaces the profile; omitted fields are cleared.
+func handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var body profileInputV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	user, err := users.SetProfile(r.Context(), claims.UserID, auth.Profile{
+		DisplayName: body.DisplayName,
+		Email:       body.Email,
+		Timezone:    body.Timezone,
+	})
+	field := map[error]string{auth.ErrDisplayName: "display_name", auth.ErrEmail: "email", auth.ErrTimezone: "timezone"}[err]
+	switch {
+	case field != "":
+		errInput(w, validation.Field(field, err.Error()))
+	case err == auth.ErrUserNotFound:
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+	case err != nil:
+		errJSON(w, http.StatusInternalServerError, "could not update profile")
+	default:
+		writeJSON(w, http.StatusOK, newMeV1(&user))
+	}
+}
+
+// handleChangePassword sets a new password and revokes every token,
+// including the one used here, and every API key, since whoever knew the
+// old password may have made some; the response carries a fresh token.
+func handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var body passwordChangeV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	if body.NewPassword == "" {
+		errInput(w, validation.Field("new_password", "is required"))
+		return
+	}
+	if user.HasPassword() && !checkPassword(w, r, user, "current_password", body.CurrentPassword) {
+		return
+	}
+
+	user, err := users.SetPassword(r.Context(), user.ID, body.NewPassword)
+	if err != nil {
+		errJSON(w, http.StatusInternalServerError, "could not change password")
+		return
+	}
+	apiKeys.DeleteUser(r.Context(), user.ID)
+	loggerFrom(r.Context()).Info("password changed", "user_id", user.ID)
+	token, _ := tokens.CreateToken(r.Context(), &user, cfg.Auth.TokenTTL.Duration)
+	writeJSON(w, http.StatusOK, authResponseV1{Message: "password changed", Token: token, User: newUserV1(&user)})
+}
+
+// handleDeleteMe deletes the account with its notes, webhooks and API keys.
+// Confirm must repeat the username, so a stray request cannot do it.
+func handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	var body accountDeletionV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	if body.Confirm != user.Username {
+		errInput(w, validation.Field("confirm", "must be your username"))
+		return
+	}
+	if user.HasPassword() && !checkPassword(w, r, user, "password", body.Password) {
+		return
+	}
+	n, err := deleteAccount(r.Context(), user.ID)
+	if err != nil {
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	loggerFrom(r.Context()).Info("account deleted by its owner", "user_id", user.ID)
+	writeJSON(w, http.StatusOK, messageV1{Message: fmt.Sprintf("deleted account and %d notes", n)})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAccountSelfService(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "self")
+	call(t, srv, token, "POST", "/v1/notes", `{"title":"mine"}`)
+	call(t, srv, token, "POST", "/v1/webhooks", `{"url":"https://example.com/hook","events":["note.deleted"]}`)
+	key, _ := call(t, srv, token, "POST", "/v1/api-keys", `{"name":"ci","scopes":["notes:read"]}`)["key"].(string)
+
+	me := call(t, srv, token, "GET", "/v1/me", "")
+	if me["username"] != "self" || me["notes"] != 1.0 || me["has_password"] != true {
+		t.Errorf("GET /me = %v", me)
+	}
+	id := me["id"].(string)
+	if got := call(t, srv, token, "PUT", "/v1/me", `{"timezone":"Nowhere/Else"}`); got["status"] != 422.0 {
+		t.Errorf("bad timezone = %v", got)
+	}
+	me = call(t, srv, token, "PUT", "/v1/me", `{"display_name":"Self","email":"self@example.com","timezone":"America/Denver"}`)
+	if me["display_name"] != "Self" || me["email"] != "self@example.com" || me["timezone"] != "America/Denver" {
+		t.Errorf("PUT /me = %v", me)
+	}
+
+	// Changing the password needs the old one and revokes old tokens and
+	// API keys.
+	if got := call(t, srv, token, "PUT", "/v1/me/password", `{"current_password":"nope","new_password":"better123"}`); got["status"] != 403.0 {
+		t.Errorf("wrong current password = %v", got)
+	}
+	changed := call(t, srv, token, "PUT", "/v1/me/password", `{"current_password":"secret123","new_password":"better123"}`)
+	fresh, _ := changed["token"].(string)
+	if fresh == "" {
+		t.Fatalf("change password = %v", changed)
+	}
+	if got := call(t, srv, token, "GET", "/v1/me", ""); got["status"] != 401.0 {
+		t.Errorf("old token after password change = %v", got)
+	}
+	if got := call(t, srv, key, "GET", "/v1/notes", ""); key == "" || got["status"] != 401.0 {
+		t.Errorf("API key after password change = %v", got)
+	}
+	if got := call(t, srv, "", "POST", "/v1/auth/login", `{"username":"self","password":"better123"}`); got["token"] == nil {
+		t.Errorf("login with the new password = %v", got)
+	}
+
+	// Deletion needs the username and password, then takes everything.
+	if got := call(t, srv, fresh, "DELETE", "/v1/me", `{"confirm":"someone","password":"better123"}`); got["status"] != 422.0 {
+		t.Errorf("unconfirmed delete = %v", got)
+	}
+	if got := call(t, srv, fresh, "DELETE", "/v1/me", `{"confirm":"self","password":"secret123"}`); got["status"] != 403.0 {
+		t.Errorf("delete with the old password = %v", got)
+	}
+	if got := call(t, srv, fresh, "DELETE", "/v1/me", `{"confirm":"self","password":"better123"}`); got["message"] != "deleted account and 1 notes" {
+		t.Fatalf("delete = %v", got)
+	}
+	if len(store.List(context.Background(), id)) != 0 || len(webhooks.List(context.Background(), id)) != 0 || len(apiKeys.List(context.Background(), id)) != 0 {
+		t.Error("data survived its account")
+	}
+	if got := call(t, srv, fresh, "GET", "/v1/me", ""); got["status"] != 401.0 {
+		t.Errorf("token of a deleted account = %v", got)
+	}
+}
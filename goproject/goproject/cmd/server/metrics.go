@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"goproject/internal/metrics"
+	"goproject/internal/notes"
+)
+
+// Server metrics, exposed at /metrics in the Prometheus text format.
+var (
+	registry = metrics.NewRegistry()
+
+	httpRequests = registry.NewCounter("http_requests_total",
+		"HTTP requests by route, method and status class.", "route", "method", "class")
+	httpDuration = registry.NewHistogram("http_request_duration_seconds",
+		"HTTP request latency by route and method.", metrics.DefaultBuckets, "route", "method")
+	httpInFlight = registry.NewGauge("http_requests_in_flight",
+		"HTTP requests currently being served.")
+
+	authAttempts = registry.NewCounter("auth_attempts_total",
+		"Authentication attempts by action (register, login, login_2fa, oidc, token, api_key, events_ticket) and result.", "action", "result")
+	noteOps = registry.NewCounter("notes_operations_total",
+		"Note writes by operation (created, updated, deleted).", "op")
+)
+
+func init() {
+	registry.NewGaugeFunc("notes_store_notes", "Notes currently stored, per user.", []string{"user_id"},
+		func(emit func(float64, ...string)) {
+			for user, n := range store.CountByUser() {
+				emit(float64(n), user)
+			}
+		})
+	registry.NewGaugeFunc("auth_users", "Registered users.", nil, func(emit func(float64, ...string)) {
+		emit(float64(users.Count()))
+	})
+	registry.NewGaugeFunc("events_subscribers", "Open GET /events streams.", nil, func(emit func(float64, ...string)) {
+		emit(float64(bus.Subscribers()))
+	})
+	metrics.RegisterRuntime(registry)
+
+	// Counted from the store, so every transport and cascade is included.
+	store.OnChange(func(c notes.Change) {
+		noteOps.Inc(c.Type)
+	})
+}
+
+func authResult(action string, ok bool) {
+	result := "failure"
+	if ok {
+		result = "success"
+	}
+	authAttempts.Inc(action, result)
+}
+
+// withMetrics records request counts and latency per route. It must run
+// outside the router, which fills in the route.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		route := infoFrom(r.Context()).route
+		if route == "" {
+			route = "unmatched"
+		}
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.Inc(route, r.Method, strconv.Itoa(status/100)+"xx")
+		httpDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// noteOpsCount scrapes notes_operations_total for op.
+func noteOpsCount(t *testing.T, op string) float64 {
+	t.Helper()
+	var b strings.Builder
+	registry.WriteTo(&b)
+	prefix := `notes_operations_total{op="` + op + `"} `
+	for _, line := range strings.Split(b.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, prefix); ok {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+func TestNoteOpsCountEveryWrite(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "counted")
+	created, deleted := noteOpsCount(t, "created"), noteOpsCount(t, "deleted")
+
+	call(t, srv, token, "POST", "/v1/sync", `{"mutations":[{"op":"create","client_id":"c1","fields":{"title":"offline"}}]}`)
+	call(t, srv, token, "POST", "/v1/notes", `{"title":"online"}`)
+	if got := noteOpsCount(t, "created") - created; got != 2 {
+		t.Errorf("created = %v, want 2", got)
+	}
+	call(t, srv, token, "DELETE", "/v1/me", `{"confirm":"counted","password":"secret123"}`)
+	if got := noteOpsCount(t, "deleted") - deleted; got != 2 {
+		t.Errorf("deleted = %v, want 2", got)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// middleware wraps a handler with cross-cutting behaviour.
+type middleware func(http.Handler) http.Handler
+
+// chain applies mws to h so that the first middleware is the outermost.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// ─── request IDs ──────────────────────────────────────────────────────────────
+
+const requestIDHeader = "X-Request-ID"
+
+const (
+	requestIDKey   contextKey = "request_id"
+	requestInfoKey contextKey = "request_info"
+)
+
+// requestInfo collects facts that are only known deeper in the stack, such
+// as the matched route and the authenticated user, so that outer middleware
+// (access log, metrics) can report them once the handler returns.
+type requestInfo struct {
+	route  string
+	userID string
+}
+
+func infoFrom(ctx context.Context) *requestInfo {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		return info
+	}
+	return &requestInfo{}
+}
+
+// withRequestID reuses a sane incoming X-Request-ID or generates one, echoes
+// it on the response and stores it in the request context along with an
+// empty requestInfo.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, requestInfoKey, &requestInfo{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// loggerFrom returns a logger tagged with the request and trace IDs, for
+// handlers that want to log something about the request they are serving.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	l := logger
+	if id := requestID(ctx); id != "" {
+		l = l.With("request_id", id)
+	}
+	if id := traceID(ctx); id != "" {
+		l = l.With("trace_id", id)
+	}
+	return l
+}
+
+// ─── access log ───────────────────────────────────────────────────────────────
+
+// statusWriter records the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter { return sw.ResponseWriter }
+
+// withLogging writes one structured log line per request.
+func withLogging(log *slog.Logger) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if sw.status >= 500 {
+				level = slog.LevelError
+			}
+			log.LogAttrs(r.Context(), level, "request",
+				slog.String("request_id", requestID(r.Context())),
+				slog.String("trace_id", traceID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", infoFrom(r.Context()).route),
+				slog.Int("status", sw.status),
+				slog.Int("bytes", sw.bytes),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("user_id", infoFrom(r.Context()).userID),
+				slog.String("remote", r.RemoteAddr),
+			)
+		})
+	}
+}
+
+// ─── panic recovery ───────────────────────────────────────────────────────────
+
+// withRecover turns a panicking handler into a logged stack trace and a JSON
+// 500, instead of a dropped connection.
+func withRecover(log *slog.Logger) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				log.Error("panic",
+					"request_id", requestID(r.Context()),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", v,
+					"stack", string(debug.Stack()),
+				)
+				if sw.status == 0 {
+					errJSON(w, http.StatusInternalServerError, "internal server error")
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+	}))
+
+	for incoming, keep := range map[string]bool{
+		"abc-123":                 true,
+		"":                        false,
+		"has space":               false,
+		strings.Repeat("x", 129):  false,
+		strings.Repeat("x", 128):  true,
+		"café":                    false,
+		"trace/7f3a:1;span=42,x!": true,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(requestIDHeader, incoming)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		echoed := rec.Header().Get(requestIDHeader)
+		if echoed != seen {
+			t.Errorf("%q: echoed %q, handler saw %q", incoming, echoed, seen)
+		}
+		if keep && echoed != incoming {
+			t.Errorf("%q: replaced by %q", incoming, echoed)
+		}
+		if !keep && !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(echoed) {
+			t.Errorf("%q: generated %q", incoming, echoed)
+		}
+	}
+}
+
+// logLines decodes the JSON log lines in buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := infoFrom(r.Context())
+		info.route, info.userID = "GET /v1/notes/{id}", "u-1"
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}), withRequestID, withLogging(log))
+
+	req := httptest.NewRequest("GET", "/v1/notes/42", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	req.RemoteAddr = "192.0.2.7:5555"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := logLines(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1", len(lines))
+	}
+	got := lines[0]
+	for k, want := range map[string]any{
+		"msg": "request", "level": "INFO", "request_id": "req-1", "method": "GET", "path": "/v1/notes/42",
+		"route": "GET /v1/notes/{id}", "status": 418.0, "bytes": 15.0, "user_id": "u-1", "remote": "192.0.2.7:5555",
+	} {
+		if got[k] != want {
+			t.Errorf("%s = %v, want %v", k, got[k], want)
+		}
+	}
+	if _, ok := got["latency"].(float64); !ok {
+		t.Errorf("latency = %v", got["latency"])
+	}
+
+	// Server errors are logged at error level.
+	buf.Reset()
+	chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}), withRequestID, withLogging(log)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := logLines(t, &buf)[0]; got["level"] != "ERROR" || got["status"] != 502.0 {
+		t.Errorf("5xx line = %v", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), withRequestID, withRecover(log))
+
+	req := httptest.NewRequest("GET", "/v1/notes", nil)
+	req.Header.Set(requestIDHeader, "req-2")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var p problem
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	if rec.Code != http.StatusInternalServerError || p.Status != http.StatusInternalServerError {
+		t.Errorf("response = %d %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	got := logLines(t, &buf)[0]
+	if got["msg"] != "panic" || got["panic"] != "boom" || got["request_id"] != "req-2" || !strings.Contains(got["stack"].(string), "goroutine") {
+		t.Errorf("panic log = %v", got)
+	}
+
+	// A handler that already answered keeps its answer.
+	rec = httptest.NewRecorder()
+	withRecover(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late")
+	})).ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("late panic = %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestLoggerFrom(t *testing.T) {
+	var buf bytes.Buffer
+	saved := logger
+	logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	t.Cleanup(func() { logger = saved })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeader, "req-3")
+	withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loggerFrom(r.Context()).Info("hello")
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if got := logLines(t, &buf)[0]; got["request_id"] != "req-3" {
+		t.Errorf("log = %v", got)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/oidc"
+)
+
+// oidcConfig enables logging in with an OpenID Connect provider. RedirectURL
+// must reach GET /v1/auth/oidc/callback with the provider's query string and
+// the browser's cookies, directly or through a frontend on the same site
+// that forwards them (adding the user's token when confirming a link).
+type oidcConfig struct {
+	Issuer       string   `json:"issuer"` // empty disables OIDC login
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret" secret:"true"` // empty for a public client
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+func defaultOIDCConfig() oidcConfig {
+	return oidcConfig{Scopes: []string{"email", "profile"}}
+}
+
+func (c oidcConfig) validate() error {
+	if c.Issuer == "" {
+		return nil
+	}
+	var errs []error
+	u, err := url.Parse(c.Issuer)
+	if err != nil || !(u.Scheme == "https" || u.Scheme == "http" && isLoopback(u.Hostname())) || u.RawQuery != "" {
+		errs = append(errs, errors.New("oidc.issuer: must be an https URL without a query"))
+	}
+	if c.ClientID == "" {
+		errs = append(errs, errors.New("oidc.client_id: required with oidc.issuer"))
+	}
+	if u, err := url.Parse(c.RedirectURL); err != nil || !u.IsAbs() {
+		errs = append(errs, errors.New("oidc.redirect_url: must be an absolute URL"))
+	}
+	return errors.Join(errs...)
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
+
+// ─── provider and pending logins ──────────────────────────────────────────────
+
+// oidcFlowTTL bounds the time a user may spend at the provider.
+const oidcFlowTTL = 10 * time.Minute
+
+// maxOIDCFlows caps pending logins, which anyone can start.
+const maxOIDCFlows = 10000
+
+var oidcState = struct {
+	mu       sync.Mutex
+	provider *oidc.Provider
+	issuer   string              // the provider's, to notice config changes
+	flows    map[string]oidcFlow // by state
+}{flows: make(map[string]oidcFlow)}
+
+// oidcFlow is what a login keeps between the redirect to the provider and
+// the callback.
+type oidcFlow struct {
+	nonce    string
+	verifier string
+	linkTo   string // user ID when linking rather than logging in
+	expires  time.Time
+}
+
+// oidcProvider discovers the provider on first use and keeps it. A failed
+// discovery is retried by the next login.
+func oidcProvider(ctx context.Context) (*oidc.Provider, error) {
+	oidcState.mu.Lock()
+	defer oidcState.mu.Unlock()
+	if oidcState.provider != nil && oidcState.issuer == cfg.OIDC.Issuer {
+		return oidcState.provider, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	c := cfg.OIDC
+	p, err := oidc.Discover(ctx, oidc.Config{
+		Issuer:       c.Issuer,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+		Scopes:       c.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	oidcState.provider, oidcState.issuer = p, c.Issuer
+	return p, nil
+}
+
+// oidcCookie binds a flow to the browser that started it: the callback
+// must carry it with the same state, so a URL handed to someone else (or
+// planted by an attacker) cannot complete the flow.
+const oidcCookie = "oidc_state"
+
+// beginOIDC records a new flow, binds it to the browser with oidcCookie and
+// returns the URL that starts it.
+func beginOIDC(w http.ResponseWriter, r *http.Request, linkTo string) (string, int, error) {
+	ctx := r.Context()
+	if cfg.OIDC.Issuer == "" {
+		return "", http.StatusNotFound, errors.New("OIDC login is not configured")
+	}
+	p, err := oidcProvider(ctx)
+	if err != nil {
+		loggerFrom(ctx).Error("oidc discovery failed", "err", err)
+		return "", http.StatusServiceUnavailable, errors.New("identity provider unavailable")
+	}
+	state, flow := oidc.RandomString(24), oidcFlow{
+		nonce:    oidc.RandomString(24),
+		verifier: oidc.RandomString(48),
+		linkTo:   linkTo,
+		expires:  time.Now().Add(oidcFlowTTL),
+	}
+
+	oidcState.mu.Lock()
+	defer oidcState.mu.Unlock()
+	if len(oidcState.flows) >= maxOIDCFlows {
+		for s, f := range oidcState.flows {
+			if time.Now().After(f.expires) {
+				delete(oidcState.flows, s)
+			}
+		}
+		if len(oidcState.flows) >= maxOIDCFlows {
+			return "", http.StatusServiceUnavailable, errors.New("too many logins in progress, retry later")
+		}
+	}
+	oidcState.flows[state] = flow
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(oidcFlowTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return p.AuthCodeURL(state, flow.nonce, flow.verifier), 0, nil
+}
+
+// takeOIDCFlow removes and returns the flow for state; each is used once.
+func takeOIDCFlow(state string) (oidcFlow, bool) {
+	oidcState.mu.Lock()
+	defer oidcState.mu.Unlock()
+	f, ok := oidcState.flows[state]
+	delete(oidcState.flows, state)
+	return f, ok && time.Now().Before(f.expires)
+}
+
+// ─── wire types ───────────────────────────────────────────────────────────────
+
+type oidcLinkV1 struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// ─── handlers ─────────────────────────────────────────────────────────────────
+
+// handleOIDCLogin sends the browser to the provider.
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	to, status, err := beginOIDC(w, r, "")
+	if err != nil {
+		errJSON(w, status, err.Error())
+		return
+	}
+	http.Redirect(w, r, to, http.StatusFound)
+}
+
+// handleOIDCLink starts a flow that links the provider identity to the
+// calling user, so they can log in either way. The callback of a link must
+// carry the same user's token as well as the cookie.
+func handleOIDCLink(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	to, status, err := beginOIDC(w, r, claims.UserID)
+	if err != nil {
+		errJSON(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, oidcLinkV1{AuthorizationURL: to})
+}
+
+// handleOIDCCallback finishes a flow. Logins map the identity to the user
+// it is linked to, provisioning one the first time; links attach it to the
+// user who started the flow. Both answer like POST /v1/auth/login. It is
+// not rate limited: without the unguessable, single-use state and the
+// cookie that goes with it, it does nothing.
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	c, err := r.Cookie(oidcCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(q.Get("state"))) != 1 {
+		authResult("oidc", false)
+		errJSON(w, http.StatusForbidden, "login was not started in this browser; start again")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode})
+	flow, ok := takeOIDCFlow(q.Get("state"))
+	if !ok {
+		errJSON(w, http.StatusBadRequest, "unknown or expired login; start again")
+		return
+	}
+	if flow.linkTo != "" {
+		claims, ok := getUser(r)
+		if !ok {
+			authResult("oidc", false)
+			errJSON(w, http.StatusUnauthorized, "confirming a link needs the token of the account being linked")
+			return
+		}
+		if claims.UserID != flow.linkTo {
+			authResult("oidc", false)
+			errJSON(w, http.StatusForbidden, "this link was started by another account")
+			return
+		}
+	}
+	if e := q.Get("error"); e != "" {
+		authResult("oidc", false)
+		errJSON(w, http.StatusUnauthorized, "identity provider refused the login: "+e)
+		return
+	}
+	p, err := oidcProvider(r.Context())
+	if err != nil {
+		errJSON(w, http.StatusServiceUnavailable, "identity provider unavailable")
+		return
+	}
+	span := childSpan(r.Context(), "oidc.Provider.Exchange")
+	id, err := p.Exchange(r.Context(), q.Get("code"), flow.verifier, flow.nonce)
+	span.End()
+	if err != nil {
+		authResult("oidc", false)
+		loggerFrom(r.Context()).Warn("oidc login failed", "err", err)
+		errJSON(w, http.StatusUnauthorized, "identity provider login failed")
+		return
+	}
+
+	status, message := http.StatusOK, ""
+	var user auth.User
+	if flow.linkTo != "" {
+		err = users.LinkIdentity(r.Context(), flow.linkTo, id.Issuer, id.Subject)
+		if err == auth.ErrIdentityLinked {
+			authResult("oidc", false)
+			errJSON(w, http.StatusConflict, "this identity is linked to another account")
+			return
+		}
+		if err == nil {
+			user, err = users.Get(r.Context(), flow.linkTo)
+			message = "linked"
+		}
+	} else if user, err = users.FindIdentity(r.Context(), id.Issuer, id.Subject); err == auth.ErrUserNotFound {
+		var created *auth.User
+		created, err = users.ProvisionIdentity(r.Context(), id.Issuer, id.Subject, usernameHint(id))
+		if err == nil {
+			user, status = *created, http.StatusCreated
+			loggerFrom(r.Context()).Info("provisioned user from identity provider", "user_id", user.ID, "username", user.Username)
+		}
+	}
+	authResult("oidc", err == nil && !user.Disabled)
+	if err == auth.ErrUserNotFound {
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err != nil {
+		errJSON(w, http.StatusInternalServerError, "could not log in")
+		return
+	}
+	if user.Disabled {
+		errJSON(w, http.StatusForbidden, "account disabled")
+		return
+	}
+	if user.TwoFactorEnabled() {
+		writeChallenge(w, r, &user)
+		return
+	}
+	token, _ := tokens.CreateToken(r.Context(), &user, cfg.Auth.TokenTTL.Duration)
+	writeJSON(w, status, authResponseV1{Message: message, Token: token, User: newUserV1(&user)})
+}
+
+// usernameHint picks the username to provision for id.
+func usernameHint(id *oidc.IDToken) string {
+	switch {
+	case id.PreferredUsername != "":
+		return id.PreferredUsername
+	case id.Email != "" && id.EmailVerified:
+		return id.Email
+	}
+	return fmt.Sprintf("oidc-%.8s", id.Subject)
+}
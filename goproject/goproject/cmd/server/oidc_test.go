@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"testing"
+
+	"goproject/internal/oidc/oidctest"
+)
+
+// browser returns a client with its own cookies, like a separate browser.
+func browser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// oidcGet follows a login through the mock provider and back to the
+// callback, like a browser would, and returns the callback's response.
+func oidcGet(t *testing.T, c *http.Client, url string) (int, map[string]any) {
+	t.Helper()
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+// location returns where url redirects to without following it, so a
+// test can choose which browser takes the next step. Cookies set on the
+// way go to b's jar, if given.
+func location(t *testing.T, url string, b ...*http.Client) string {
+	t.Helper()
+	c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	if len(b) > 0 {
+		c.Jar = b[0].Jar
+	}
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Location")
+}
+
+// oidcLink starts a link for token in b and returns the callback URL.
+func oidcLink(t *testing.T, b *http.Client, srvURL, token string) string {
+	t.Helper()
+	req, _ := http.NewRequest("POST", srvURL+"/v1/auth/oidc/link", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := b.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var link oidcLinkV1
+	json.NewDecoder(resp.Body).Decode(&link)
+	return location(t, link.AuthorizationURL)
+}
+
+// confirm completes a callback in b, sending token if there is one.
+func confirm(t *testing.T, b *http.Client, url, token string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := b.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func setupOIDC(t *testing.T, srvURL string) *oidctest.Provider {
+	t.Helper()
+	idp := oidctest.NewProvider("notes-api", "client-secret")
+	t.Cleanup(idp.Close)
+	saved := cfg.OIDC
+	t.Cleanup(func() { cfg.OIDC = saved })
+	cfg.OIDC = oidcConfig{
+		Issuer: idp.URL, ClientID: "notes-api", ClientSecret: "client-secret",
+		RedirectURL: srvURL + "/v1/auth/oidc/callback", Scopes: []string{"email"},
+	}
+	return idp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	srv := newTestServer(t)
+	idp := setupOIDC(t, srv.URL)
+	b := browser(t)
+
+	// The first login provisions an account, named without taking over an
+	// existing one; later logins find it again.
+	registerToken(t, srv, "oidc-fran")
+	idp.SetUser(oidctest.User{Subject: "fran-sub", PreferredUsername: "oidc-fran"})
+	status, first := oidcGet(t, b, srv.URL+"/v1/auth/oidc/login")
+	user, _ := first["user"].(map[string]any)
+	if status != http.StatusCreated || user["username"] != "oidc-fran-2" {
+		t.Fatalf("first login = %d %v", status, first)
+	}
+	if got := call(t, srv, first["token"].(string), "GET", "/v1/notes", ""); got["count"] != 0.0 {
+		t.Errorf("provisioned user's token = %v", got)
+	}
+	status, again := oidcGet(t, b, srv.URL+"/v1/auth/oidc/login")
+	if status != http.StatusOK || again["user"].(map[string]any)["id"] != user["id"] {
+		t.Errorf("second login = %d %v", status, again)
+	}
+
+	// Linking lets an existing account log in through the provider.
+	token := registerToken(t, srv, "gus")
+	idp.SetUser(oidctest.User{Subject: "gus-sub", Email: "gus@example.com"})
+	if status, got := confirm(t, b, oidcLink(t, b, srv.URL, token), token); status != http.StatusOK || got["user"].(map[string]any)["username"] != "gus" {
+		t.Fatalf("link = %d %v", status, got)
+	}
+	if _, got := oidcGet(t, b, srv.URL+"/v1/auth/oidc/login"); got["user"].(map[string]any)["username"] != "gus" {
+		t.Errorf("login after link = %v", got)
+	}
+	idp.SetUser(oidctest.User{Subject: "fran-sub"})
+	if status, got := confirm(t, b, oidcLink(t, b, srv.URL, token), token); status != http.StatusConflict {
+		t.Errorf("linking someone else's identity = %d %v", status, got)
+	}
+}
+
+func TestOIDCCallbackBoundToBrowser(t *testing.T) {
+	srv := newTestServer(t)
+	idp := setupOIDC(t, srv.URL)
+	victim, attacker := browser(t), browser(t)
+
+	// Without the cookie from the start of the flow, a callback does
+	// nothing, whether forged or the attacker's own handed to a victim.
+	if got := call(t, srv, "", "GET", "/v1/auth/oidc/callback?code=x&state=forged", ""); got["status"] != 403.0 {
+		t.Errorf("forged state = %v", got)
+	}
+	idp.SetUser(oidctest.User{Subject: "mallory-sub", PreferredUsername: "mallory"})
+	planted := location(t, location(t, srv.URL+"/v1/auth/oidc/login", attacker))
+	if status, got := confirm(t, victim, planted, ""); status != http.StatusForbidden {
+		t.Errorf("callback in another browser = %d %v", status, got)
+	}
+
+	// A link completes only in the browser that started it, with the
+	// token of the user who started it.
+	ann, bob := registerToken(t, srv, "ann"), registerToken(t, srv, "bob")
+	idp.SetUser(oidctest.User{Subject: "ann-sub"})
+	if status, _ := confirm(t, attacker, oidcLink(t, victim, srv.URL, ann), ""); status != http.StatusForbidden {
+		t.Errorf("link in another browser = %d", status)
+	}
+	if status, _ := confirm(t, victim, oidcLink(t, victim, srv.URL, ann), ""); status != http.StatusUnauthorized {
+		t.Errorf("link without a token = %d", status)
+	}
+	if status, _ := confirm(t, victim, oidcLink(t, victim, srv.URL, ann), bob); status != http.StatusForbidden {
+		t.Errorf("link with another user's token = %d", status)
+	}
+	if status, got := confirm(t, victim, oidcLink(t, victim, srv.URL, ann), ann); status != http.StatusOK || got["user"].(map[string]any)["username"] != "ann" {
+		t.Errorf("link = %d %v", status, got)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/notes"
+)
+
+// operation documents one route. Request and response bodies are given as
+// zero values of the Go types the handler reads and writes; their schemas
+// are derived by reflection, so they follow the code. Common error
+// responses (401, 403, 400, 413, 422) are added from auth and request.
+// Routes that accept API keys name the scope a key needs.
+type operation struct {
+	id      string
+	tag     string
+	summary string
+	auth    bool
+	scope   auth.Scope
+
+	request   map[string]any // media type → body
+	responses map[int]any    // status → body, nil for none
+}
+
+func jsonBody(v any) map[string]any {
+	return map[string]any{"application/json": v}
+}
+
+// rawBody documents a non-JSON response by its media type.
+type rawBody string
+
+// patchOperation is one RFC 6902 operation, for documentation only; the PATCH
+// handler passes the document to internal/jsonpatch untouched.
+type patchOperation struct {
+	Op    patchOpName `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value any         `json:"value,omitempty"`
+}
+
+type patchOpName string
+
+// enums lists the allowed values of string types.
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(notes.Priority("")): {string(notes.PriorityLow), string(notes.PriorityMedium), string(notes.PriorityHigh)},
+	reflect.TypeOf(patchOpName("")):    {"add", "remove", "replace", "move", "copy", "test"},
+}
+
+// requestRequired lists required request fields; everything else in a
+// request body may be omitted. Response fields are required unless
+// omitempty.
+var requestRequired = map[reflect.Type][]string{
+	reflect.TypeOf(credentialsV1{}):      {"username", "password"},
+	reflect.TypeOf(notes.CreateInput{}):  {"title"},
+	reflect.TypeOf(notes.ReplaceInput{}): {"title"},
+	reflect.TypeOf(patchOperation{}):     {"op", "path"},
+	reflect.TypeOf(syncPushV1{}):         {"mutations"},
+	reflect.TypeOf(notes.Mutation{}):     {"op"},
+	reflect.TypeOf(webhookInputV1{}):     {"url", "events"},
+	reflect.TypeOf(apiKeyInputV1{}):      {"name", "scopes"},
+	reflect.TypeOf(challengeInputV1{}):   {"challenge", "code"},
+	reflect.TypeOf(codeInputV1{}):        {"code"},
+	reflect.TypeOf(passwordChangeV1{}):   {"new_password"},
+	reflect.TypeOf(accountDeletionV1{}):  {"confirm"},
+	reflect.TypeOf(webhookUpdateV1{}):    {"url", "events", "active"},
+	reflect.TypeOf(graphqlRequestV1{}):   {"query"},
+}
+
+// ─── document ─────────────────────────────────────────────────────────────────
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+)
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() { openAPIDoc = openAPIDocument() })
+	writeJSON(w, http.StatusOK, openAPIDoc)
+}
+
+//go:embed docs.html
+var docsPage []byte
+
+// handleDocs serves a self-contained page that renders /openapi.json and can
+// send requests to the API.
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
+
+// openAPIDocument builds the OpenAPI 3.1 description of every route in
+// apis.
+func openAPIDocument() map[string]any {
+	b := &schemaBuilder{components: map[string]any{}, types: map[string]reflect.Type{}}
+	paths := map[string]map[string]any{}
+	for _, a := range apis() {
+		for _, rt := range a.routes {
+			op, ok := a.docs[rt.method+" "+rt.path]
+			if !ok {
+				continue // reported by TestOpenAPICoversEveryRoute
+			}
+			path := a.prefix + rt.path
+			if paths[path] == nil {
+				paths[path] = map[string]any{}
+			}
+			paths[path][strings.ToLower(rt.method)] = b.operation(op, path, a.deprecated)
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Notes API",
+			"version": "1",
+			"description": "Notes with tags, priorities, pinning and manual ordering. " +
+				"Unversioned paths are deprecated aliases of /v1. Errors are RFC 7807 problem documents.",
+		},
+		"tags": []map[string]string{
+			{"name": "auth", "description": "Accounts, tokens, two-factor authentication and API keys"},
+			{"name": "account", "description": "Your profile, password and account"},
+			{"name": "notes", "description": "Your notes"},
+			{"name": "sync", "description": "Delta sync for offline clients"},
+			{"name": "webhooks", "description": "Signed HTTP callbacks for note events"},
+			{"name": "admin", "description": "User management; requires the admin role"},
+			{"name": "graphql", "description": "Notes, tags and stats over GraphQL, with subscriptions over WebSocket"},
+			{"name": "operations", "description": "Health, metrics and documentation"},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type": "http", "scheme": "bearer",
+					"description": "A token from /v1/auth/login, or a personal API key (nk_…) that has the scope the operation lists. " +
+						"Operations that list no scope take tokens only.",
+				},
+			},
+		},
+	}
+}
+
+func (b *schemaBuilder) operation(op operation, path string, deprecated bool) map[string]any {
+	out := map[string]any{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+	}
+	if deprecated {
+		out["operationId"] = op.id + "Legacy"
+		out["deprecated"] = true
+		out["description"] = fmt.Sprintf("Deprecated alias of /v1%s, removed after %s.", path, legacySunset.Format(time.DateOnly))
+	}
+	if op.auth {
+		scopes := []string{}
+		if op.scope != "" {
+			scopes = []string{string(op.scope)}
+		}
+		out["security"] = []map[string][]string{{"bearerAuth": scopes}}
+	}
+
+	var params []map[string]any
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params = append(params, map[string]any{
+				"name":     strings.Trim(seg, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	if params != nil {
+		out["parameters"] = params
+	}
+
+	responses := map[string]any{}
+	for code, body := range op.responses {
+		responses[fmt.Sprint(code)] = b.response(code, body)
+	}
+	if op.request != nil {
+		content := map[string]any{}
+		for mediaType, body := range op.request {
+			content[mediaType] = map[string]any{"schema": b.schema(reflect.TypeOf(body), true)}
+		}
+		out["requestBody"] = map[string]any{"required": true, "content": content}
+		for _, code := range []int{400, 413, 422} {
+			responses[fmt.Sprint(code)] = b.response(code, problem{})
+		}
+	}
+	if op.auth {
+		responses["401"] = b.response(401, problem{})
+		responses["403"] = b.response(403, problem{})
+	}
+	out["responses"] = responses
+	return out
+}
+
+func (b *schemaBuilder) response(code int, body any) map[string]any {
+	out := map[string]any{"description": http.StatusText(code)}
+	switch body := body.(type) {
+	case nil:
+	case rawBody:
+		schema := map[string]any{"type": "string"}
+		if body == "application/json" {
+			schema = map[string]any{"type": "object"}
+		}
+		out["content"] = map[string]any{string(body): map[string]any{"schema": schema}}
+	case problem:
+		out["content"] = map[string]any{"application/problem+json": map[string]any{"schema": b.schema(reflect.TypeOf(body), false)}}
+	default:
+		out["content"] = map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(body), false)}}
+	}
+	return out
+}
+
+// ─── schemas ──────────────────────────────────────────────────────────────────
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder turns Go types into JSON Schemas, registering each named
+// struct once under components/schemas.
+type schemaBuilder struct {
+	components map[string]any
+	types      map[string]reflect.Type
+}
+
+// schema describes t. Request schemas only require the fields listed in
+// requestRequired and carry the notes validation limits.
+func (b *schemaBuilder) schema(t reflect.Type, request bool) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem(), request)
+	case reflect.String:
+		s := map[string]any{"type": "string"}
+		if values, ok := enums[t]; ok {
+			s["enum"] = values
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64, reflect.Float32:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem(), request)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem(), request)}
+	case reflect.Struct:
+		return b.ref(t, request)
+	}
+	return map[string]any{}
+}
+
+// schemaName is the component name of t: the Go name without the wire
+// version suffix, capitalised. noteV1 becomes Note.
+func schemaName(t reflect.Type) string {
+	name := strings.TrimSuffix(t.Name(), "V1")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (b *schemaBuilder) ref(t reflect.Type, request bool) map[string]any {
+	name := schemaName(t)
+	if prev, ok := b.types[name]; ok && prev != t {
+		panic(fmt.Sprintf("openapi: %s and %s both map to schema %s", prev, t, name))
+	}
+	ref := map[string]any{"$ref": "#/components/schemas/" + name}
+	if _, ok := b.types[name]; ok {
+		return ref
+	}
+	b.types[name] = t
+
+	props := map[string]any{}
+	var required []string
+	b.fields(t, request, props, &required)
+	if request {
+		required = requestRequired[t]
+	}
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	if request {
+		s["additionalProperties"] = false
+	}
+	b.components[name] = s
+	return ref
+}
+
+// fields adds the JSON properties of struct t, flattening embedded structs
+// the way encoding/json does.
+func (b *schemaBuilder) fields(t reflect.Type, request bool, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.fields(f.Type, request, props, required)
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := b.schema(f.Type, request)
+		if request {
+			addLimits(name, s)
+		}
+		props[name] = s
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// addLimits copies the notes validation rules into request properties.
+func addLimits(field string, s map[string]any) {
+	switch field {
+	case "title":
+		s["minLength"] = 1
+		s["maxLength"] = notes.MaxTitleLen
+	case "body":
+		s["description"] = fmt.Sprintf("At most %d bytes of UTF-8.", notes.MaxBodyLen)
+	case "tags":
+		s["maxItems"] = notes.MaxTags
+		if items, ok := s["items"].(map[string]any); ok {
+			items["maxLength"] = notes.MaxTagLen
+		}
+	}
+}
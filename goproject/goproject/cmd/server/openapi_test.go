@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"goproject/internal/auth"
+)
+
+// TestOpenAPICoversEveryRoute fails when a route has no documentation, when
+// documentation names a route that does not exist, or when a documented path
+// is not served by the router.
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	for _, a := range apis() {
+		registered := map[string]bool{}
+		for _, rt := range a.routes {
+			key := rt.method + " " + rt.path
+			registered[key] = true
+			if _, ok := a.docs[key]; !ok {
+				t.Errorf("route %s%s has no OpenAPI operation", a.prefix, key)
+			}
+		}
+		for key := range a.docs {
+			if !registered[key] {
+				t.Errorf("OpenAPI operation %q (prefix %q) has no route", key, a.prefix)
+			}
+		}
+	}
+
+	rt := newRouter()
+	doc := openAPIDocument()
+	ids := map[string]bool{}
+	for path, item := range doc["paths"].(map[string]map[string]any) {
+		for method, op := range item {
+			req := httptest.NewRequest(strings.ToUpper(method), strings.ReplaceAll(path, "{id}", "x"), nil)
+			if _, pattern := rt.mux.Handler(req); pattern != strings.ToUpper(method)+" "+path {
+				t.Errorf("%s %s is documented but routes to %q", method, path, pattern)
+			}
+			id := op.(map[string]any)["operationId"].(string)
+			if ids[id] {
+				t.Errorf("duplicate operationId %s", id)
+			}
+			ids[id] = true
+		}
+	}
+}
+
+// TestOpenAPIMatchesResponses drives the API and checks every status code
+// and body against the document.
+func TestOpenAPIMatchesResponses(t *testing.T) {
+	srv := newTestServer(t)
+
+	raw, _ := json.Marshal(openAPIDocument())
+	var spec map[string]any
+	json.Unmarshal(raw, &spec)
+
+	var token string
+	do := func(method, path, template, contentType, body string) map[string]any {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+
+		op, _ := dig(spec, "paths", template, strings.ToLower(method)).(map[string]any)
+		if op == nil {
+			t.Fatalf("%s %s is not documented", method, template)
+		}
+		r, _ := dig(op, "responses", fmt.Sprint(resp.StatusCode)).(map[string]any)
+		if r == nil {
+			t.Errorf("%s %s returned undocumented status %d: %s", method, path, resp.StatusCode, data)
+			return nil
+		}
+		var got map[string]any
+		json.Unmarshal(data, &got)
+		mediaType := strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0]
+		schema := dig(r, "content", mediaType, "schema")
+		if schema == nil {
+			t.Errorf("%s %s %d: content type %s is not documented", method, path, resp.StatusCode, mediaType)
+			return got
+		}
+		for _, problem := range checkSchema(spec, schema, got, "body") {
+			t.Errorf("%s %s %d: %s", method, path, resp.StatusCode, problem)
+		}
+		return got
+	}
+
+	do("POST", "/v1/auth/register", "/v1/auth/register", "application/json", `{"username":"doc","password":"secret123"}`)
+	do("POST", "/v1/auth/register", "/v1/auth/register", "application/json", `{"username":"doc","password":"secret123"}`)
+	login := do("POST", "/v1/auth/login", "/v1/auth/login", "application/json", `{"username":"doc","password":"secret123"}`)
+	do("GET", "/v1/notes", "/v1/notes", "", "")
+	token = login["token"].(string)
+
+	setup := do("POST", "/v1/auth/2fa/setup", "/v1/auth/2fa/setup", "", "")
+	do("POST", "/v1/auth/2fa/confirm", "/v1/auth/2fa/confirm", "application/json", `{"code":"x"}`)
+	recovery := do("POST", "/v1/auth/2fa/confirm", "/v1/auth/2fa/confirm", "application/json", `{"code":"`+totpNow(t, setup)+`"}`)["recovery_codes"].([]any)
+	do("POST", "/v1/auth/2fa/setup", "/v1/auth/2fa/setup", "", "")
+	challenge := do("POST", "/v1/auth/login", "/v1/auth/login", "application/json", `{"username":"doc","password":"secret123"}`)["challenge"].(string)
+	do("POST", "/v1/auth/login/2fa", "/v1/auth/login/2fa", "application/json", `{"challenge":"`+challenge+`","code":"nope"}`)
+	do("POST", "/v1/auth/login/2fa", "/v1/auth/login/2fa", "application/json", `{"challenge":"`+challenge+`","code":"`+recovery[0].(string)+`"}`)
+	do("POST", "/v1/auth/2fa/disable", "/v1/auth/2fa/disable", "application/json", `{"code":"`+recovery[1].(string)+`"}`)
+	do("POST", "/v1/auth/2fa/disable", "/v1/auth/2fa/disable", "application/json", `{"code":"`+recovery[2].(string)+`"}`)
+
+	do("GET", "/v1/me", "/v1/me", "", "")
+	do("PUT", "/v1/me", "/v1/me", "application/json", `{"display_name":"Doc","timezone":"UTC"}`)
+	do("PUT", "/v1/me", "/v1/me", "application/json", `{"email":"nope"}`)
+	do("PUT", "/v1/me/password", "/v1/me/password", "application/json", `{"current_password":"wrong","new_password":"secret456"}`)
+	token = do("PUT", "/v1/me/password", "/v1/me/password", "application/json", `{"current_password":"secret123","new_password":"secret123"}`)["token"].(string)
+	do("DELETE", "/v1/me", "/v1/me", "application/json", `{"confirm":"someone-else"}`)
+	a := do("POST", "/v1/notes", "/v1/notes", "application/json", `{"title":"a","tags":["x"]}`)
+	b := do("POST", "/notes", "/notes", "application/json", `{"title":"b"}`)
+	do("POST", "/v1/notes", "/v1/notes", "application/json", `{"title":""}`)
+	do("POST", "/v1/notes", "/v1/notes", "application/json", `{"title":`)
+	do("GET", "/v1/notes", "/v1/notes", "", "")
+	do("GET", "/v1/notes/"+a["id"].(string), "/v1/notes/{id}", "", "")
+	do("GET", "/v1/notes/missing", "/v1/notes/{id}", "", "")
+	do("PUT", "/v1/notes/"+a["id"].(string), "/v1/notes/{id}", "application/json", `{"title":"a2","done":true}`)
+	do("PATCH", "/v1/notes/"+a["id"].(string), "/v1/notes/{id}", "application/merge-patch+json", `{"priority":"high"}`)
+	do("PATCH", "/v1/notes/"+a["id"].(string), "/v1/notes/{id}", "application/json-patch+json", `[{"op":"test","path":"/title","value":"no"}]`)
+	do("PATCH", "/v1/notes/"+a["id"].(string), "/v1/notes/{id}", "text/plain", `x`)
+	do("POST", "/v1/notes/"+a["id"].(string)+"/move", "/v1/notes/{id}/move", "application/json", `{"after":"`+b["id"].(string)+`"}`)
+	do("DELETE", "/v1/notes/"+b["id"].(string), "/v1/notes/{id}", "", "")
+	do("GET", "/v1/sync", "/v1/sync", "", "")
+	do("GET", "/v1/sync?since=1", "/v1/sync", "", "")
+	do("GET", "/v1/sync?since=999999", "/v1/sync", "", "")
+	do("POST", "/v1/sync", "/v1/sync", "application/json",
+		`{"mutations":[{"op":"create","client_id":"c1","fields":{"title":"s"}},{"op":"update","id":"`+a["id"].(string)+`","base_version":1,"fields":{"priority":"low"}},{"op":"delete","id":"missing"}]}`)
+	hook := do("POST", "/v1/webhooks", "/v1/webhooks", "application/json", `{"url":"https://example.com/hook","events":["note.created"]}`)
+	do("POST", "/v1/webhooks", "/v1/webhooks", "application/json", `{"url":"example.com","events":["note.created"]}`)
+	do("GET", "/v1/webhooks", "/v1/webhooks", "", "")
+	do("PUT", "/v1/webhooks/"+hook["id"].(string), "/v1/webhooks/{id}", "application/json", `{"url":"https://example.com/hook","events":["note.done"],"active":false}`)
+	do("GET", "/v1/webhooks/"+hook["id"].(string)+"/deliveries", "/v1/webhooks/{id}/deliveries", "", "")
+	do("POST", "/v1/webhooks/"+hook["id"].(string)+"/deliveries/missing/redeliver", "/v1/webhooks/{id}/deliveries/{delivery}/redeliver", "", "")
+	do("DELETE", "/v1/webhooks/"+hook["id"].(string), "/v1/webhooks/{id}", "", "")
+	do("GET", "/v1/webhooks/"+hook["id"].(string), "/v1/webhooks/{id}", "", "")
+	key := do("POST", "/v1/api-keys", "/v1/api-keys", "application/json", `{"name":"ci","scopes":["notes:read"],"expires_at":"2099-01-01T00:00:00Z"}`)
+	do("POST", "/v1/api-keys", "/v1/api-keys", "application/json", `{"name":"ci","scopes":["everything"]}`)
+	do("GET", "/v1/api-keys", "/v1/api-keys", "", "")
+	token, userToken := key["key"].(string), token
+	do("GET", "/v1/notes", "/v1/notes", "", "")
+	do("POST", "/v1/notes", "/v1/notes", "application/json", `{"title":"k"}`)
+	do("GET", "/v1/api-keys", "/v1/api-keys", "", "")
+	token = userToken
+	do("DELETE", "/v1/api-keys/"+key["id"].(string), "/v1/api-keys/{id}", "", "")
+	do("DELETE", "/v1/api-keys/"+key["id"].(string), "/v1/api-keys/{id}", "", "")
+	do("POST", "/graphql", "/graphql", "application/json", `{"query":"{ me { username tags { tag count } } notes(first: 1) { id priority createdAt } }"}`)
+	do("POST", "/graphql", "/graphql", "application/json", `{"query":"{ nope }"}`)
+	do("POST", "/graphql", "/graphql", "application/json", `{"query":"mutation { deleteNote(id: \"missing\") }"}`)
+	do("GET", "/graphql?query="+url.QueryEscape("{ stats { total byPriority { priority count } } }"), "/graphql", "", "")
+	do("GET", "/graphql?query="+url.QueryEscape(`mutation { deleteNote(id: "x") }`), "/graphql", "", "")
+	docID := login["user"].(map[string]any)["id"].(string)
+	do("GET", "/v1/admin/users", "/v1/admin/users", "", "")
+	admin, _ := users.Register(context.Background(), "doc-admin", "secret123")
+	users.SetRole(context.Background(), admin.ID, auth.RoleAdmin)
+	token = do("POST", "/v1/auth/login", "/v1/auth/login", "application/json", `{"username":"doc-admin","password":"secret123"}`)["token"].(string)
+	do("GET", "/v1/admin/users", "/v1/admin/users", "", "")
+	do("GET", "/v1/admin/users/"+docID, "/v1/admin/users/{id}", "", "")
+	do("GET", "/v1/admin/users/missing", "/v1/admin/users/{id}", "", "")
+	do("POST", "/v1/admin/users/"+docID+"/disable", "/v1/admin/users/{id}/disable", "", "")
+	do("POST", "/v1/admin/users/"+admin.ID+"/disable", "/v1/admin/users/{id}/disable", "", "")
+	do("POST", "/v1/auth/login", "/v1/auth/login", "application/json", `{"username":"doc","password":"secret123"}`)
+	do("POST", "/v1/admin/users/"+docID+"/enable", "/v1/admin/users/{id}/enable", "", "")
+	do("POST", "/v1/admin/users/"+docID+"/reset-password", "/v1/admin/users/{id}/reset-password", "", "")
+	do("DELETE", "/v1/admin/users/"+docID, "/v1/admin/users/{id}", "", "")
+	do("DELETE", "/v1/admin/users/"+docID, "/v1/admin/users/{id}", "", "")
+	do("GET", "/v1/auth/oidc/login", "/v1/auth/oidc/login", "", "")
+	do("GET", "/v1/auth/oidc/callback?code=x&state=unknown", "/v1/auth/oidc/callback", "", "")
+	do("POST", "/v1/auth/oidc/link", "/v1/auth/oidc/link", "", "")
+	do("GET", "/livez", "/livez", "", "")
+	do("GET", "/readyz", "/readyz", "", "")
+}
+
+func dig(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// checkSchema reports where v does not conform to schema. It understands
+// the subset of JSON Schema that openAPIDocument emits.
+func checkSchema(spec map[string]any, schema any, v any, at string) []string {
+	s, _ := schema.(map[string]any)
+	if ref, ok := s["$ref"].(string); ok {
+		name := ref[strings.LastIndex(ref, "/")+1:]
+		return checkSchema(spec, dig(spec, "components", "schemas", name), v, at)
+	}
+	var errs []string
+	switch s["type"] {
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want object, got %T", at, v)}
+		}
+		props, _ := s["properties"].(map[string]any)
+		if props == nil {
+			return nil
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p, ok := props[k]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: not in schema", at, k))
+				continue
+			}
+			errs = append(errs, checkSchema(spec, p, m[k], at+"."+k)...)
+		}
+		req, _ := s["required"].([]any)
+		for _, k := range req {
+			if _, ok := m[k.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: required but missing", at, k))
+			}
+		}
+	case "array":
+		list, ok := v.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want array, got %T", at, v)}
+		}
+		for i, item := range list {
+			errs = append(errs, checkSchema(spec, s["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want string, got %T", at, v))
+		}
+	case "integer", "number":
+		if _, ok := v.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want number, got %T", at, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want boolean, got %T", at, v))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"goproject/internal/auth"
+	"goproject/internal/jsonpatch"
+	"goproject/internal/notes"
+	"goproject/internal/validation"
+)
+
+const acceptPatch = jsonpatch.MergePatchType + ", " + jsonpatch.JSONPatchType
+
+// handlePatchNote applies a JSON Merge Patch or JSON Patch to the editable
+// fields of a note. The patch is applied under the store lock, so concurrent
+// PATCH requests never lose each other's changes.
+func handlePatchNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	noteID := r.PathValue("id")
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.MergePatchType:
+		apply = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchType:
+		apply = jsonpatch.Apply
+	default:
+		w.Header().Set("Accept-Patch", acceptPatch)
+		errJSON(w, http.StatusUnsupportedMediaType, "PATCH requires Content-Type "+acceptPatch)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBody))
+	if err != nil {
+		errInput(w, err)
+		return
+	}
+
+	note, err := store.Patch(r.Context(), claims.UserID, noteID, func(current notes.ReplaceInput) (notes.ReplaceInput, error) {
+		doc, err := json.Marshal(current)
+		if err != nil {
+			return current, err
+		}
+		patched, err := apply(doc, patch)
+		if err != nil {
+			return current, err
+		}
+		var next notes.ReplaceInput
+		dec := json.NewDecoder(bytes.NewReader(patched))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&next); err != nil {
+			return current, &patchResultError{err}
+		}
+		return next, next.Validate()
+	})
+
+	var verr *validation.Error
+	var rerr *patchResultError
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, newNoteV1(note))
+	case err == notes.ErrNotFound:
+		errJSON(w, http.StatusNotFound, "note not found")
+	case err == notes.ErrForbidden:
+		errJSON(w, http.StatusForbidden, "access denied")
+	case errors.As(err, &verr):
+		errInput(w, err)
+	case errors.Is(err, jsonpatch.ErrInvalidPatch):
+		errInput(w, err)
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		writeProblem(w, problem{Type: problemPatchFailed, Title: "Patch test failed", Status: http.StatusConflict, Detail: err.Error()})
+	case errors.Is(err, jsonpatch.ErrPathNotFound), errors.As(err, &rerr):
+		writeProblem(w, problem{Type: problemPatchFailed, Title: "Patch cannot be applied", Status: http.StatusUnprocessableEntity, Detail: err.Error()})
+	default:
+		errJSON(w, http.StatusInternalServerError, "patch failed")
+	}
+}
+
+// patchResultError means the patch applied cleanly but the resulting
+// document is not a valid note.
+type patchResultError struct{ err error }
+
+func (e *patchResultError) Error() string { return "patched note is invalid: " + e.err.Error() }
+func (e *patchResultError) Unwrap() error { return e.err }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"goproject/internal/validation"
+)
+
+// Problem type URIs used in addition to "about:blank".
+const (
+	problemValidation  = "/problems/validation"
+	problemMalformed   = "/problems/malformed-body"
+	problemPatchFailed = "/problems/patch-failed"
+	problemSyncReset   = "/problems/sync-reset"
+)
+
+// problem is an RFC 7807 problem details object. Errors is an extension
+// member carrying per-field validation messages.
+type problem struct {
+	Type   string                  `json:"type"`
+	Title  string                  `json:"title"`
+	Status int                     `json:"status"`
+	Detail string                  `json:"detail,omitempty"`
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, p problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	encodeJSON(w, p)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"goproject/internal/ratelimit"
+)
+
+// authLimits throttles the credential endpoints. The per-IP and per-username
+// limiters cap request rates; loginBackoff locks a username out after
+// repeated failed logins.
+type authLimits struct {
+	perIP        *ratelimit.Limiter
+	perUsername  *ratelimit.Limiter
+	loginBackoff *ratelimit.Backoff
+}
+
+// rateLimitConfig is the tunable part of authLimits.
+type rateLimitConfig struct {
+	IPRequests       int      `json:"ip_requests"`
+	IPBurst          int      `json:"ip_burst"`
+	UsernameRequests int      `json:"username_requests"`
+	UsernameBurst    int      `json:"username_burst"`
+	Per              duration `json:"per"`
+	LockoutAfter     int      `json:"lockout_after"`
+	LockoutBase      duration `json:"lockout_base"`
+	LockoutMax       duration `json:"lockout_max"`
+}
+
+func defaultRateLimitConfig() rateLimitConfig {
+	return rateLimitConfig{
+		IPRequests:       20,
+		IPBurst:          10,
+		UsernameRequests: 10,
+		UsernameBurst:    5,
+		Per:              duration{time.Minute},
+		LockoutAfter:     5,
+		LockoutBase:      duration{time.Second},
+		LockoutMax:       duration{15 * time.Minute},
+	}
+}
+
+func newAuthLimits(c rateLimitConfig) *authLimits {
+	return &authLimits{
+		perIP:        ratelimit.NewLimiter(c.IPRequests, c.Per.Duration, c.IPBurst),
+		perUsername:  ratelimit.NewLimiter(c.UsernameRequests, c.Per.Duration, c.UsernameBurst),
+		loginBackoff: ratelimit.NewBackoff(c.LockoutAfter, c.LockoutBase.Duration, c.LockoutMax.Duration),
+	}
+}
+
+// limitBy rejects requests with 429 once the bucket for key(r) is empty.
+// Requests for which key returns "" are not limited.
+func limitBy(l *ratelimit.Limiter, key func(*http.Request) string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if k := key(r); k != "" {
+				if ok, wait := l.Allow(k); !ok {
+					errTooManyRequests(w, wait)
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+}
+
+// clientIP keys requests by the remote address of the connection.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// usernameKey keys requests by the "username" field of their JSON body. What
+// was read is put back in front of the rest of the body so the handler sees
+// it unchanged.
+func usernameKey(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxJSONBody))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	var v struct {
+		Username string `json:"username"`
+	}
+	json.Unmarshal(body, &v)
+	return strings.ToLower(v.Username)
+}
+
+func errTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	errJSON(w, http.StatusTooManyRequests, "too many requests, retry later")
+}
+
+// throttleAuth applies both the per-IP and per-username limits.
+func throttleAuth(next http.HandlerFunc) http.HandlerFunc {
+	return limitBy(limits.perIP, clientIP)(limitBy(limits.perUsername, usernameKey)(next))
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
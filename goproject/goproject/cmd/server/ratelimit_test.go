@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// login posts credentials and returns the status and Retry-After header.
+func login(t *testing.T, srv *httptest.Server, username, password string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/v1/auth/login", "application/json",
+		strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("Retry-After")
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	srv := newTestServer(t)
+	burst := defaultRateLimitConfig().IPBurst
+
+	// Different usernames, so only the per-IP limit applies.
+	for i := range burst {
+		if status, _ := login(t, srv, fmt.Sprintf("nobody-%d", i), "x"); status != http.StatusUnauthorized {
+			t.Fatalf("login %d = %d", i, status)
+		}
+	}
+	status, retry := login(t, srv, "nobody-else", "x")
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("login past the burst = %d", status)
+	}
+	if secs, err := strconv.Atoi(retry); err != nil || secs < 1 {
+		t.Errorf("Retry-After = %q", retry)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	newTestServer(t) // for the token manager
+	c := defaultRateLimitConfig()
+	c.IPBurst, c.UsernameBurst = 100, 100
+	c.LockoutBase = duration{time.Minute}
+	limits = newAuthLimits(c) // before newRouter, which binds the limiters
+	srv := httptest.NewServer(chain(newRouter(), withRequestID))
+	defer srv.Close()
+	registerToken(t, srv, "guessed")
+
+	for i := range c.LockoutAfter - 1 {
+		if status, _ := login(t, srv, "guessed", "wrong"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d = %d", i, status)
+		}
+	}
+	if status, retry := login(t, srv, "guessed", "wrong"); status != http.StatusTooManyRequests || retry != "60" {
+		t.Fatalf("wrong password %d = %d, Retry-After %q", c.LockoutAfter, status, retry)
+	}
+	// Locked out even with the right password, under any capitalisation.
+	if status, retry := login(t, srv, "GUESSED", "secret123"); status != http.StatusTooManyRequests || retry != "60" {
+		t.Errorf("right password while locked = %d, Retry-After %q", status, retry)
+	}
+	if status, _ := login(t, srv, "someone-else", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("other username during a lockout = %d", status)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Unversioned paths predate /v1. They stay available as aliases of v1 until
+// legacySunset, and every response on them says so.
+var (
+	legacyDeprecated = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+)
+
+// route is one endpoint of an API version. Path is relative to the version's
+// mount point and uses Go 1.22 wildcards; handlers read them with
+// r.PathValue.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+// api is a route table, its documentation and where it is mounted. routes
+// and the OpenAPI document are both built from apis, so they cannot list
+// different endpoints.
+type api struct {
+	prefix     string
+	routes     []route
+	docs       map[string]operation // keyed by "METHOD path"
+	deprecated bool
+}
+
+func apis() []api {
+	return []api{
+		{prefix: "", routes: opsRoutes(), docs: opsDocs},
+		{prefix: "", routes: graphqlRoutes(), docs: graphqlDocs},
+		{prefix: "/v1", routes: v1Routes(), docs: v1Docs},
+		{prefix: "/v1", routes: adminRoutes(), docs: adminDocs},
+		{prefix: "", routes: v1Routes(), docs: v1Docs, deprecated: true},
+	}
+}
+
+// opsRoutes are the unversioned operational endpoints.
+func opsRoutes() []route {
+	return []route{
+		{http.MethodGet, "/livez", handleLivez},
+		{http.MethodGet, "/readyz", handleReadyz},
+		{http.MethodGet, "/health", handleReadyz},
+		{http.MethodGet, "/metrics", registry.Handler().ServeHTTP},
+		{http.MethodGet, "/openapi.json", handleOpenAPI},
+		{http.MethodGet, "/docs", handleDocs},
+	}
+}
+
+var opsDocs = map[string]operation{
+	"GET /livez": {
+		id: "livez", tag: "operations", summary: "Liveness: the process is up",
+		responses: map[int]any{200: healthResponse{}},
+	},
+	"GET /readyz": {
+		id: "readyz", tag: "operations", summary: "Readiness: dependency checks pass and the server is not draining",
+		responses: map[int]any{200: healthResponse{}, 503: healthResponse{}},
+	},
+	"GET /health": {
+		id: "health", tag: "operations", summary: "Alias of /readyz",
+		responses: map[int]any{200: healthResponse{}, 503: healthResponse{}},
+	},
+	"GET /metrics": {
+		id: "metrics", tag: "operations", summary: "Prometheus metrics",
+		responses: map[int]any{200: rawBody("text/plain")},
+	},
+	"GET /openapi.json": {
+		id: "openapi", tag: "operations", summary: "This OpenAPI document",
+		responses: map[int]any{200: rawBody("application/json")},
+	},
+	"GET /docs": {
+		id: "docs", tag: "operations", summary: "Interactive API documentation",
+		responses: map[int]any{200: rawBody("text/html")},
+	},
+}
+
+// routes registers every endpoint.
+func routes(mux *http.ServeMux) {
+	for _, a := range apis() {
+		var wrap func(http.HandlerFunc) http.HandlerFunc
+		if a.deprecated {
+			wrap = deprecated("/v1", legacyDeprecated, legacySunset)
+		}
+		mount(mux, a.prefix, a.routes, wrap)
+	}
+}
+
+// mount registers an API version under prefix, passing each handler through
+// wrap if it is non-nil.
+func mount(mux *http.ServeMux, prefix string, rs []route, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	for _, rt := range rs {
+		h := rt.handler
+		if wrap != nil {
+			h = wrap(h)
+		}
+		mux.HandleFunc(rt.method+" "+prefix+rt.path, h)
+	}
+}
+
+// deprecated marks responses as coming from a deprecated alias (RFC 9745 and
+// RFC 8594) and links to the same path under successor.
+func deprecated(successor string, since, sunset time.Time) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", fmt.Sprintf("@%d", since.Unix()))
+			h.Set("Sunset", sunset.Format(http.TimeFormat))
+			h.Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, successor, r.URL.EscapedPath()))
+			next(w, r)
+		}
+	}
+}
+
+// router wraps a ServeMux so that unmatched requests get a problem+json
+// 404, or a 405 that keeps the Allow header computed by the mux.
+type router struct {
+	mux *http.ServeMux
+}
+
+func newRouter() *router {
+	mux := http.NewServeMux()
+	routes(mux)
+	return &router{mux: mux}
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, pattern := rt.mux.Handler(r)
+	if pattern != "" {
+		infoFrom(r.Context()).route = pattern
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+
+	// Let the mux decide between 404 and 405, then rewrite its plain-text
+	// reply as a problem.
+	rec := &headerRecorder{header: http.Header{}}
+	h.ServeHTTP(rec, r)
+	if allow := rec.header.Get("Allow"); allow != "" {
+		w.Header().Set("Allow", allow)
+	}
+	switch rec.code {
+	case http.StatusMethodNotAllowed:
+		errJSON(w, rec.code, r.Method+" is not allowed on "+r.URL.Path)
+	default:
+		errJSON(w, http.StatusNotFound, "no route for "+r.URL.Path)
+	}
+}
+
+// headerRecorder captures the status and headers of a response and
+// discards its body.
+type headerRecorder struct {
+	header http.Header
+	code   int
+}
+
+func (h *headerRecorder) Header() http.Header         { return h.header }
+func (h *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (h *headerRecorder) WriteHeader(code int)        { h.code = code }
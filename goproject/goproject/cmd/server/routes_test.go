@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveRoute runs one request through the router and decodes the problem it
+// answers with.
+func serveRoute(t *testing.T, method, path string) (*httptest.ResponseRecorder, problem) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	var p problem
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	return rec, p
+}
+
+func TestUnmatchedRoutes(t *testing.T) {
+	rec, p := serveRoute(t, "GET", "/v1/notes/a/b")
+	if rec.Code != http.StatusNotFound || p.Status != http.StatusNotFound {
+		t.Errorf("unknown path = %d %+v", rec.Code, p)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("404 Content-Type = %q", ct)
+	}
+
+	rec, p = serveRoute(t, "PATCH", "/v1/auth/login")
+	if rec.Code != http.StatusMethodNotAllowed || p.Status != http.StatusMethodNotAllowed {
+		t.Errorf("wrong method = %d %+v", rec.Code, p)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "POST" {
+		t.Errorf("Allow = %q, want POST", allow)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("405 Content-Type = %q", ct)
+	}
+}
+
+func TestLegacyAliasesAreDeprecated(t *testing.T) {
+	rec, _ := serveRoute(t, "GET", "/notes/abc")
+	h := rec.Header()
+	if got, want := h.Get("Deprecation"), fmt.Sprintf("@%d", legacyDeprecated.Unix()); got != want {
+		t.Errorf("Deprecation = %q, want %q", got, want)
+	}
+	if got, want := h.Get("Sunset"), legacySunset.Format(http.TimeFormat); got != want {
+		t.Errorf("Sunset = %q, want %q", got, want)
+	}
+	if got, want := h.Get("Link"), `</v1/notes/abc>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	for _, path := range []string{"/v1/notes/abc", "/livez"} {
+		rec, _ := serveRoute(t, "GET", path)
+		for _, name := range []string{"Deprecation", "Sunset", "Link"} {
+			if v := rec.Header().Get(name); v != "" {
+				t.Errorf("%s: %s = %q", path, name, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// maxJSONBody caps the size of request bodies read by readJSON and the PATCH
+// handler. It is well above notes.MaxBodyLen to leave room for the other
+// fields and JSON escaping.
+const maxJSONBody = 1 << 20
+
+// httpConfig holds the http.Server limits.
+type httpConfig struct {
+	ReadHeaderTimeout duration `json:"read_header_timeout"`
+	ReadTimeout       duration `json:"read_timeout"`
+	WriteTimeout      duration `json:"write_timeout"`
+	IdleTimeout       duration `json:"idle_timeout"`
+	MaxHeaderBytes    int      `json:"max_header_bytes"`
+	ShutdownTimeout   duration `json:"shutdown_timeout"`
+
+	// DrainDelay is how long /readyz reports draining before the server
+	// stops accepting connections, giving load balancers time to notice.
+	DrainDelay duration `json:"drain_delay"`
+}
+
+func defaultHTTPConfig() httpConfig {
+	return httpConfig{
+		ReadHeaderTimeout: duration{5 * time.Second},
+		ReadTimeout:       duration{15 * time.Second},
+		WriteTimeout:      duration{30 * time.Second},
+		IdleTimeout:       duration{2 * time.Minute},
+		MaxHeaderBytes:    64 << 10,
+		ShutdownTimeout:   duration{20 * time.Second},
+	}
+}
+
+func newHTTPServer(addr string, h http.Handler, c httpConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: c.ReadHeaderTimeout.Duration,
+		ReadTimeout:       c.ReadTimeout.Duration,
+		WriteTimeout:      c.WriteTimeout.Duration,
+		IdleTimeout:       c.IdleTimeout.Duration,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+}
+
+// draining is set once shutdown has begun.
+var draining atomic.Bool
+
+// shutdownHooks run after the server has stopped accepting requests and the
+// in-flight ones have finished, in registration order. Stores that buffer
+// writes register their flush here.
+var shutdownHooks []func(context.Context) error
+
+func onShutdown(fn func(context.Context) error) {
+	shutdownHooks = append(shutdownHooks, fn)
+}
+
+// run serves until SIGINT or SIGTERM, then shuts down as serve does. A
+// second signal kills the process as usual.
+func run(srv *http.Server, c httpConfig, listen func() error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	return serve(ctx, srv, c, listen)
+}
+
+// serve calls listen, which is srv.ListenAndServe or a TLS variant, until
+// ctx is done. It then reports draining for c.DrainDelay, stops accepting
+// connections, waits up to c.ShutdownTimeout for in-flight requests and
+// runs the shutdown hooks.
+func serve(ctx context.Context, srv *http.Server, c httpConfig, listen func() error) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- listen() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down", "timeout", c.ShutdownTimeout.String(), "drain_delay", c.DrainDelay.String())
+	draining.Store(true)
+	time.Sleep(c.DrainDelay.Duration)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout.Duration)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	for _, hook := range shutdownHooks {
+		if herr := hook(shutdownCtx); herr != nil {
+			logger.Error("shutdown hook failed", "error", herr)
+			err = errors.Join(err, herr)
+		}
+	}
+	if lerr := <-errCh; lerr != nil && !errors.Is(lerr, http.ErrServerClosed) {
+		err = errors.Join(err, lerr)
+	}
+	return err
+}
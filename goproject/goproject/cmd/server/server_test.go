@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"goproject/internal/events"
+	"goproject/internal/health"
+)
+
+func TestOversizeBody(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "big")
+	huge := `{"title":"t","body":"` + strings.Repeat("x", maxJSONBody) + `"}`
+	for _, path := range []string{"/v1/notes", "/v1/auth/login"} {
+		got := call(t, srv, token, "POST", path, huge)
+		if got["status"] != 413.0 || got["title"] != "Request Entity Too Large" {
+			t.Errorf("%s = %v", path, got)
+		}
+	}
+}
+
+func TestUnknownFieldsIgnored(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "lenient")
+	got := call(t, srv, token, "POST", "/v1/notes", `{"title":"t","color":"red"}`)
+	if got["title"] != "t" {
+		t.Errorf("create with an unknown field = %v", got)
+	}
+}
+
+// shutdownState saves the shutdown hooks and draining flag for the test
+// and restores them after.
+func shutdownState(t *testing.T) {
+	t.Helper()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	t.Cleanup(func() {
+		shutdownHooks = hooks
+		draining.Store(false)
+	})
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	shutdownState(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	c := defaultHTTPConfig()
+	c.DrainDelay = duration{10 * time.Millisecond}
+	srv := newHTTPServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "finished")
+	}), c)
+
+	// Hooks run in order, after in-flight requests; their errors are
+	// returned but do not stop the later ones.
+	var ran []string
+	hook := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			select {
+			case <-release:
+				ran = append(ran, name)
+			default:
+				ran = append(ran, name+" too early")
+			}
+			return err
+		}
+	}
+	onShutdown(hook("first", errors.New("flush failed")))
+	onShutdown(hook("second", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, srv, c, func() error { return srv.Serve(ln) }) }()
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+	for !draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	if got := <-body; got != "finished" {
+		t.Errorf("in-flight request got %q", got)
+	}
+	err = <-done
+	if err == nil || !strings.Contains(err.Error(), "flush failed") {
+		t.Errorf("serve = %v, want the hook's error", err)
+	}
+	if strings.Join(ran, ",") != "first,second" {
+		t.Errorf("hooks ran: %v", ran)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Error("still accepting connections")
+	}
+}
+
+func TestReadyzWhileDraining(t *testing.T) {
+	shutdownState(t)
+	if rec, _ := serveRoute(t, "GET", "/readyz"); rec.Code != http.StatusOK {
+		t.Fatalf("readyz = %d %s", rec.Code, rec.Body)
+	}
+	draining.Store(true)
+	rec, _ := serveRoute(t, "GET", "/readyz")
+	var got healthResponse
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if rec.Code != http.StatusServiceUnavailable || got.Status != "draining" {
+		t.Errorf("readyz while draining = %d %s", rec.Code, rec.Body)
+	}
+	if rec, _ := serveRoute(t, "GET", "/livez"); rec.Code != http.StatusOK {
+		t.Errorf("livez while draining = %d", rec.Code)
+	}
+}
+
+func TestReadyzChecks(t *testing.T) {
+	savedChecks, savedBus := checks, bus
+	checks, bus = health.NewRegistry(), newBus(defaultEventsConfig())
+	t.Cleanup(func() { checks, bus = savedChecks, savedBus })
+	registerHealthChecks()
+
+	readyz := func() (int, map[string]health.Result) {
+		rec, _ := serveRoute(t, "GET", "/readyz")
+		var got healthResponse
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		results := map[string]health.Result{}
+		for _, res := range got.Checks {
+			results[res.Name] = res
+		}
+		return rec.Code, results
+	}
+	code, results := readyz()
+	if code != http.StatusOK || results["event_bus"].Status != health.StatusOK || results["webhooks"].Status != health.StatusOK {
+		t.Fatalf("readyz = %d %+v", code, results)
+	}
+	if _, ok := results["oidc_discovery"]; ok {
+		t.Error("OIDC discovery checked without an issuer configured")
+	}
+
+	bus.Close()
+	if code, results = readyz(); code != http.StatusServiceUnavailable || results["event_bus"].Error != events.ErrClosed.Error() {
+		t.Errorf("readyz with the bus closed = %d %+v", code, results)
+	}
+}
+
+func TestServeReturnsListenError(t *testing.T) {
+	shutdownState(t)
+	ran := false
+	onShutdown(func(context.Context) error { ran = true; return nil })
+	want := errors.New("address in use")
+	if err := serve(context.Background(), &http.Server{}, defaultHTTPConfig(), func() error { return want }); err != want {
+		t.Errorf("serve = %v", err)
+	}
+	if ran || draining.Load() {
+		t.Error("shut down after a failed listen")
+	}
+}
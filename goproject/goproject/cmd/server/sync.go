@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/notes"
+	"goproject/internal/validation"
+)
+
+// Delta sync lets an offline client catch up with GET /sync and upload its
+// edits with POST /sync. The sync token is the store's write sequence
+// number, sent as a decimal string so that clients treat it as opaque.
+const (
+	syncPageSize     = 500
+	maxSyncMutations = 500
+)
+
+type syncChangeV1 struct {
+	Type      string     `json:"type"` // "upsert" or "delete"
+	ID        string     `json:"id"`
+	Version   int        `json:"version"`
+	Note      *noteV1    `json:"note,omitempty"`       // upsert only
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // delete only
+}
+
+type syncPullV1 struct {
+	Changes   []syncChangeV1 `json:"changes"`
+	SyncToken string         `json:"sync_token"`
+	HasMore   bool           `json:"has_more"`
+}
+
+type syncPushV1 struct {
+	Mutations []notes.Mutation `json:"mutations"`
+}
+
+type mutationResultV1 struct {
+	Status    string                `json:"status"`
+	ClientID  string                `json:"client_id,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Note      *noteV1               `json:"note,omitempty"`
+	Deleted   bool                  `json:"deleted,omitempty"`
+	Conflicts []notes.FieldConflict `json:"conflicts,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+type syncPushResultV1 struct {
+	Results []mutationResultV1 `json:"results"`
+}
+
+// handleSyncPull returns the caller's changes since ?since=, a token from an
+// earlier pull (empty or 0 for everything), a page of at most ?limit= at a
+// time.
+func handleSyncPull(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	q := r.URL.Query()
+	var since uint64
+	if s := q.Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			errJSON(w, http.StatusBadRequest, "since must be a sync token")
+			return
+		}
+	}
+	limit := syncPageSize
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > syncPageSize {
+			errJSON(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", syncPageSize))
+			return
+		}
+		limit = n
+	}
+
+	set, err := store.ChangesSince(r.Context(), claims.UserID, since, limit)
+	if err == notes.ErrSyncToken {
+		writeProblem(w, problem{
+			Type:   problemSyncReset,
+			Title:  "Sync token not recognised",
+			Status: http.StatusGone,
+			Detail: "discard local state and sync again without since",
+		})
+		return
+	}
+
+	out := syncPullV1{Changes: make([]syncChangeV1, len(set.Changes)), SyncToken: strconv.FormatUint(set.Token, 10), HasMore: set.More}
+	for i, c := range set.Changes {
+		if t := c.Tombstone; t != nil {
+			out.Changes[i] = syncChangeV1{Type: "delete", ID: t.ID, Version: t.Version, DeletedAt: &t.DeletedAt}
+			continue
+		}
+		n := newNoteV1(c.Note)
+		out.Changes[i] = syncChangeV1{Type: "upsert", ID: n.ID, Version: n.Version, Note: &n}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleSyncPush applies a batch of client mutations in order and reports
+// the outcome of each. Rejected mutations do not stop the batch. The
+// response carries no sync token: the client pulls with its previous token
+// afterwards and receives its own writes along with everyone else's.
+func handleSyncPush(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var body syncPushV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	if len(body.Mutations) > maxSyncMutations {
+		errInput(w, validation.Field("mutations", fmt.Sprintf("must have at most %d entries, got %d", maxSyncMutations, len(body.Mutations))))
+		return
+	}
+
+	results := store.Sync(r.Context(), claims.UserID, body.Mutations)
+
+	out := syncPushResultV1{Results: make([]mutationResultV1, len(results))}
+	for i, res := range results {
+		m := body.Mutations[i]
+		o := mutationResultV1{Status: res.Status, ClientID: m.ClientID, ID: m.ID, Deleted: res.Deleted, Conflicts: res.Conflicts}
+		if res.Note != nil {
+			n := newNoteV1(res.Note)
+			o.Note = &n
+			o.ID = n.ID
+		}
+		if res.Err != nil {
+			o.Error = res.Err.Error()
+		}
+		out.Results[i] = o
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestSyncRoundTrip(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "sync-user")
+
+	note := call(t, srv, token, "POST", "/v1/notes", `{"title":"a","body":"one"}`)
+	id := note["id"].(string)
+	full := call(t, srv, token, "GET", "/v1/sync", "")
+	if changes := full["changes"].([]any); len(changes) != 1 {
+		t.Fatalf("full sync = %v", full)
+	}
+	since := full["sync_token"].(string)
+
+	// An offline client edits the title while the server edits the body,
+	// then deletes a note it created offline.
+	call(t, srv, token, "PUT", "/v1/notes/"+id, `{"title":"a","body":"two"}`)
+	push := call(t, srv, token, "POST", "/v1/sync", `{"mutations":[
+		{"op":"update","id":"`+id+`","base_version":1,"fields":{"title":"offline"}},
+		{"op":"create","client_id":"tmp-1","fields":{"title":"new"}},
+		{"op":"delete","id":"note_999","base_version":1}
+	]}`)
+	results := push["results"].([]any)
+	merged := results[0].(map[string]any)
+	if merged["status"] != "merged" || merged["note"].(map[string]any)["body"] != "two" {
+		t.Errorf("update = %v", merged)
+	}
+	created := results[1].(map[string]any)
+	if created["status"] != "applied" || created["client_id"] != "tmp-1" {
+		t.Errorf("create = %v", created)
+	}
+	if results[2].(map[string]any)["status"] != "rejected" {
+		t.Errorf("delete of unknown note = %v", results[2])
+	}
+
+	call(t, srv, token, "DELETE", "/v1/notes/"+created["id"].(string), "")
+	delta := call(t, srv, token, "GET", "/v1/sync?since="+since, "")
+	changes := delta["changes"].([]any)
+	if len(changes) != 2 {
+		t.Fatalf("delta = %v", delta)
+	}
+	if c := changes[0].(map[string]any); c["type"] != "upsert" || c["note"].(map[string]any)["title"] != "offline" {
+		t.Errorf("first change = %v", c)
+	}
+	if c := changes[1].(map[string]any); c["type"] != "delete" || c["id"] != created["id"] {
+		t.Errorf("second change = %v", c)
+	}
+
+	if gone := call(t, srv, token, "GET", "/v1/sync?since=99999999", ""); gone["status"] != float64(410) {
+		t.Errorf("unknown token = %v", gone)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// tlsConfig enables HTTPS. Either CertFile and KeyFile are set, or Dev is
+// true and a self-signed certificate is generated in memory at startup.
+// HTTP/2 is negotiated automatically whenever TLS is on.
+type tlsConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	Dev      bool   `json:"dev"`
+
+	// ClientCAFile turns on mutual TLS: client certificates must chain to
+	// one of the CAs in this PEM file. ClientAuth is "require" (the
+	// default) or "optional".
+	ClientCAFile string `json:"client_ca_file"`
+	ClientAuth   string `json:"client_auth"`
+
+	// RedirectAddr, if set, starts a plain HTTP listener there that
+	// redirects every request to the HTTPS address.
+	RedirectAddr string `json:"redirect_addr"`
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.Dev || c.CertFile != ""
+}
+
+func (c tlsConfig) validate() error {
+	var errs []error
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("tls: cert_file and key_file must be set together"))
+	}
+	if c.Dev && c.CertFile != "" {
+		errs = append(errs, errors.New("tls: dev cannot be combined with cert_file"))
+	}
+	if c.ClientCAFile != "" && !c.enabled() {
+		errs = append(errs, errors.New("tls.client_ca_file: requires TLS to be enabled"))
+	}
+	if c.ClientAuth != "" && c.ClientAuth != "require" && c.ClientAuth != "optional" {
+		errs = append(errs, fmt.Errorf("tls.client_auth: must be require or optional, got %q", c.ClientAuth))
+	}
+	if c.RedirectAddr != "" {
+		if !c.enabled() {
+			errs = append(errs, errors.New("tls.redirect_addr: requires TLS to be enabled"))
+		} else if _, _, err := net.SplitHostPort(c.RedirectAddr); err != nil {
+			errs = append(errs, fmt.Errorf("tls.redirect_addr: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// buildTLSConfig loads or generates the server certificate and the client CA
+// pool described by c.
+func buildTLSConfig(c tlsConfig) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if c.Dev {
+		cert, err = selfSignedCert([]string{"localhost", "127.0.0.1", "::1"}, 24*time.Hour)
+	} else {
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tls certificate: %w", err)
+	}
+
+	tc := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls client CA: no certificates found in %s", c.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.ClientAuth == "optional" {
+			tc.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tc, nil
+}
+
+// selfSignedCert creates a throwaway ECDSA certificate for hosts. It is only
+// meant for local development; clients have to skip verification or trust
+// it explicitly.
+func selfSignedCert(hosts []string, ttl time.Duration) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Notes API dev"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// redirectToHTTPS sends every request to the same host and path on the
+// HTTPS listener at httpsAddr. The port is always spelled out, which keeps
+// IPv6 hosts bracketed.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		target := "https://" + net.JoinHostPort(host, port) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, tc := range []struct{ httpsAddr, host, want string }{
+		{":8443", "example.com", "https://example.com:8443/v1/notes?tag=a"},
+		{":8443", "example.com:80", "https://example.com:8443/v1/notes?tag=a"},
+		{":443", "example.com:80", "https://example.com:443/v1/notes?tag=a"},
+		{":443", "[::1]:80", "https://[::1]:443/v1/notes?tag=a"},
+		{":8443", "[::1]", "https://[::1]:8443/v1/notes?tag=a"},
+		{"0.0.0.0:8443", "192.0.2.1", "https://192.0.2.1:8443/v1/notes?tag=a"},
+	} {
+		req := httptest.NewRequest("GET", "/v1/notes?tag=a", nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tc.httpsAddr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tc.want {
+			t.Errorf("%s via %s = %d %q, want %q", tc.host, tc.httpsAddr, rec.Code, rec.Header().Get("Location"), tc.want)
+		}
+	}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	cert, err := selfSignedCert([]string{"localhost", "127.0.0.1", "::1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := cert.Leaf
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+	}
+	if err := leaf.VerifyHostname("example.com"); err == nil {
+		t.Error("valid for a host it was not made for")
+	}
+	if d := time.Until(leaf.NotAfter); d > time.Hour || d < 59*time.Minute {
+		t.Errorf("expires in %v, want an hour", d)
+	}
+}
+
+// writeCA writes a self-signed certificate as a PEM file to use as a
+// client CA.
+func writeCA(t *testing.T) string {
+	t.Helper()
+	ca, err := selfSignedCert([]string{"client-ca"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	tc, err := buildTLSConfig(tlsConfig{Dev: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.Certificates) != 1 || tc.MinVersion != tls.VersionTLS12 || tc.ClientAuth != tls.NoClientCert {
+		t.Errorf("dev config = %+v", tc)
+	}
+
+	ca := writeCA(t)
+	for clientAuth, want := range map[string]tls.ClientAuthType{
+		"":         tls.RequireAndVerifyClientCert,
+		"require":  tls.RequireAndVerifyClientCert,
+		"optional": tls.VerifyClientCertIfGiven,
+	} {
+		tc, err := buildTLSConfig(tlsConfig{Dev: true, ClientCAFile: ca, ClientAuth: clientAuth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.ClientAuth != want || tc.ClientCAs == nil {
+			t.Errorf("client_auth %q: ClientAuth = %v", clientAuth, tc.ClientAuth)
+		}
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	for name, c := range map[string]tlsConfig{
+		"missing cert":     {CertFile: "missing.pem", KeyFile: "missing-key.pem"},
+		"missing CA":       {Dev: true, ClientCAFile: "missing-ca.pem"},
+		"CA without certs": {Dev: true, ClientCAFile: empty},
+	} {
+		if _, err := buildTLSConfig(c); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/notes"
+	"goproject/internal/webhook"
+)
+
+// The stores are wrapped so that every call made for a request is a span
+// under the request's, named after the method it calls: handlers pass
+// their context instead of starting spans themselves. The wrappers embed
+// the store, so methods without a context are still there.
+
+// ─── notes ────────────────────────────────────────────────────────────────────
+
+// tracedNotes traces the notes.Store calls made by handlers. OnChange and
+// CountByUser are used outside requests and are not wrapped.
+type tracedNotes struct{ *notes.Store }
+
+func (s tracedNotes) Create(ctx context.Context, userID string, input notes.CreateInput) *notes.Note {
+	defer childSpan(ctx, "notes.Store.Create").End()
+	return s.Store.Create(userID, input)
+}
+
+func (s tracedNotes) Get(ctx context.Context, userID, noteID string) (*notes.Note, error) {
+	defer childSpan(ctx, "notes.Store.Get").End()
+	return s.Store.Get(userID, noteID)
+}
+
+func (s tracedNotes) List(ctx context.Context, userID string) []*notes.Note {
+	defer childSpan(ctx, "notes.Store.List").End()
+	return s.Store.List(userID)
+}
+
+func (s tracedNotes) Update(ctx context.Context, userID, noteID string, input notes.UpdateInput) (*notes.Note, error) {
+	defer childSpan(ctx, "notes.Store.Update").End()
+	return s.Store.Update(userID, noteID, input)
+}
+
+func (s tracedNotes) Replace(ctx context.Context, userID, noteID string, input notes.ReplaceInput) (*notes.Note, error) {
+	defer childSpan(ctx, "notes.Store.Replace").End()
+	return s.Store.Replace(userID, noteID, input)
+}
+
+func (s tracedNotes) Patch(ctx context.Context, userID, noteID string, fn func(notes.ReplaceInput) (notes.ReplaceInput, error)) (*notes.Note, error) {
+	defer childSpan(ctx, "notes.Store.Patch").End()
+	return s.Store.Patch(userID, noteID, fn)
+}
+
+func (s tracedNotes) Delete(ctx context.Context, userID, noteID string) error {
+	defer childSpan(ctx, "notes.Store.Delete").End()
+	return s.Store.Delete(userID, noteID)
+}
+
+func (s tracedNotes) DeleteUser(ctx context.Context, userID string) int {
+	defer childSpan(ctx, "notes.Store.DeleteUser").End()
+	return s.Store.DeleteUser(userID)
+}
+
+func (s tracedNotes) Move(ctx context.Context, userID, noteID string, input notes.MoveInput) (*notes.Note, error) {
+	defer childSpan(ctx, "notes.Store.Move").End()
+	return s.Store.Move(userID, noteID, input)
+}
+
+func (s tracedNotes) ChangesSince(ctx context.Context, userID string, since uint64, limit int) (notes.ChangeSet, error) {
+	defer childSpan(ctx, "notes.Store.ChangesSince").End()
+	return s.Store.ChangesSince(userID, since, limit)
+}
+
+func (s tracedNotes) Sync(ctx context.Context, userID string, muts []notes.Mutation) []notes.MutationResult {
+	defer childSpan(ctx, "notes.Store.Sync").End()
+	return s.Store.Sync(userID, muts)
+}
+
+// ─── users ────────────────────────────────────────────────────────────────────
+
+// tracedUsers traces the auth.UserStore calls made by handlers. Count is not
+// wrapped: it only feeds metrics and health checks.
+type tracedUsers struct{ *auth.UserStore }
+
+func (s tracedUsers) Register(ctx context.Context, username, password string) (*auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.Register").End()
+	return s.UserStore.Register(username, password)
+}
+
+func (s tracedUsers) Login(ctx context.Context, username, password string) (*auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.Login").End()
+	return s.UserStore.Login(username, password)
+}
+
+func (s tracedUsers) Get(ctx context.Context, id string) (auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.Get").End()
+	return s.UserStore.Get(id)
+}
+
+func (s tracedUsers) List(ctx context.Context) []auth.User {
+	defer childSpan(ctx, "auth.UserStore.List").End()
+	return s.UserStore.List()
+}
+
+func (s tracedUsers) SetRole(ctx context.Context, id string, role auth.Role) (auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.SetRole").End()
+	return s.UserStore.SetRole(id, role)
+}
+
+func (s tracedUsers) SetDisabled(ctx context.Context, id string, disabled bool) (auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.SetDisabled").End()
+	return s.UserStore.SetDisabled(id, disabled)
+}
+
+func (s tracedUsers) SetPassword(ctx context.Context, id, password string) (auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.SetPassword").End()
+	return s.UserStore.SetPassword(id, password)
+}
+
+func (s tracedUsers) Delete(ctx context.Context, id string) error {
+	defer childSpan(ctx, "auth.UserStore.Delete").End()
+	return s.UserStore.Delete(id)
+}
+
+func (s tracedUsers) Check(ctx context.Context, c *auth.Claims) error {
+	defer childSpan(ctx, "auth.UserStore.Check").End()
+	return s.UserStore.Check(c)
+}
+
+func (s tracedUsers) FindIdentity(ctx context.Context, issuer, subject string) (auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.FindIdentity").End()
+	return s.UserStore.FindIdentity(issuer, subject)
+}
+
+func (s tracedUsers) LinkIdentity(ctx context.Context, id, issuer, subject string) error {
+	defer childSpan(ctx, "auth.UserStore.LinkIdentity").End()
+	return s.UserStore.LinkIdentity(id, issuer, subject)
+}
+
+func (s tracedUsers) ProvisionIdentity(ctx context.Context, issuer, subject, hint string) (*auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.ProvisionIdentity").End()
+	return s.UserStore.ProvisionIdentity(issuer, subject, hint)
+}
+
+func (s tracedUsers) SetProfile(ctx context.Context, id string, p auth.Profile) (auth.User, error) {
+	defer childSpan(ctx, "auth.UserStore.SetProfile").End()
+	return s.UserStore.SetProfile(id, p)
+}
+
+func (s tracedUsers) CheckPassword(ctx context.Context, id, password string) error {
+	defer childSpan(ctx, "auth.UserStore.CheckPassword").End()
+	return s.UserStore.CheckPassword(id, password)
+}
+
+func (s tracedUsers) BeginTOTP(ctx context.Context, id string) ([]byte, error) {
+	defer childSpan(ctx, "auth.UserStore.BeginTOTP").End()
+	return s.UserStore.BeginTOTP(id)
+}
+
+func (s tracedUsers) ConfirmTOTP(ctx context.Context, id, code string) ([]string, error) {
+	defer childSpan(ctx, "auth.UserStore.ConfirmTOTP").End()
+	return s.UserStore.ConfirmTOTP(id, code)
+}
+
+func (s tracedUsers) CompleteChallenge(ctx context.Context, c *auth.Claims, code string) error {
+	defer childSpan(ctx, "auth.UserStore.CompleteChallenge").End()
+	return s.UserStore.CompleteChallenge(c, code)
+}
+
+func (s tracedUsers) DisableTOTP(ctx context.Context, id, code string) error {
+	defer childSpan(ctx, "auth.UserStore.DisableTOTP").End()
+	return s.UserStore.DisableTOTP(id, code)
+}
+
+// ─── tokens ───────────────────────────────────────────────────────────────────
+
+// tracedTokens traces the auth.TokenManager calls made by handlers.
+type tracedTokens struct{ *auth.TokenManager }
+
+func (s tracedTokens) CreateToken(ctx context.Context, user *auth.User, ttl time.Duration) (string, error) {
+	defer childSpan(ctx, "auth.TokenManager.CreateToken").End()
+	return s.TokenManager.CreateToken(user, ttl)
+}
+
+func (s tracedTokens) CreateChallenge(ctx context.Context, user *auth.User, ttl time.Duration) (string, error) {
+	defer childSpan(ctx, "auth.TokenManager.CreateChallenge").End()
+	return s.TokenManager.CreateChallenge(user, ttl)
+}
+
+func (s tracedTokens) ValidateToken(ctx context.Context, token string) (*auth.Claims, error) {
+	defer childSpan(ctx, "auth.TokenManager.ValidateToken").End()
+	return s.TokenManager.ValidateToken(token)
+}
+
+func (s tracedTokens) ValidateChallenge(ctx context.Context, token string) (*auth.Claims, error) {
+	defer childSpan(ctx, "auth.TokenManager.ValidateChallenge").End()
+	return s.TokenManager.ValidateChallenge(token)
+}
+
+// ─── apiKeys ──────────────────────────────────────────────────────────────────
+
+// tracedAPIKeys traces the auth.APIKeyStore calls made by handlers.
+type tracedAPIKeys struct{ *auth.APIKeyStore }
+
+func (s tracedAPIKeys) Create(ctx context.Context, userID, name string, scopes []auth.Scope, expiresAt time.Time) (auth.APIKey, string, error) {
+	defer childSpan(ctx, "auth.APIKeyStore.Create").End()
+	return s.APIKeyStore.Create(userID, name, scopes, expiresAt)
+}
+
+func (s tracedAPIKeys) List(ctx context.Context, userID string) []auth.APIKey {
+	defer childSpan(ctx, "auth.APIKeyStore.List").End()
+	return s.APIKeyStore.List(userID)
+}
+
+func (s tracedAPIKeys) Delete(ctx context.Context, userID, id string) error {
+	defer childSpan(ctx, "auth.APIKeyStore.Delete").End()
+	return s.APIKeyStore.Delete(userID, id)
+}
+
+func (s tracedAPIKeys) DeleteUser(ctx context.Context, userID string) {
+	defer childSpan(ctx, "auth.APIKeyStore.DeleteUser").End()
+	s.APIKeyStore.DeleteUser(userID)
+}
+
+func (s tracedAPIKeys) Authenticate(ctx context.Context, plain string) (auth.APIKey, error) {
+	defer childSpan(ctx, "auth.APIKeyStore.Authenticate").End()
+	return s.APIKeyStore.Authenticate(plain)
+}
+
+// ─── webhooks ─────────────────────────────────────────────────────────────────
+
+// tracedWebhooks traces the webhook.Dispatcher calls made by handlers.
+// Publish and Close run outside requests and are not wrapped.
+type tracedWebhooks struct{ *webhook.Dispatcher }
+
+func (s tracedWebhooks) Create(ctx context.Context, userID, rawURL string, events []string) (webhook.Webhook, error) {
+	defer childSpan(ctx, "webhook.Dispatcher.Create").End()
+	return s.Dispatcher.Create(userID, rawURL, events)
+}
+
+func (s tracedWebhooks) List(ctx context.Context, userID string) []webhook.Webhook {
+	defer childSpan(ctx, "webhook.Dispatcher.List").End()
+	return s.Dispatcher.List(userID)
+}
+
+func (s tracedWebhooks) Get(ctx context.Context, userID, id string) (webhook.Webhook, error) {
+	defer childSpan(ctx, "webhook.Dispatcher.Get").End()
+	return s.Dispatcher.Get(userID, id)
+}
+
+func (s tracedWebhooks) Update(ctx context.Context, userID, id, rawURL string, events []string, active bool) (webhook.Webhook, error) {
+	defer childSpan(ctx, "webhook.Dispatcher.Update").End()
+	return s.Dispatcher.Update(userID, id, rawURL, events, active)
+}
+
+func (s tracedWebhooks) RotateSecret(ctx context.Context, userID, id string) (webhook.Webhook, error) {
+	defer childSpan(ctx, "webhook.Dispatcher.RotateSecret").End()
+	return s.Dispatcher.RotateSecret(userID, id)
+}
+
+func (s tracedWebhooks) Delete(ctx context.Context, userID, id string) error {
+	defer childSpan(ctx, "webhook.Dispatcher.Delete").End()
+	return s.Dispatcher.Delete(userID, id)
+}
+
+func (s tracedWebhooks) Deliveries(ctx context.Context, userID, id string) ([]webhook.Delivery, error) {
+	defer childSpan(ctx, "webhook.Dispatcher.Deliveries").End()
+	return s.Dispatcher.Deliveries(userID, id)
+}
+
+func (s tracedWebhooks) Redeliver(ctx context.Context, userID, id, deliveryID string) (webhook.Delivery, error) {
+	defer childSpan(ctx, "webhook.Dispatcher.Redeliver").End()
+	return s.Dispatcher.Redeliver(userID, id, deliveryID)
+}
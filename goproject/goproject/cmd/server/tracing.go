@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"goproject/internal/trace"
+)
+
+// tracingConfig selects where spans go. Exporter is "none", "stdout", "file"
+// (OTLP JSON lines appended to File) or "otlp" (OTLP/HTTP JSON posted to
+// Endpoint, e.g. http://localhost:4318/v1/traces).
+type tracingConfig struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	File        string  `json:"file"`
+	ServiceName string  `json:"service_name"`
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+func defaultTracingConfig() tracingConfig {
+	return tracingConfig{
+		Exporter:    "none",
+		Endpoint:    "http://localhost:4318/v1/traces",
+		ServiceName: "notes-api",
+		SampleRatio: 1,
+	}
+}
+
+func (c tracingConfig) validate() error {
+	switch c.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.File == "" {
+			return fmt.Errorf("tracing.file: required when exporter is file")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter: must be none, stdout, file or otlp, got %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio: must be between 0 and 1")
+	}
+	return nil
+}
+
+// tracer is nil when tracing is off; spans from a nil tracer are no-ops.
+var tracer *trace.Tracer
+
+// newTracer builds the tracer described by c and registers its flush on
+// shutdown. Trace context is still propagated with exporter "none", so
+// upstream traces are not broken.
+func newTracer(c tracingConfig) (*trace.Tracer, error) {
+	var exp trace.Exporter
+	var closeFile func(context.Context) error
+	switch c.Exporter {
+	case "stdout":
+		exp = trace.NewWriterExporter(os.Stdout)
+	case "file":
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		closeFile = func(context.Context) error { return f.Close() }
+		exp = trace.NewWriterExporter(f)
+	case "otlp":
+		exp = trace.NewHTTPExporter(c.Endpoint)
+	}
+	t := trace.NewTracer(c.ServiceName, c.SampleRatio, exp)
+	t.SetErrorHandler(func(err error) { logger.Warn("trace export failed", "error", err) })
+	onShutdown(t.Shutdown)
+	if closeFile != nil {
+		onShutdown(closeFile)
+	}
+	return t, nil
+}
+
+// withTracing starts a server span per request, continuing the caller's
+// trace if a valid traceparent header was sent. It must run outside the
+// router so the span can be named after the matched route.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := trace.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = trace.ContextWithRemoteParent(ctx, sc)
+		}
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method, trace.KindServer)
+		defer span.End()
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("request.id", requestID(ctx))
+
+		sw := &spanWriter{statusWriter: statusWriter{ResponseWriter: w}, ctx: ctx}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		info := infoFrom(ctx)
+		if info.route != "" {
+			span.SetName(info.route)
+			_, path, _ := strings.Cut(info.route, " ")
+			span.SetAttr("http.route", path)
+		}
+		if info.userID != "" {
+			span.SetAttr("enduser.id", info.userID)
+		}
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttr("http.response.status_code", status)
+		if status >= 500 {
+			span.SetError(fmt.Errorf("HTTP %d", status))
+		}
+	})
+}
+
+// spanWriter carries the request's trace context down to writeJSON, which
+// only sees the ResponseWriter.
+type spanWriter struct {
+	statusWriter
+	ctx context.Context
+}
+
+// spanContextOf finds the trace context attached to w by withTracing,
+// looking through any writers wrapped around it.
+func spanContextOf(w http.ResponseWriter) (context.Context, bool) {
+	for w != nil {
+		if sw, ok := w.(*spanWriter); ok {
+			return sw.ctx, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return nil, false
+}
+
+// encodeJSON writes v followed by a newline, timing the encoding as a child
+// span of the request.
+func encodeJSON(w http.ResponseWriter, v any) {
+	var span *trace.Span
+	if ctx, ok := spanContextOf(w); ok {
+		_, span = tracer.Start(ctx, "json.encode", trace.KindInternal)
+	}
+	b, err := json.Marshal(v)
+	span.SetAttr("json.bytes", len(b))
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return
+	}
+	w.Write(append(b, '\n'))
+}
+
+// childSpan starts an internal span under the one in ctx. The traced
+// store wrappers start one per call, named after the method.
+func childSpan(ctx context.Context, name string) *trace.Span {
+	_, span := tracer.Start(ctx, name, trace.KindInternal)
+	return span
+}
+
+// traceID returns the current trace ID for log correlation, or "".
+func traceID(ctx context.Context) string {
+	sc := trace.SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
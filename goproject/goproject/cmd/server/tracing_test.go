@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"goproject/internal/trace"
+)
+
+type memExporter struct {
+	mu    sync.Mutex
+	spans strings.Builder
+}
+
+func (m *memExporter) Export(_ context.Context, b []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans.Write(b)
+	return nil
+}
+
+func TestStoreCallsAreTraced(t *testing.T) {
+	exp := &memExporter{}
+	saved := tracer
+	tracer = trace.NewTracer("notes-test", 1, exp)
+	t.Cleanup(func() { tracer = saved })
+	newTestServer(t) // for the token manager and limits
+	srv := httptest.NewServer(chain(newRouter(), withTracing, withRequestID))
+	defer srv.Close()
+
+	token := registerToken(t, srv, "traced")
+	call(t, srv, token, "POST", "/v1/webhooks", `{"url":"https://example.com/hook","events":["note.created"]}`)
+	call(t, srv, token, "POST", "/graphql", `{"query":"mutation { createNote(input: {title: \"t\"}) { id } }"}`)
+	tracer.Shutdown(context.Background())
+
+	for _, name := range []string{
+		"auth.UserStore.Register", "auth.TokenManager.CreateToken", "auth.TokenManager.ValidateToken",
+		"auth.UserStore.Check", "webhook.Dispatcher.Create", "notes.Store.Create",
+	} {
+		if !strings.Contains(exp.spans.String(), `"name":"`+name+`"`) {
+			t.Errorf("no %s span", name)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/validation"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps.
+	totpIssuer = "Notes API"
+	// challengeTTL bounds the time between the two steps of a 2FA login.
+	challengeTTL = 5 * time.Minute
+)
+
+// ─── wire types ───────────────────────────────────────────────────────────────
+
+type loginChallengeV1 struct {
+	Message   string    `json:"message"`
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type challengeInputV1 struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"` // TOTP or recovery code
+}
+
+type codeInputV1 struct {
+	Code string `json:"code"`
+}
+
+type totpSetupV1 struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type recoveryCodesV1 struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ─── handlers ─────────────────────────────────────────────────────────────────
+
+// writeChallenge answers a correct password for an account with 2FA.
+func writeChallenge(w http.ResponseWriter, r *http.Request, user *auth.User) {
+	challenge, _ := tokens.CreateChallenge(r.Context(), user, challengeTTL)
+	writeJSON(w, http.StatusAccepted, loginChallengeV1{
+		Message:   "two-factor code required",
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(challengeTTL),
+	})
+}
+
+// handleLoginTwoFactor exchanges a challenge and a code for a token. Each
+// challenge is good for one token. Wrong codes lock the account out like
+// wrong passwords do.
+func handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var body challengeInputV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	claims, err := tokens.ValidateChallenge(r.Context(), body.Challenge)
+	if err == nil {
+		err = users.Check(r.Context(), claims)
+	}
+	if err != nil {
+		authResult("login_2fa", false)
+		errJSON(w, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+
+	key := "2fa:" + claims.UserID
+	if locked, wait := limits.loginBackoff.Locked(key); locked {
+		errTooManyRequests(w, wait)
+		return
+	}
+	err = users.CompleteChallenge(r.Context(), claims, body.Code)
+	authResult("login_2fa", err == nil)
+	if err == auth.ErrChallengeUsed {
+		errJSON(w, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+	if err == auth.ErrInvalidCode {
+		if wait := limits.loginBackoff.Fail(key); wait > 0 {
+			errTooManyRequests(w, wait)
+			return
+		}
+	}
+	if err != nil {
+		errJSON(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+	limits.loginBackoff.Reset(key)
+
+	user, err := users.Get(r.Context(), claims.UserID)
+	if err != nil {
+		errJSON(w, http.StatusUnauthorized, "invalid or expired challenge")
+		return
+	}
+	token, _ := tokens.CreateToken(r.Context(), &user, cfg.Auth.TokenTTL.Duration)
+	writeJSON(w, http.StatusOK, authResponseV1{Token: token, User: newUserV1(&user)})
+}
+
+// errTwoFactor maps 2FA errors to responses.
+func errTwoFactor(w http.ResponseWriter, err error) {
+	switch err {
+	case auth.ErrInvalidCode:
+		errInput(w, validation.Field("code", err.Error()))
+	case auth.ErrTOTPEnabled, auth.ErrTOTPNotEnabled, auth.ErrTOTPNotPending:
+		errJSON(w, http.StatusConflict, err.Error())
+	case auth.ErrUserNotFound:
+		errJSON(w, http.StatusUnauthorized, "unauthorized")
+	default:
+		errJSON(w, http.StatusInternalServerError, "could not update two-factor authentication")
+	}
+}
+
+// handleSetupTOTP starts enrollment. Calling it again before confirming
+// replaces the secret.
+func handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	secret, err := users.BeginTOTP(r.Context(), claims.UserID)
+	if err != nil {
+		errTwoFactor(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, totpSetupV1{
+		Secret:     auth.TOTPSecretString(secret),
+		OTPAuthURI: auth.TOTPURI(totpIssuer, claims.Username, secret),
+	})
+}
+
+func handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var body codeInputV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	codes, err := users.ConfirmTOTP(r.Context(), claims.UserID, body.Code)
+	if err != nil {
+		errTwoFactor(w, err)
+		return
+	}
+	loggerFrom(r.Context()).Info("two-factor authentication enabled", "user_id", claims.UserID)
+	writeJSON(w, http.StatusOK, recoveryCodesV1{RecoveryCodes: codes})
+}
+
+// handleDisableTOTP turns 2FA off. Wrong codes count towards the same
+// lockout as a 2FA login, so a stolen token cannot guess its way through.
+func handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var body codeInputV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	key := "2fa:" + claims.UserID
+	if locked, wait := limits.loginBackoff.Locked(key); locked {
+		errTooManyRequests(w, wait)
+		return
+	}
+	err := users.DisableTOTP(r.Context(), claims.UserID, body.Code)
+	if err == auth.ErrInvalidCode {
+		if wait := limits.loginBackoff.Fail(key); wait > 0 {
+			errTooManyRequests(w, wait)
+			return
+		}
+	}
+	if err != nil {
+		errTwoFactor(w, err)
+		return
+	}
+	limits.loginBackoff.Reset(key)
+	loggerFrom(r.Context()).Info("two-factor authentication disabled", "user_id", claims.UserID)
+	writeJSON(w, http.StatusOK, messageV1{Message: "two-factor authentication disabled"})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"goproject/internal/auth"
+)
+
+// totpNow returns the current code for the secret a setup response holds.
+func totpNow(t *testing.T, setup map[string]any) string {
+	t.Helper()
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setup["secret"].(string))
+	if err != nil {
+		t.Fatalf("setup = %v", setup)
+	}
+	return auth.TOTPCode(secret, time.Now())
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "careful")
+	creds := `{"username":"careful","password":"secret123"}`
+
+	setup := call(t, srv, token, "POST", "/v1/auth/2fa/setup", "")
+	if uri, _ := setup["otpauth_uri"].(string); uri == "" {
+		t.Fatalf("setup = %v", setup)
+	}
+	if got := call(t, srv, token, "POST", "/v1/auth/2fa/confirm", `{"code":"000000x"}`); got["status"] != 422.0 {
+		t.Errorf("confirm with a bad code = %v", got)
+	}
+	if login := call(t, srv, "", "POST", "/v1/auth/login", creds); login["token"] == nil {
+		t.Errorf("login before confirmation = %v", login)
+	}
+	confirmed := call(t, srv, token, "POST", "/v1/auth/2fa/confirm", `{"code":"`+totpNow(t, setup)+`"}`)
+	recovery, _ := confirmed["recovery_codes"].([]any)
+	if len(recovery) != auth.RecoveryCodes {
+		t.Fatalf("confirm = %v", confirmed)
+	}
+
+	// The password alone now only gets a challenge, which is not a token.
+	login := call(t, srv, "", "POST", "/v1/auth/login", creds)
+	challenge, _ := login["challenge"].(string)
+	if challenge == "" || login["token"] != nil {
+		t.Fatalf("login with 2FA = %v", login)
+	}
+	if got := call(t, srv, challenge, "GET", "/v1/notes", ""); got["status"] != 401.0 {
+		t.Errorf("challenge used as a token = %v", got)
+	}
+	if got := call(t, srv, "", "POST", "/v1/auth/login/2fa", `{"challenge":"`+challenge+`","code":"111111"}`); got["status"] != 401.0 {
+		t.Errorf("wrong code = %v", got)
+	}
+	done := call(t, srv, "", "POST", "/v1/auth/login/2fa", `{"challenge":"`+challenge+`","code":"`+recovery[0].(string)+`"}`)
+	if done["token"] == nil || done["user"].(map[string]any)["two_factor"] != true {
+		t.Fatalf("login with a recovery code = %v", done)
+	}
+	if got := call(t, srv, "", "POST", "/v1/auth/login/2fa", `{"challenge":"`+challenge+`","code":"`+recovery[0].(string)+`"}`); got["status"] != 401.0 {
+		t.Errorf("reused recovery code = %v", got)
+	}
+	if got := call(t, srv, "", "POST", "/v1/auth/login/2fa", `{"challenge":"`+challenge+`","code":"`+recovery[2].(string)+`"}`); got["status"] != 401.0 {
+		t.Errorf("replayed challenge = %v", got)
+	}
+
+	call(t, srv, done["token"].(string), "POST", "/v1/auth/2fa/disable", `{"code":"`+recovery[1].(string)+`"}`)
+	if login := call(t, srv, "", "POST", "/v1/auth/login", creds); login["token"] == nil {
+		t.Errorf("login after disabling 2FA = %v", login)
+	}
+}
+
+func TestDisableTwoFactorLockout(t *testing.T) {
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "stolen")
+	setup := call(t, srv, token, "POST", "/v1/auth/2fa/setup", "")
+	call(t, srv, token, "POST", "/v1/auth/2fa/confirm", `{"code":"`+totpNow(t, setup)+`"}`)
+
+	// A stolen token gets a few guesses at the code, then is locked out
+	// even with the right one.
+	lockoutAfter := defaultRateLimitConfig().LockoutAfter
+	for i := range lockoutAfter - 1 {
+		if got := call(t, srv, token, "POST", "/v1/auth/2fa/disable", `{"code":"000000"}`); got["status"] != 422.0 {
+			t.Fatalf("guess %d = %v", i, got)
+		}
+	}
+	if got := call(t, srv, token, "POST", "/v1/auth/2fa/disable", `{"code":"000000"}`); got["status"] != 429.0 {
+		t.Fatalf("guess %d = %v", lockoutAfter, got)
+	}
+	if got := call(t, srv, token, "POST", "/v1/auth/2fa/disable", `{"code":"`+totpNow(t, setup)+`"}`); got["status"] != 429.0 {
+		t.Errorf("right code while locked = %v", got)
+	}
+	if me := call(t, srv, token, "GET", "/v1/me", ""); me["two_factor"] != true {
+		t.Errorf("2FA disabled during a lockout: %v", me)
+	}
+}
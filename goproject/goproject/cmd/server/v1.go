@@ -0,0 +1,498 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/jsonpatch"
+	"goproject/internal/notes"
+	"goproject/internal/validation"
+)
+
+// v1Routes returns version 1 of the API, relative to its mount point. Handlers
+// talk to the shared stores and translate results into the v1 wire types
+// below; the store input types double as v1 request bodies. A later version
+// gets its own route table and DTOs on top of the same stores.
+func v1Routes() []route {
+	return []route{
+		{http.MethodPost, "/auth/register", throttleAuth(handleRegister)},
+		{http.MethodPost, "/auth/login", throttleAuth(handleLogin)},
+		{http.MethodPost, "/auth/login/2fa", limitBy(limits.perIP, clientIP)(handleLoginTwoFactor)},
+		{http.MethodPost, "/auth/2fa/setup", withAuth(handleSetupTOTP)},
+		{http.MethodPost, "/auth/2fa/confirm", withAuth(handleConfirmTOTP)},
+		{http.MethodPost, "/auth/2fa/disable", limitBy(limits.perIP, clientIP)(withAuth(handleDisableTOTP))},
+		{http.MethodGet, "/auth/oidc/login", limitBy(limits.perIP, clientIP)(handleOIDCLogin)},
+		{http.MethodGet, "/auth/oidc/callback", handleOIDCCallback},
+		{http.MethodPost, "/auth/oidc/link", withAuth(handleOIDCLink)},
+
+		{http.MethodGet, "/me", withAuth(handleGetMe)},
+		{http.MethodPut, "/me", withAuth(handleUpdateMe)},
+		{http.MethodPut, "/me/password", withAuth(handleChangePassword)},
+		{http.MethodDelete, "/me", withAuth(handleDeleteMe)},
+
+		{http.MethodGet, "/notes", withScope(auth.ScopeNotesRead, handleListNotes)},
+		{http.MethodPost, "/notes", withScope(auth.ScopeNotesWrite, handleCreateNote)},
+		{http.MethodGet, "/notes/{id}", withScope(auth.ScopeNotesRead, handleGetNote)},
+		{http.MethodPut, "/notes/{id}", withScope(auth.ScopeNotesWrite, handleReplaceNote)},
+		{http.MethodPatch, "/notes/{id}", withScope(auth.ScopeNotesWrite, handlePatchNote)},
+		{http.MethodDelete, "/notes/{id}", withScope(auth.ScopeNotesWrite, handleDeleteNote)},
+		{http.MethodPost, "/notes/{id}/move", withScope(auth.ScopeNotesWrite, handleMoveNote)},
+		{http.MethodGet, "/events", withEventsAuth(handleEvents)},
+		{http.MethodPost, "/events/ticket", withScope(auth.ScopeNotesRead, handleEventsTicket)},
+		{http.MethodGet, "/sync", withScope(auth.ScopeNotesRead, handleSyncPull)},
+		{http.MethodPost, "/sync", withScope(auth.ScopeNotesWrite, handleSyncPush)},
+
+		{http.MethodGet, "/webhooks", withScope(auth.ScopeWebhooksRead, handleListWebhooks)},
+		{http.MethodPost, "/webhooks", withScope(auth.ScopeWebhooksWrite, handleCreateWebhook)},
+		{http.MethodGet, "/webhooks/{id}", withScope(auth.ScopeWebhooksRead, handleGetWebhook)},
+		{http.MethodPut, "/webhooks/{id}", withScope(auth.ScopeWebhooksWrite, handleUpdateWebhook)},
+		{http.MethodDelete, "/webhooks/{id}", withScope(auth.ScopeWebhooksWrite, handleDeleteWebhook)},
+		{http.MethodPost, "/webhooks/{id}/secret", withScope(auth.ScopeWebhooksWrite, handleRotateWebhookSecret)},
+		{http.MethodGet, "/webhooks/{id}/deliveries", withScope(auth.ScopeWebhooksRead, handleListDeliveries)},
+		{http.MethodPost, "/webhooks/{id}/deliveries/{delivery}/redeliver", withScope(auth.ScopeWebhooksWrite, handleRedeliver)},
+
+		{http.MethodGet, "/api-keys", withAuth(handleListAPIKeys)},
+		{http.MethodPost, "/api-keys", withAuth(handleCreateAPIKey)},
+		{http.MethodDelete, "/api-keys/{id}", withAuth(handleDeleteAPIKey)},
+	}
+}
+
+// v1Docs describes each entry of v1Routes for the OpenAPI document.
+var v1Docs = map[string]operation{
+	"POST /auth/register": {
+		id: "register", tag: "auth", summary: "Create an account and get a token",
+		request:   jsonBody(credentialsV1{}),
+		responses: map[int]any{201: authResponseV1{}, 409: problem{}, 429: problem{}},
+	},
+	"POST /auth/login": {
+		id: "login", tag: "auth", summary: "Exchange credentials for a token. " +
+			"Accounts with two-factor authentication get 202 and a challenge to send to /v1/auth/login/2fa instead.",
+		request:   jsonBody(credentialsV1{}),
+		responses: map[int]any{200: authResponseV1{}, 202: loginChallengeV1{}, 401: problem{}, 403: problem{}, 429: problem{}},
+	},
+	"POST /auth/login/2fa": {
+		id: "loginTwoFactor", tag: "auth", summary: "Exchange a login challenge and a TOTP or recovery code for a token. Each challenge completes one login.",
+		request:   jsonBody(challengeInputV1{}),
+		responses: map[int]any{200: authResponseV1{}, 401: problem{}, 429: problem{}},
+	},
+	"GET /auth/oidc/login": {
+		id: "oidcLogin", tag: "auth", summary: "Log in with the configured OpenID Connect provider: redirects there with PKCE",
+		responses: map[int]any{302: nil, 404: problem{}, 429: problem{}, 503: problem{}},
+	},
+	"GET /auth/oidc/callback": {
+		id: "oidcCallback", tag: "auth",
+		summary: "Where the provider sends the browser back with ?code= and ?state=. Needs the cookie set when the " +
+			"flow began, and to confirm a link also the linking user's token. Answers like login; " +
+			"201 means an account was created for a first login.",
+		responses: map[int]any{
+			200: authResponseV1{}, 201: authResponseV1{}, 202: loginChallengeV1{},
+			400: problem{}, 401: problem{}, 403: problem{}, 409: problem{}, 503: problem{},
+		},
+	},
+	"POST /auth/oidc/link": {
+		id: "oidcLink", tag: "auth", auth: true,
+		summary:   "Start linking a provider identity to your account; send the browser to the returned URL",
+		responses: map[int]any{200: oidcLinkV1{}, 404: problem{}, 503: problem{}},
+	},
+	"POST /auth/2fa/setup": {
+		id: "setupTOTP", tag: "auth", auth: true,
+		summary:   "Start two-factor enrollment: add the secret or otpauth URI to an authenticator app, then confirm with a code",
+		responses: map[int]any{200: totpSetupV1{}, 409: problem{}},
+	},
+	"POST /auth/2fa/confirm": {
+		id: "confirmTOTP", tag: "auth", auth: true,
+		summary: "Enable two-factor authentication with a first code. " +
+			"The response holds one-time recovery codes, which are not shown again.",
+		request:   jsonBody(codeInputV1{}),
+		responses: map[int]any{200: recoveryCodesV1{}, 409: problem{}},
+	},
+	"POST /auth/2fa/disable": {
+		id: "disableTOTP", tag: "auth", summary: "Disable two-factor authentication with a TOTP or recovery code", auth: true,
+		request:   jsonBody(codeInputV1{}),
+		responses: map[int]any{200: messageV1{}, 409: problem{}, 429: problem{}},
+	},
+	"GET /me": {
+		id: "getMe", tag: "account", summary: "Get your account and profile", auth: true,
+		responses: map[int]any{200: meV1{}},
+	},
+	"PUT /me": {
+		id: "updateMe", tag: "account", summary: "Replace your profile; omitted fields are cleared", auth: true,
+		request:   jsonBody(profileInputV1{}),
+		responses: map[int]any{200: meV1{}},
+	},
+	"PUT /me/password": {
+		id: "changePassword", tag: "account", auth: true,
+		summary:   "Change your password. Every existing token and API key is revoked; the response holds a new token.",
+		request:   jsonBody(passwordChangeV1{}),
+		responses: map[int]any{200: authResponseV1{}, 429: problem{}},
+	},
+	"DELETE /me": {
+		id: "deleteMe", tag: "account", auth: true,
+		summary:   "Delete your account with its notes, webhooks and API keys. Confirm with your username and password.",
+		request:   jsonBody(accountDeletionV1{}),
+		responses: map[int]any{200: messageV1{}, 429: problem{}},
+	},
+	"GET /notes": {
+		id: "listNotes", tag: "notes", summary: "List your notes, pinned first, in position order", auth: true, scope: auth.ScopeNotesRead,
+		responses: map[int]any{200: noteListV1{}},
+	},
+	"POST /notes": {
+		id: "createNote", tag: "notes", summary: "Create a note", auth: true, scope: auth.ScopeNotesWrite,
+		request:   jsonBody(notes.CreateInput{}),
+		responses: map[int]any{201: noteV1{}},
+	},
+	"GET /notes/{id}": {
+		id: "getNote", tag: "notes", summary: "Get a note", auth: true, scope: auth.ScopeNotesRead,
+		responses: map[int]any{200: noteV1{}, 403: problem{}, 404: problem{}},
+	},
+	"PUT /notes/{id}": {
+		id: "replaceNote", tag: "notes", summary: "Replace every editable field of a note", auth: true, scope: auth.ScopeNotesWrite,
+		request:   jsonBody(notes.ReplaceInput{}),
+		responses: map[int]any{200: noteV1{}, 403: problem{}, 404: problem{}},
+	},
+	"PATCH /notes/{id}": {
+		id: "patchNote", tag: "notes", summary: "Update a note with a JSON merge patch or a JSON Patch", auth: true, scope: auth.ScopeNotesWrite,
+		request: map[string]any{
+			jsonpatch.MergePatchType: notes.UpdateInput{},
+			jsonpatch.JSONPatchType:  []patchOperation{},
+		},
+		responses: map[int]any{200: noteV1{}, 403: problem{}, 404: problem{}, 409: problem{}, 415: problem{}},
+	},
+	"DELETE /notes/{id}": {
+		id: "deleteNote", tag: "notes", summary: "Delete a note", auth: true, scope: auth.ScopeNotesWrite,
+		responses: map[int]any{200: messageV1{}, 403: problem{}, 404: problem{}},
+	},
+	"POST /notes/{id}/move": {
+		id: "moveNote", tag: "notes", summary: "Move a note directly before or after another one", auth: true, scope: auth.ScopeNotesWrite,
+		request:   jsonBody(notes.MoveInput{}),
+		responses: map[int]any{200: noteV1{}, 403: problem{}, 404: problem{}},
+	},
+	"GET /events": {
+		id: "streamEvents", tag: "notes",
+		summary: "Stream note changes as Server-Sent Events, or after a WebSocket upgrade as text messages holding the same JSON as the SSE data lines. " +
+			"Resume with Last-Event-ID or ?last_event_id=. Clients that cannot set the Authorization header pass ?ticket= instead.",
+		auth: true, scope: auth.ScopeNotesRead,
+		responses: map[int]any{101: nil, 200: rawBody("text/event-stream"), 400: problem{}, 426: problem{}},
+	},
+	"POST /events/ticket": {
+		id: "createEventsTicket", tag: "notes",
+		summary: "Get a single-use ticket, valid for 30 seconds, for opening GET /events with ?ticket= " +
+			"from browser EventSource and WebSocket clients, which cannot set the Authorization header.",
+		auth: true, scope: auth.ScopeNotesRead,
+		responses: map[int]any{201: eventsTicketV1{}, 503: problem{}},
+	},
+	"GET /sync": {
+		id: "syncPull", tag: "sync",
+		summary: "Get notes changed and deleted since ?since=, the sync_token of an earlier pull; omit it for a full sync. " +
+			"Page with has_more. 410 means the token is unknown or older than the 30-day retention of deletions, and the client must sync from scratch.",
+		auth: true, scope: auth.ScopeNotesRead,
+		responses: map[int]any{200: syncPullV1{}, 400: problem{}, 410: problem{}},
+	},
+	"POST /sync": {
+		id: "syncPush", tag: "sync",
+		summary: "Apply offline edits in order. Updates and deletes carry the base_version they were made on; " +
+			"concurrent edits of different fields merge, and edits of the same field go to the later updated_at.",
+		auth: true, scope: auth.ScopeNotesWrite,
+		request:   jsonBody(syncPushV1{}),
+		responses: map[int]any{200: syncPushResultV1{}},
+	},
+	"GET /webhooks": {
+		id: "listWebhooks", tag: "webhooks", summary: "List your webhooks", auth: true, scope: auth.ScopeWebhooksRead,
+		responses: map[int]any{200: webhookListV1{}},
+	},
+	"POST /webhooks": {
+		id: "createWebhook", tag: "webhooks", auth: true, scope: auth.ScopeWebhooksWrite,
+		summary: "Register a URL for note.created, note.updated, note.done and/or note.deleted events. " +
+			"The response holds the signing secret, which is not shown again; rotate it if lost.",
+		request:   jsonBody(webhookInputV1{}),
+		responses: map[int]any{201: webhookV1{}, 409: problem{}},
+	},
+	"GET /webhooks/{id}": {
+		id: "getWebhook", tag: "webhooks", summary: "Get a webhook", auth: true, scope: auth.ScopeWebhooksRead,
+		responses: map[int]any{200: webhookV1{}, 404: problem{}},
+	},
+	"PUT /webhooks/{id}": {
+		id: "updateWebhook", tag: "webhooks", summary: "Change a webhook; setting active re-enables a disabled one", auth: true, scope: auth.ScopeWebhooksWrite,
+		request:   jsonBody(webhookUpdateV1{}),
+		responses: map[int]any{200: webhookV1{}, 404: problem{}},
+	},
+	"DELETE /webhooks/{id}": {
+		id: "deleteWebhook", tag: "webhooks", summary: "Delete a webhook and its delivery log", auth: true, scope: auth.ScopeWebhooksWrite,
+		responses: map[int]any{200: messageV1{}, 404: problem{}},
+	},
+	"POST /webhooks/{id}/secret": {
+		id: "rotateWebhookSecret", tag: "webhooks", auth: true, scope: auth.ScopeWebhooksWrite,
+		summary: "Replace the signing secret. The response holds the new secret, which is not shown again; " +
+			"every attempt from now on, including retries of earlier deliveries, is signed with it.",
+		responses: map[int]any{200: webhookV1{}, 404: problem{}},
+	},
+	"GET /webhooks/{id}/deliveries": {
+		id: "listDeliveries", tag: "webhooks", summary: "Recent deliveries of a webhook, newest first, with every attempt", auth: true, scope: auth.ScopeWebhooksRead,
+		responses: map[int]any{200: deliveryListV1{}, 404: problem{}},
+	},
+	"POST /webhooks/{id}/deliveries/{delivery}/redeliver": {
+		id: "redeliver", tag: "webhooks", summary: "Send a logged delivery's payload again", auth: true, scope: auth.ScopeWebhooksWrite,
+		responses: map[int]any{202: deliveryV1{}, 404: problem{}, 409: problem{}, 503: problem{}},
+	},
+	"GET /api-keys": {
+		id: "listAPIKeys", tag: "auth", summary: "List your API keys, newest first", auth: true,
+		responses: map[int]any{200: apiKeyListV1{}},
+	},
+	"POST /api-keys": {
+		id: "createAPIKey", tag: "auth", auth: true,
+		summary: "Create an API key limited to scopes, with an optional expiry. Send it as a bearer token. " +
+			"The response holds the key, which is not shown again.",
+		request:   jsonBody(apiKeyInputV1{}),
+		responses: map[int]any{201: apiKeyV1{}, 409: problem{}},
+	},
+	"DELETE /api-keys/{id}": {
+		id: "deleteAPIKey", tag: "auth", summary: "Revoke an API key", auth: true,
+		responses: map[int]any{200: messageV1{}, 404: problem{}},
+	},
+}
+
+// ─── v1 wire types ────────────────────────────────────────────────────────────
+
+type noteV1 struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Done      bool           `json:"done"`
+	Priority  notes.Priority `json:"priority"`
+	Tags      []string       `json:"tags"`
+	Pinned    bool           `json:"pinned"`
+	Position  string         `json:"position"`
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+func newNoteV1(n *notes.Note) noteV1 {
+	return noteV1{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Title:     n.Title,
+		Body:      n.Body,
+		Done:      n.Done,
+		Priority:  n.Priority,
+		Tags:      n.Tags,
+		Pinned:    n.Pinned,
+		Position:  n.Position,
+		Version:   n.Version,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+}
+
+type userV1 struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Role      auth.Role `json:"role"`
+	TwoFactor bool      `json:"two_factor"`
+}
+
+func newUserV1(u *auth.User) userV1 {
+	return userV1{ID: u.ID, Username: u.Username, Role: u.Role, TwoFactor: u.TwoFactorEnabled()}
+}
+
+type credentialsV1 struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type authResponseV1 struct {
+	Message string `json:"message,omitempty"`
+	Token   string `json:"token"`
+	User    userV1 `json:"user"`
+}
+
+type noteListV1 struct {
+	Notes []noteV1 `json:"notes"`
+	Count int      `json:"count"`
+}
+
+type messageV1 struct {
+	Message string `json:"message"`
+}
+
+// ─── v1 handlers ──────────────────────────────────────────────────────────────
+
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	var body credentialsV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+	var verr validation.Error
+	if body.Username == "" {
+		verr.Add("username", "is required")
+	}
+	if body.Password == "" {
+		verr.Add("password", "is required")
+	}
+	if err := verr.Err(); err != nil {
+		errInput(w, err)
+		return
+	}
+
+	user, err := users.Register(r.Context(), body.Username, body.Password)
+	authResult("register", err == nil)
+	if err == auth.ErrUserExists {
+		errJSON(w, http.StatusConflict, "username already taken")
+		return
+	}
+	if err != nil {
+		errJSON(w, http.StatusInternalServerError, "registration failed")
+		return
+	}
+
+	token, _ := tokens.CreateToken(r.Context(), user, cfg.Auth.TokenTTL.Duration)
+	writeJSON(w, http.StatusCreated, authResponseV1{
+		Message: "registered successfully",
+		Token:   token,
+		User:    newUserV1(user),
+	})
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	var body credentialsV1
+	if err := readJSON(w, r, &body); err != nil {
+		errInput(w, err)
+		return
+	}
+
+	// Unknown users count as failures too, so lockouts don't reveal which
+	// usernames exist.
+	key := strings.ToLower(body.Username)
+	if locked, wait := limits.loginBackoff.Locked(key); locked {
+		errTooManyRequests(w, wait)
+		return
+	}
+	user, err := users.Login(r.Context(), body.Username, body.Password)
+	authResult("login", err == nil)
+	if err == auth.ErrWrongPassword || err == auth.ErrUserNotFound {
+		if wait := limits.loginBackoff.Fail(key); wait > 0 {
+			errTooManyRequests(w, wait)
+			return
+		}
+	}
+	if err == auth.ErrUserDisabled {
+		errJSON(w, http.StatusForbidden, "account disabled")
+		return
+	}
+	if err != nil {
+		errJSON(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+	limits.loginBackoff.Reset(key)
+	if user.TwoFactorEnabled() {
+		writeChallenge(w, r, user)
+		return
+	}
+
+	token, _ := tokens.CreateToken(r.Context(), user, cfg.Auth.TokenTTL.Duration)
+	writeJSON(w, http.StatusOK, authResponseV1{Token: token, User: newUserV1(user)})
+}
+
+func handleListNotes(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	noteList := store.List(r.Context(), claims.UserID)
+	out := make([]noteV1, len(noteList))
+	for i, n := range noteList {
+		out[i] = newNoteV1(n)
+	}
+	writeJSON(w, http.StatusOK, noteListV1{Notes: out, Count: len(out)})
+}
+
+func handleCreateNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var input notes.CreateInput
+	if err := readJSON(w, r, &input); err != nil {
+		errInput(w, err)
+		return
+	}
+	if err := input.Validate(); err != nil {
+		errInput(w, err)
+		return
+	}
+	note := store.Create(r.Context(), claims.UserID, input)
+	writeJSON(w, http.StatusCreated, newNoteV1(note))
+}
+
+func handleGetNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	note, err := store.Get(r.Context(), claims.UserID, r.PathValue("id"))
+	if err == notes.ErrNotFound {
+		errJSON(w, http.StatusNotFound, "note not found")
+		return
+	}
+	if err == notes.ErrForbidden {
+		errJSON(w, http.StatusForbidden, "access denied")
+		return
+	}
+	w.Header().Set("Accept-Patch", acceptPatch)
+	writeJSON(w, http.StatusOK, newNoteV1(note))
+}
+
+func handleReplaceNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var input notes.ReplaceInput
+	if err := readJSON(w, r, &input); err != nil {
+		errInput(w, err)
+		return
+	}
+	if err := input.Validate(); err != nil {
+		errInput(w, err)
+		return
+	}
+	note, err := store.Replace(r.Context(), claims.UserID, r.PathValue("id"), input)
+	if err == notes.ErrNotFound {
+		errJSON(w, http.StatusNotFound, "note not found")
+		return
+	}
+	if err == notes.ErrForbidden {
+		errJSON(w, http.StatusForbidden, "access denied")
+		return
+	}
+	writeJSON(w, http.StatusOK, newNoteV1(note))
+}
+
+func handleDeleteNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	err := store.Delete(r.Context(), claims.UserID, r.PathValue("id"))
+	if err == notes.ErrNotFound {
+		errJSON(w, http.StatusNotFound, "note not found")
+		return
+	}
+	if err == notes.ErrForbidden {
+		errJSON(w, http.StatusForbidden, "access denied")
+		return
+	}
+	writeJSON(w, http.StatusOK, messageV1{Message: "deleted"})
+}
+
+func handleMoveNote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var input notes.MoveInput
+	if err := readJSON(w, r, &input); err != nil {
+		errInput(w, err)
+		return
+	}
+	note, err := store.Move(r.Context(), claims.UserID, r.PathValue("id"), input)
+	if err == notes.ErrInvalidMove {
+		errJSON(w, http.StatusBadRequest, "exactly one of before or after must name another note")
+		return
+	}
+	if err == notes.ErrNotFound {
+		errJSON(w, http.StatusNotFound, "note not found")
+		return
+	}
+	if err == notes.ErrForbidden {
+		errJSON(w, http.StatusForbidden, "access denied")
+		return
+	}
+	writeJSON(w, http.StatusOK, newNoteV1(note))
+}
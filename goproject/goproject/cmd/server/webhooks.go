@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"goproject/internal/auth"
+	"goproject/internal/notes"
+	"goproject/internal/validation"
+	"goproject/internal/webhook"
+)
+
+// webhooksConfig tunes outgoing webhook deliveries. A delivery is tried
+// MaxAttempts times, waiting Backoff before the first retry and doubling up
+// to MaxBackoff; a webhook is disabled after DisableAfter failed deliveries
+// in a row. Workers requests are sent at once, and at most QueueSize
+// deliveries wait to be sent or retried; past that, new ones fail. AllowPrivate
+// permits URLs that resolve to loopback or private addresses, which are
+// refused by default.
+type webhooksConfig struct {
+	MaxAttempts  int      `json:"max_attempts"`
+	Backoff      duration `json:"backoff"`
+	MaxBackoff   duration `json:"max_backoff"`
+	Timeout      duration `json:"timeout"`
+	DisableAfter int      `json:"disable_after"`
+	MaxPerUser   int      `json:"max_per_user"`
+	LogSize      int      `json:"log_size"`
+	Workers      int      `json:"workers"`
+	QueueSize    int      `json:"queue_size"`
+	AllowPrivate bool     `json:"allow_private"`
+}
+
+func defaultWebhooksConfig() webhooksConfig {
+	return webhooksConfig{
+		MaxAttempts:  6,
+		Backoff:      duration{10 * time.Second},
+		MaxBackoff:   duration{time.Hour},
+		Timeout:      duration{10 * time.Second},
+		DisableAfter: 10,
+		MaxPerUser:   20,
+		LogSize:      100,
+		Workers:      8,
+		QueueSize:    10000,
+	}
+}
+
+func (c webhooksConfig) validate() error {
+	switch {
+	case c.MaxAttempts < 1 || c.DisableAfter < 1 || c.LogSize < 1 || c.MaxPerUser < 1 || c.Workers < 1 || c.QueueSize < 1:
+		return errors.New("webhooks: max_attempts, disable_after, log_size, max_per_user, workers and queue_size must be positive")
+	case c.Backoff.Duration <= 0 || c.MaxBackoff.Duration < c.Backoff.Duration:
+		return errors.New("webhooks: backoff must be positive and not above max_backoff")
+	case c.Timeout.Duration <= 0:
+		return errors.New("webhooks.timeout: must be positive")
+	}
+	return nil
+}
+
+// Webhook event types.
+var webhookEvents = []string{"note.created", "note.updated", "note.done", "note.deleted"}
+
+// webhooks delivers note events to the URLs users register.
+var webhooks = tracedWebhooks{newWebhookDispatcher(defaultWebhooksConfig())}
+
+func newWebhookDispatcher(c webhooksConfig) *webhook.Dispatcher {
+	return webhook.NewDispatcher(webhook.Config{
+		Client:       webhook.NewClient(c.Timeout.Duration, c.AllowPrivate),
+		Events:       webhookEvents,
+		MaxAttempts:  c.MaxAttempts,
+		Backoff:      c.Backoff.Duration,
+		MaxBackoff:   c.MaxBackoff.Duration,
+		DisableAfter: c.DisableAfter,
+		MaxPerUser:   c.MaxPerUser,
+		LogSize:      c.LogSize,
+		Workers:      c.Workers,
+		QueueSize:    c.QueueSize,
+	})
+}
+
+// note.done is sent, in addition to note.updated, when a write marks a note
+// done.
+func init() {
+	store.OnChange(func(c notes.Change) {
+		data := webhookNoteV1{Note: newNoteV1(&c.Note)}
+		webhooks.Publish(c.Note.UserID, "note."+c.Type, data)
+		if c.Type != notes.ChangeDeleted && c.Note.Done && slices.Contains(c.Fields, "done") {
+			webhooks.Publish(c.Note.UserID, "note.done", data)
+		}
+	})
+}
+
+// ─── wire types ───────────────────────────────────────────────────────────────
+
+// webhookNoteV1 is the data of every note event; for note.deleted it is the
+// note as it was.
+type webhookNoteV1 struct {
+	Note noteV1 `json:"note"`
+}
+
+type webhookInputV1 struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type webhookUpdateV1 struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+}
+
+type webhookV1 struct {
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events"`
+	Active         bool      `json:"active"`
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+	Failures       int       `json:"consecutive_failures"`
+	Secret         string    `json:"secret,omitempty"` // only when created or rotated
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func newWebhookV1(h webhook.Webhook) webhookV1 {
+	return webhookV1{
+		ID:             h.ID,
+		URL:            h.URL,
+		Events:         h.Events,
+		Active:         h.Active,
+		DisabledReason: h.DisabledReason,
+		Failures:       h.Failures,
+		CreatedAt:      h.CreatedAt,
+	}
+}
+
+type webhookListV1 struct {
+	Webhooks []webhookV1 `json:"webhooks"`
+}
+
+type attemptV1 struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+type deliveryV1 struct {
+	ID          string         `json:"id"`
+	Event       string         `json:"event"`
+	State       string         `json:"state"`
+	Attempts    []attemptV1    `json:"attempts"`
+	NextAttempt *time.Time     `json:"next_attempt,omitempty"`
+	Redelivery  string         `json:"redelivery_of,omitempty"`
+	Payload     map[string]any `json:"payload"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func newDeliveryV1(d webhook.Delivery) deliveryV1 {
+	out := deliveryV1{
+		ID:         d.ID,
+		Event:      d.Event,
+		State:      d.State,
+		Attempts:   make([]attemptV1, len(d.Attempts)),
+		Redelivery: d.Redelivery,
+		CreatedAt:  d.CreatedAt,
+	}
+	for i, a := range d.Attempts {
+		out.Attempts[i] = attemptV1{At: a.At, StatusCode: a.StatusCode, Error: a.Error, DurationMS: float64(a.Duration.Microseconds()) / 1000}
+	}
+	if !d.NextAttempt.IsZero() {
+		out.NextAttempt = &d.NextAttempt
+	}
+	json.Unmarshal(d.Payload, &out.Payload)
+	return out
+}
+
+type deliveryListV1 struct {
+	Deliveries []deliveryV1 `json:"deliveries"`
+}
+
+// ─── handlers ─────────────────────────────────────────────────────────────────
+
+// errWebhook maps webhook errors to responses.
+func errWebhook(w http.ResponseWriter, err error) {
+	field := func(name string) {
+		errInput(w, validation.Field(name, err.Error()))
+	}
+	switch {
+	case err == webhook.ErrInvalidURL:
+		field("url")
+	case err == webhook.ErrNoEvents, errors.Is(err, webhook.ErrInvalidEvent):
+		field("events")
+	case err == webhook.ErrNotFound:
+		errJSON(w, http.StatusNotFound, "webhook or delivery not found")
+	case err == webhook.ErrLimit:
+		errJSON(w, http.StatusConflict, "webhook limit reached")
+	case err == webhook.ErrDisabled:
+		errJSON(w, http.StatusConflict, "webhook is disabled; set active to re-enable it")
+	case err == webhook.ErrQueueFull:
+		w.Header().Set("Retry-After", "60")
+		errJSON(w, http.StatusServiceUnavailable, "too many deliveries pending, retry later")
+	default:
+		errJSON(w, http.StatusServiceUnavailable, "webhook deliveries are stopped")
+	}
+}
+
+func handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	list := webhooks.List(r.Context(), claims.UserID)
+	out := webhookListV1{Webhooks: make([]webhookV1, len(list))}
+	for i, h := range list {
+		out.Webhooks[i] = newWebhookV1(h)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCreateWebhook registers a webhook. Only this response and that of
+// handleRotateWebhookSecret include the signing secret.
+func handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var input webhookInputV1
+	if err := readJSON(w, r, &input); err != nil {
+		errInput(w, err)
+		return
+	}
+	h, err := webhooks.Create(r.Context(), claims.UserID, input.URL, input.Events)
+	if err != nil {
+		errWebhook(w, err)
+		return
+	}
+	out := newWebhookV1(h)
+	out.Secret = h.Secret
+	writeJSON(w, http.StatusCreated, out)
+}
+
+func handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	h, err := webhooks.Get(r.Context(), claims.UserID, r.PathValue("id"))
+	if err != nil {
+		errWebhook(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookV1(h))
+}
+
+func handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	var input webhookUpdateV1
+	if err := readJSON(w, r, &input); err != nil {
+		errInput(w, err)
+		return
+	}
+	h, err := webhooks.Update(r.Context(), claims.UserID, r.PathValue("id"), input.URL, input.Events, input.Active)
+	if err != nil {
+		errWebhook(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookV1(h))
+}
+
+func handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	if err := webhooks.Delete(r.Context(), claims.UserID, r.PathValue("id")); err != nil {
+		errWebhook(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, messageV1{Message: "deleted"})
+}
+
+// handleRotateWebhookSecret replaces the signing secret, for when the old
+// one was lost or leaked, and returns the new one.
+func handleRotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	h, err := webhooks.RotateSecret(r.Context(), claims.UserID, r.PathValue("id"))
+	if err != nil {
+		errWebhook(w, err)
+		return
+	}
+	out := newWebhookV1(h)
+	out.Secret = h.Secret
+	writeJSON(w, http.StatusOK, out)
+}
+
+func handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	list, err := webhooks.Deliveries(r.Context(), claims.UserID, r.PathValue("id"))
+	if err != nil {
+		errWebhook(w, err)
+		return
+	}
+	out := deliveryListV1{Deliveries: make([]deliveryV1, len(list))}
+	for i, d := range list {
+		out.Deliveries[i] = newDeliveryV1(d)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(claimsKey).(*auth.Claims)
+	d, err := webhooks.Redeliver(r.Context(), claims.UserID, r.PathValue("id"), r.PathValue("delivery"))
+	if err != nil {
+		errWebhook(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, newDeliveryV1(d))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"goproject/internal/webhook"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	c := defaultWebhooksConfig()
+	c.AllowPrivate = true
+	c.Backoff.Duration = time.Millisecond
+	webhooks = tracedWebhooks{newWebhookDispatcher(c)}
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- delivery{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	srv := newTestServer(t)
+	token := registerToken(t, srv, "webhook-user")
+	hook := call(t, srv, token, "POST", "/v1/webhooks", `{"url":"`+receiver.URL+`","events":["note.done","note.deleted"]}`)
+	secret, _ := hook["secret"].(string)
+	if secret == "" {
+		t.Fatalf("create = %v", hook)
+	}
+	if h := call(t, srv, token, "GET", "/v1/webhooks/"+hook["id"].(string), ""); h["secret"] != nil {
+		t.Error("secret is shown after creation")
+	}
+
+	note := call(t, srv, token, "POST", "/v1/notes", `{"title":"a"}`)
+	call(t, srv, token, "PUT", "/v1/notes/"+note["id"].(string), `{"title":"a","done":true}`)
+	call(t, srv, token, "DELETE", "/v1/notes/"+note["id"].(string), "")
+
+	for _, want := range []string{"note.done", "note.deleted"} {
+		select {
+		case d := <-got:
+			if ev := d.header.Get(webhook.EventHeader); ev != want {
+				t.Errorf("got %s, want %s", ev, want)
+			}
+			if err := webhook.Verify(secret, d.header.Get(webhook.SignatureHeader), d.body, time.Minute); err != nil {
+				t.Errorf("%s: %v", want, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s delivery", want)
+		}
+	}
+
+	path := "/v1/webhooks/" + hook["id"].(string) + "/deliveries"
+	var log []any
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		log = call(t, srv, token, "GET", path, "")["deliveries"].([]any)
+		if len(log) == 2 && log[0].(map[string]any)["state"] == "succeeded" && log[1].(map[string]any)["state"] == "succeeded" {
+			break
+		}
+	}
+	first := log[1].(map[string]any)
+	if first["event"] != "note.done" || first["payload"].(map[string]any)["type"] != "note.done" {
+		t.Fatalf("delivery log = %v", log)
+	}
+	again := call(t, srv, token, "POST", path+"/"+first["id"].(string)+"/redeliver", "")
+	if again["redelivery_of"] != first["id"] {
+		t.Errorf("redeliver = %v", again)
+	}
+	if d := <-got; d.header.Get(webhook.EventHeader) != "note.done" {
+		t.Errorf("redelivered %s", d.header.Get(webhook.EventHeader))
+	}
+
+	rotated := call(t, srv, token, "POST", "/v1/webhooks/"+hook["id"].(string)+"/secret", "")
+	if newSecret, _ := rotated["secret"].(string); newSecret == "" || newSecret == secret {
+		t.Errorf("rotate = %v", rotated)
+	} else {
+		note := call(t, srv, token, "POST", "/v1/notes", `{"title":"b"}`)
+		call(t, srv, token, "DELETE", "/v1/notes/"+note["id"].(string), "")
+		select {
+		case d := <-got:
+			if webhook.Verify(newSecret, d.header.Get(webhook.SignatureHeader), d.body, time.Minute) != nil {
+				t.Error("delivery after rotation not signed with the new secret")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no delivery after rotation")
+		}
+	}
+
+	if bad := call(t, srv, token, "POST", "/v1/webhooks", `{"url":"`+receiver.URL+`","events":["note.moved"]}`); bad["status"] != float64(422) {
+		t.Errorf("unknown event = %v", bad)
+	}
+}
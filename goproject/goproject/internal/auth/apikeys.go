@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrKeyExpired  = errors.New("api key expired")
+	ErrKeyLimit    = errors.New("api key limit reached")
+	ErrKeyName     = errors.New("name must be 1 to 100 characters")
+	ErrNoScopes    = errors.New("at least one scope is required")
+	ErrScope       = errors.New("unknown scope")
+	ErrKeyExpiry   = errors.New("expiry must be in the future")
+)
+
+// Scope limits what an API key may do.
+type Scope string
+
+const (
+	ScopeNotesRead     Scope = "notes:read"
+	ScopeNotesWrite    Scope = "notes:write"
+	ScopeWebhooksRead  Scope = "webhooks:read"
+	ScopeWebhooksWrite Scope = "webhooks:write"
+)
+
+// Scopes lists every scope.
+var Scopes = []Scope{ScopeNotesRead, ScopeNotesWrite, ScopeWebhooksRead, ScopeWebhooksWrite}
+
+// APIKeyPrefix starts every API key, so they can be told apart from tokens.
+const APIKeyPrefix = "nk_"
+
+// MaxAPIKeys bounds the keys of one user.
+const MaxAPIKeys = 50
+
+// APIKey is a long-lived credential for scripts. Only a hash of its secret
+// is kept.
+type APIKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Scopes     []Scope
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // zero for no expiry
+	LastUsedAt time.Time // zero if never used
+
+	hash [sha256.Size]byte
+}
+
+func (k *APIKey) copy() APIKey {
+	c := *k
+	c.Scopes = slices.Clone(k.Scopes)
+	return c
+}
+
+type APIKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]*APIKey
+}
+
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{keys: make(map[string]*APIKey)}
+}
+
+// Create makes a key and returns it with its secret, the string to send as
+// a bearer token. The secret cannot be recovered later.
+func (s *APIKeyStore) Create(userID, name string, scopes []Scope, expiresAt time.Time) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "" || len([]rune(name)) > 100:
+		return APIKey{}, "", ErrKeyName
+	case len(scopes) == 0:
+		return APIKey{}, "", ErrNoScopes
+	case !expiresAt.IsZero() && !expiresAt.After(time.Now()):
+		return APIKey{}, "", ErrKeyExpiry
+	}
+	for _, sc := range scopes {
+		if !slices.Contains(Scopes, sc) {
+			return APIKey{}, "", fmt.Errorf("%w %q", ErrScope, sc)
+		}
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	rand.Read(id)
+	rand.Read(secret)
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	key := &APIKey{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    slices.Compact(scopes),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	plain := APIKeyPrefix + key.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key.hash = sha256.Sum256([]byte(plain))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, k := range s.keys {
+		if k.UserID == userID {
+			n++
+		}
+	}
+	if n >= MaxAPIKeys {
+		return APIKey{}, "", ErrKeyLimit
+	}
+	s.keys[key.ID] = key
+	return key.copy(), plain, nil
+}
+
+// List returns the user's keys, newest first.
+func (s *APIKeyStore) List(userID string) []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []APIKey
+	for _, k := range s.keys {
+		if k.UserID == userID {
+			out = append(out, k.copy())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Delete revokes one of the user's keys.
+func (s *APIKeyStore) Delete(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok || k.UserID != userID {
+		return ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// DeleteUser revokes every key of a user.
+func (s *APIKeyStore) DeleteUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, k := range s.keys {
+		if k.UserID == userID {
+			delete(s.keys, id)
+		}
+	}
+}
+
+// Authenticate returns the key a secret belongs to and records the use.
+func (s *APIKeyStore) Authenticate(plain string) (APIKey, error) {
+	rest, ok := strings.CutPrefix(plain, APIKeyPrefix)
+	if !ok {
+		return APIKey{}, ErrKeyNotFound
+	}
+	id, _, _ := strings.Cut(rest, "_")
+	hash := sha256.Sum256([]byte(plain))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok || subtle.ConstantTimeCompare(hash[:], k.hash[:]) != 1 {
+		return APIKey{}, ErrKeyNotFound
+	}
+	now := time.Now()
+	if !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt) {
+		return APIKey{}, ErrKeyExpired
+	}
+	k.LastUsedAt = now
+	return k.copy(), nil
+}
+
+// Claims returns the claims a request made with k carries on behalf of
+// user.
+func (k *APIKey) Claims(user *User) *Claims {
+	return &Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		IssuedAt: time.Now(),
+		Expires:  k.ExpiresAt,
+		APIKeyID: k.ID,
+		Scopes:   slices.Clone(k.Scopes),
+	}
+}
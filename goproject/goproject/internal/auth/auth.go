@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -19,12 +21,28 @@ var (
 	ErrUserNotFound  = errors.New("user not found")
 	ErrWrongPassword = errors.New("wrong password")
 	ErrUserExists    = errors.New("user already exists")
+	ErrUserDisabled  = errors.New("user disabled")
+	ErrTokenRevoked  = errors.New("token revoked")
 )
 
+// Role grants access to parts of the API. Every user has one.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool { return r == RoleUser || r == RoleAdmin }
+
 // Simple in-memory user store (replace with DB in production)
 type UserStore struct {
 	mu    sync.RWMutex
-	users map[string]*User
+	users map[string]*User // by username
+	byID  map[string]*User
+	// identities maps external identities to user IDs; see identity.go.
+	identities map[string]string
 }
 
 type User struct {
@@ -33,10 +51,24 @@ type User struct {
 	PasswordHash string // sha256 hex of salt+password
 	Salt         string
 	CreatedAt    time.Time
+	Role         Role
+	Disabled     bool
+	// TokensNotBefore revokes every token issued before it.
+	TokensNotBefore time.Time
+	Profile         // display name, email and timezone
+
+	// Two-factor state; see totp.go.
+	totpSecret    []byte
+	totpPending   []byte
+	totpLastStep  int64    // last time step a code was used for
+	recoveryCodes []string // sha256 hex, unused only
+	// usedChallenges holds the IDs of spent 2FA challenges until they
+	// expire.
+	usedChallenges map[string]time.Time
 }
 
 func NewUserStore() *UserStore {
-	return &UserStore{users: make(map[string]*User)}
+	return &UserStore{users: make(map[string]*User), byID: make(map[string]*User), identities: make(map[string]string)}
 }
 
 func generateSalt() (string, error) {
@@ -79,9 +111,19 @@ func (s *UserStore) Register(username, password string) (*User, error) {
 		PasswordHash: hashPassword(password, salt),
 		Salt:         salt,
 		CreatedAt:    time.Now(),
+		Role:         RoleUser,
 	}
 	s.users[username] = user
-	return user, nil
+	s.byID[user.ID] = user
+	u := *user
+	return &u, nil
+}
+
+// Count returns the number of registered users.
+func (s *UserStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
 }
 
 func (s *UserStore) Login(username, password string) (*User, error) {
@@ -96,7 +138,125 @@ func (s *UserStore) Login(username, password string) (*User, error) {
 	if hashPassword(password, user.Salt) != user.PasswordHash {
 		return nil, ErrWrongPassword
 	}
-	return user, nil
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	u := *user
+	return &u, nil
+}
+
+// Get returns a copy of the user with the given ID.
+func (s *UserStore) Get(id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.byID[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// List returns copies of every user, oldest first.
+func (s *UserStore) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]User, 0, len(s.byID))
+	for _, u := range s.byID {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// update applies fn to the user with the given ID and returns a copy.
+func (s *UserStore) update(id string, fn func(*User) error) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.byID[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if err := fn(user); err != nil {
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// SetRole changes a user's role and revokes their tokens, which carry the
+// old one.
+func (s *UserStore) SetRole(id string, role Role) (User, error) {
+	return s.update(id, func(u *User) error {
+		u.Role = role
+		u.TokensNotBefore = time.Now()
+		return nil
+	})
+}
+
+// SetDisabled disables or re-enables a user. Disabling revokes their
+// tokens and makes Login fail with ErrUserDisabled.
+func (s *UserStore) SetDisabled(id string, disabled bool) (User, error) {
+	return s.update(id, func(u *User) error {
+		u.Disabled = disabled
+		if disabled {
+			u.TokensNotBefore = time.Now()
+		}
+		return nil
+	})
+}
+
+// SetPassword replaces a user's password and revokes their tokens.
+func (s *UserStore) SetPassword(id, password string) (User, error) {
+	salt, err := generateSalt()
+	if err != nil {
+		return User{}, err
+	}
+	return s.update(id, func(u *User) error {
+		u.Salt = salt
+		u.PasswordHash = hashPassword(password, salt)
+		u.TokensNotBefore = time.Now()
+		return nil
+	})
+}
+
+// Delete removes a user. Their tokens stop working at once, since Check
+// no longer finds them.
+func (s *UserStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.byID[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(s.byID, id)
+	delete(s.users, user.Username)
+	for k, uid := range s.identities {
+		if uid == id {
+			delete(s.identities, k)
+		}
+	}
+	return nil
+}
+
+// Check confirms that the user behind valid claims still exists, is not
+// disabled and has not had their tokens revoked since these were issued.
+func (s *UserStore) Check(c *Claims) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.byID[c.UserID]
+	switch {
+	case !ok:
+		return ErrUserNotFound
+	case user.Disabled:
+		return ErrUserDisabled
+	case c.IssuedAt.Before(user.TokensNotBefore):
+		return ErrTokenRevoked
+	}
+	return nil
 }
 
 // Minimal JWT-like token using HMAC-SHA256
@@ -111,14 +271,57 @@ func NewTokenManager(secret string) *TokenManager {
 type Claims struct {
 	UserID   string    `json:"uid"`
 	Username string    `json:"usr"`
+	Role     Role      `json:"rol"`
+	IssuedAt time.Time `json:"iat"`
 	Expires  time.Time `json:"exp"`
+	// Purpose is set on tokens that only prove part of a login, such as
+	// 2FA challenges. ValidateToken rejects them.
+	Purpose string `json:"pur,omitempty"`
+	// ID is set on challenges, so that each can be spent once.
+	ID string `json:"jti,omitempty"`
+
+	// APIKeyID and Scopes are set for requests made with an API key.
+	APIKeyID string  `json:"-"`
+	Scopes   []Scope `json:"-"`
+}
+
+// HasRole reports whether the claims grant role. Admins have every role.
+func (c *Claims) HasRole(role Role) bool {
+	return c.Role == role || c.Role == RoleAdmin
+}
+
+// HasScope reports whether the claims allow scope. Tokens allow every
+// scope; API keys only those they were created with.
+func (c *Claims) HasScope(scope Scope) bool {
+	return c.APIKeyID == "" || slices.Contains(c.Scopes, scope)
 }
 
+// PurposeChallenge marks a token that a 2FA code can be exchanged for a
+// real token.
+const PurposeChallenge = "2fa"
+
 func (tm *TokenManager) CreateToken(user *User, ttl time.Duration) (string, error) {
+	return tm.create(user, ttl, "")
+}
+
+// CreateChallenge returns a token showing that user got their password
+// right, for a login that still needs a second factor.
+func (tm *TokenManager) CreateChallenge(user *User, ttl time.Duration) (string, error) {
+	return tm.create(user, ttl, PurposeChallenge)
+}
+
+func (tm *TokenManager) create(user *User, ttl time.Duration, purpose string) (string, error) {
+	now := time.Now()
 	claims := Claims{
 		UserID:   user.ID,
 		Username: user.Username,
-		Expires:  time.Now().Add(ttl),
+		Role:     user.Role,
+		IssuedAt: now,
+		Expires:  now.Add(ttl),
+		Purpose:  purpose,
+	}
+	if purpose == PurposeChallenge {
+		claims.ID = generateID()
 	}
 
 	payload, err := json.Marshal(claims)
@@ -132,6 +335,15 @@ func (tm *TokenManager) CreateToken(user *User, ttl time.Duration) (string, erro
 }
 
 func (tm *TokenManager) ValidateToken(token string) (*Claims, error) {
+	return tm.validate(token, "")
+}
+
+// ValidateChallenge validates a token made by CreateChallenge.
+func (tm *TokenManager) ValidateChallenge(token string) (*Claims, error) {
+	return tm.validate(token, PurposeChallenge)
+}
+
+func (tm *TokenManager) validate(token, purpose string) (*Claims, error) {
 	parts := strings.SplitN(token, ".", 2)
 	if len(parts) != 2 {
 		return nil, ErrInvalidToken
@@ -147,7 +359,7 @@ func (tm *TokenManager) ValidateToken(token string) (*Claims, error) {
 	}
 
 	var claims Claims
-	if err := json.Unmarshal(payload, &claims); err != nil {
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Purpose != purpose {
 		return nil, ErrInvalidToken
 	}
 
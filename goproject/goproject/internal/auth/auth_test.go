@@ -1,6 +1,9 @@
 package auth_test
 
 import (
+	"errors"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -78,3 +81,289 @@ func TestTokenCreateAndValidate(t *testing.T) {
 		t.Errorf("expected ErrExpiredToken, got %v", err)
 	}
 }
+
+func TestRolesAndRevocation(t *testing.T) {
+	store := auth.NewUserStore()
+	tm := auth.NewTokenManager("test-secret")
+
+	user, _ := store.Register("carol", "pass")
+	if user.Role != auth.RoleUser {
+		t.Errorf("new users should have the user role, got %q", user.Role)
+	}
+	token, _ := tm.CreateToken(user, time.Hour)
+	claims, _ := tm.ValidateToken(token)
+	if claims.Role != auth.RoleUser || claims.HasRole(auth.RoleAdmin) {
+		t.Errorf("claims = %+v", claims)
+	}
+	if err := store.Check(claims); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	admin, _ := store.SetRole(user.ID, auth.RoleAdmin)
+	if err := store.Check(claims); err != auth.ErrTokenRevoked {
+		t.Errorf("role change should revoke tokens, got %v", err)
+	}
+	token, _ = tm.CreateToken(&admin, time.Hour)
+	claims, _ = tm.ValidateToken(token)
+	if !claims.HasRole(auth.RoleAdmin) || !claims.HasRole(auth.RoleUser) {
+		t.Errorf("admin claims = %+v", claims)
+	}
+
+	store.SetDisabled(user.ID, true)
+	if err := store.Check(claims); err != auth.ErrUserDisabled {
+		t.Errorf("expected ErrUserDisabled, got %v", err)
+	}
+	if _, err := store.Login("carol", "pass"); err != auth.ErrUserDisabled {
+		t.Errorf("login of a disabled user: %v", err)
+	}
+	store.SetDisabled(user.ID, false)
+
+	store.SetPassword(user.ID, "new-pass")
+	if _, err := store.Login("carol", "pass"); err != auth.ErrWrongPassword {
+		t.Errorf("old password after reset: %v", err)
+	}
+	if _, err := store.Login("carol", "new-pass"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+
+	store.Delete(user.ID)
+	if err := store.Check(claims); err != auth.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound after delete, got %v", err)
+	}
+	if len(store.List()) != 0 {
+		t.Errorf("List after delete = %v", store.List())
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	store := auth.NewAPIKeyStore()
+	if _, _, err := store.Create("u1", "ci", nil, time.Time{}); err != auth.ErrNoScopes {
+		t.Errorf("no scopes: %v", err)
+	}
+	if _, _, err := store.Create("u1", "ci", []auth.Scope{"notes:all"}, time.Time{}); !errors.Is(err, auth.ErrScope) {
+		t.Errorf("unknown scope: %v", err)
+	}
+	if _, _, err := store.Create("u1", "ci", []auth.Scope{auth.ScopeNotesRead}, time.Now().Add(-time.Hour)); err != auth.ErrKeyExpiry {
+		t.Errorf("past expiry: %v", err)
+	}
+
+	key, plain, err := store.Create("u1", " ci ", []auth.Scope{auth.ScopeNotesRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, auth.APIKeyPrefix) || key.Name != "ci" || !key.LastUsedAt.IsZero() {
+		t.Errorf("created %+v with %q", key, plain)
+	}
+	got, err := store.Authenticate(plain)
+	if err != nil || got.ID != key.ID || got.LastUsedAt.IsZero() {
+		t.Errorf("Authenticate = %+v, %v", got, err)
+	}
+	if _, err := store.Authenticate(plain + "x"); err != auth.ErrKeyNotFound {
+		t.Errorf("tampered key: %v", err)
+	}
+	if list := store.List("u1"); len(list) != 1 || list[0].LastUsedAt.IsZero() {
+		t.Errorf("List = %+v", list)
+	}
+
+	claims := got.Claims(&auth.User{ID: "u1", Username: "alice"})
+	if !claims.HasScope(auth.ScopeNotesRead) || claims.HasScope(auth.ScopeNotesWrite) || claims.HasScope("") {
+		t.Errorf("key claims scopes = %v", claims.Scopes)
+	}
+	if !(&auth.Claims{UserID: "u1"}).HasScope(auth.ScopeNotesWrite) {
+		t.Error("token claims should allow every scope")
+	}
+
+	short, shortPlain, _ := store.Create("u1", "short", []auth.Scope{auth.ScopeNotesRead}, time.Now().Add(20*time.Millisecond))
+	time.Sleep(30 * time.Millisecond)
+	if _, err := store.Authenticate(shortPlain); err != auth.ErrKeyExpired {
+		t.Errorf("expired key: %v", err)
+	}
+
+	if err := store.Delete("u2", key.ID); err != auth.ErrKeyNotFound {
+		t.Errorf("deleting another user's key: %v", err)
+	}
+	if err := store.Delete("u1", key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(plain); err != auth.ErrKeyNotFound {
+		t.Errorf("revoked key: %v", err)
+	}
+	store.DeleteUser("u1")
+	if err := store.Delete("u1", short.ID); err != auth.ErrKeyNotFound {
+		t.Errorf("key survived DeleteUser: %v", err)
+	}
+}
+
+func TestTOTPCodes(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits.
+	secret := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if got := auth.TOTPCode(secret, time.Unix(unix, 0)); got != want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", unix, got, want)
+		}
+	}
+
+	u, err := url.Parse(auth.TOTPURI("Notes API", "alice", secret))
+	if err != nil || u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Notes API:alice" ||
+		u.Query().Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("TOTPURI = %v, %v", u, err)
+	}
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	store := auth.NewUserStore()
+	user, _ := store.Register("dave", "pass")
+	if err := store.VerifySecondFactor(user.ID, "000000"); err != auth.ErrTOTPNotEnabled {
+		t.Errorf("verify without 2FA: %v", err)
+	}
+	if _, err := store.ConfirmTOTP(user.ID, "000000"); err != auth.ErrTOTPNotPending {
+		t.Errorf("confirm without setup: %v", err)
+	}
+
+	secret, err := store.BeginTOTP(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := store.Get(user.ID); u.TwoFactorEnabled() {
+		t.Error("2FA enabled before confirmation")
+	}
+	if _, err := store.ConfirmTOTP(user.ID, "not-a-code"); err != auth.ErrInvalidCode {
+		t.Errorf("confirm with a bad code: %v", err)
+	}
+	code := auth.TOTPCode(secret, time.Now())
+	recovery, err := store.ConfirmTOTP(user.ID, code)
+	if err != nil || len(recovery) != auth.RecoveryCodes {
+		t.Fatalf("confirm = %v, %v", recovery, err)
+	}
+	if _, err := store.BeginTOTP(user.ID); err != auth.ErrTOTPEnabled {
+		t.Errorf("setup while enabled: %v", err)
+	}
+
+	// Codes are single-use, so the one used to confirm cannot log in.
+	if err := store.VerifySecondFactor(user.ID, code); err != auth.ErrInvalidCode {
+		t.Errorf("replayed code: %v", err)
+	}
+	if err := store.VerifySecondFactor(user.ID, auth.TOTPCode(secret, time.Now().Add(30*time.Second))); err != nil {
+		t.Errorf("next code: %v", err)
+	}
+	if err := store.VerifySecondFactor(user.ID, strings.ToUpper(recovery[0])); err != nil {
+		t.Errorf("recovery code: %v", err)
+	}
+	if err := store.VerifySecondFactor(user.ID, recovery[0]); err != auth.ErrInvalidCode {
+		t.Errorf("reused recovery code: %v", err)
+	}
+	if u, _ := store.Get(user.ID); u.RecoveryCodesLeft() != auth.RecoveryCodes-1 {
+		t.Errorf("%d recovery codes left", u.RecoveryCodesLeft())
+	}
+
+	if err := store.DisableTOTP(user.ID, "123"); err != auth.ErrInvalidCode {
+		t.Errorf("disable with a bad code: %v", err)
+	}
+	if err := store.DisableTOTP(user.ID, recovery[1]); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := store.Get(user.ID); u.TwoFactorEnabled() || u.RecoveryCodesLeft() != 0 {
+		t.Error("2FA still enabled after disable")
+	}
+}
+
+func TestChallengeTokens(t *testing.T) {
+	tm := auth.NewTokenManager("test-secret")
+	user := &auth.User{ID: "u1", Username: "erin"}
+	challenge, _ := tm.CreateChallenge(user, time.Minute)
+	if _, err := tm.ValidateToken(challenge); err != auth.ErrInvalidToken {
+		t.Errorf("challenge used as a token: %v", err)
+	}
+	if c, err := tm.ValidateChallenge(challenge); err != nil || c.UserID != "u1" {
+		t.Errorf("ValidateChallenge = %+v, %v", c, err)
+	}
+	token, _ := tm.CreateToken(user, time.Minute)
+	if _, err := tm.ValidateChallenge(token); err != auth.ErrInvalidToken {
+		t.Errorf("token used as a challenge: %v", err)
+	}
+}
+
+func TestCompleteChallengeOnce(t *testing.T) {
+	store, tm := auth.NewUserStore(), auth.NewTokenManager("test-secret")
+	user, _ := store.Register("fred", "pass")
+	secret, _ := store.BeginTOTP(user.ID)
+	recovery, _ := store.ConfirmTOTP(user.ID, auth.TOTPCode(secret, time.Now()))
+
+	raw, _ := tm.CreateChallenge(user, time.Minute)
+	c, _ := tm.ValidateChallenge(raw)
+	if err := store.CompleteChallenge(c, "000000x"); err != auth.ErrInvalidCode {
+		t.Errorf("wrong code: %v", err)
+	}
+	if err := store.CompleteChallenge(c, recovery[0]); err != nil {
+		t.Fatalf("complete after a wrong code: %v", err)
+	}
+	if err := store.CompleteChallenge(c, recovery[1]); err != auth.ErrChallengeUsed {
+		t.Errorf("replayed challenge: %v", err)
+	}
+	raw, _ = tm.CreateChallenge(user, time.Minute)
+	c, _ = tm.ValidateChallenge(raw)
+	if err := store.CompleteChallenge(c, recovery[1]); err != nil {
+		t.Errorf("new challenge: %v", err)
+	}
+}
+
+func TestExternalIdentities(t *testing.T) {
+	store := auth.NewUserStore()
+	local, _ := store.Register("hana", "pass")
+
+	if _, err := store.FindIdentity("https://idp", "s1"); err != auth.ErrUserNotFound {
+		t.Errorf("unknown identity: %v", err)
+	}
+	user, err := store.ProvisionIdentity("https://idp", "s1", "hana")
+	if err != nil || user.Username != "hana-2" {
+		t.Fatalf("provision = %+v, %v", user, err)
+	}
+	if _, err := store.Login("hana-2", ""); err != auth.ErrWrongPassword {
+		t.Errorf("password login of a provisioned user: %v", err)
+	}
+	if found, _ := store.FindIdentity("https://idp", "s1"); found.ID != user.ID {
+		t.Errorf("FindIdentity = %+v", found)
+	}
+	if err := store.LinkIdentity(local.ID, "https://idp", "s1"); err != auth.ErrIdentityLinked {
+		t.Errorf("linking a taken identity: %v", err)
+	}
+	if err := store.LinkIdentity(local.ID, "https://other-idp", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	store.Delete(local.ID)
+	if _, err := store.FindIdentity("https://other-idp", "s1"); err != auth.ErrUserNotFound {
+		t.Errorf("identity survived its user: %v", err)
+	}
+}
+
+func TestProfileAndPassword(t *testing.T) {
+	store := auth.NewUserStore()
+	user, _ := store.Register("ines", "pass")
+
+	for p, want := range map[auth.Profile]error{
+		{DisplayName: strings.Repeat("x", 101)}: auth.ErrDisplayName,
+		{Email: "Ines <ines@example.com>"}:      auth.ErrEmail,
+		{Email: "not-an-email"}:                 auth.ErrEmail,
+		{Timezone: "Mars/Olympus"}:              auth.ErrTimezone,
+		{Timezone: "Local"}:                     auth.ErrTimezone,
+	} {
+		if _, err := store.SetProfile(user.ID, p); err != want {
+			t.Errorf("SetProfile(%+v) = %v, want %v", p, err, want)
+		}
+	}
+	updated, err := store.SetProfile(user.ID, auth.Profile{DisplayName: " Inés ", Email: "ines@example.com", Timezone: "Europe/Lisbon"})
+	if err != nil || updated.DisplayName != "Inés" || updated.Timezone != "Europe/Lisbon" {
+		t.Errorf("SetProfile = %+v, %v", updated.Profile, err)
+	}
+
+	if err := store.CheckPassword(user.ID, "wrong"); err != auth.ErrWrongPassword {
+		t.Errorf("wrong password: %v", err)
+	}
+	if err := store.CheckPassword(user.ID, "pass"); err != nil {
+		t.Errorf("right password: %v", err)
+	}
+	provisioned, _ := store.ProvisionIdentity("https://idp", "s", "jo")
+	if provisioned.HasPassword() || store.CheckPassword(provisioned.ID, "") != auth.ErrWrongPassword {
+		t.Error("provisioned users should have no password")
+	}
+}
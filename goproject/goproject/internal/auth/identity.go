@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrIdentityLinked = errors.New("identity is linked to another user")
+
+// External identities are users of an identity provider, named by the
+// provider's issuer and their subject there. Each links to one user.
+func identityKey(issuer, subject string) string { return issuer + " " + subject }
+
+// FindIdentity returns the user an external identity is linked to, or
+// ErrUserNotFound.
+func (s *UserStore) FindIdentity(issuer, subject string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.byID[s.identities[identityKey(issuer, subject)]]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// LinkIdentity lets an existing user log in with an external identity.
+// Linking the same identity again is a no-op.
+func (s *UserStore) LinkIdentity(id, issuer, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return ErrUserNotFound
+	}
+	key := identityKey(issuer, subject)
+	if linked, ok := s.identities[key]; ok && linked != id {
+		return ErrIdentityLinked
+	}
+	s.identities[key] = id
+	return nil
+}
+
+// ProvisionIdentity creates a user for an external identity on its first
+// login. The username is hint, made unique with a numeric suffix if taken;
+// an existing account is never taken over by name. The user has no
+// password, so Login always fails for them.
+func (s *UserStore) ProvisionIdentity(issuer, subject, hint string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := identityKey(issuer, subject)
+	if _, ok := s.identities[key]; ok {
+		return nil, ErrIdentityLinked
+	}
+	base := strings.TrimSpace(hint)
+	if base == "" {
+		base = "user"
+	}
+	username := base
+	for n := 2; s.users[username] != nil; n++ {
+		username = fmt.Sprintf("%s-%d", base, n)
+	}
+	user := &User{
+		ID:        generateID(),
+		Username:  username,
+		CreatedAt: time.Now(),
+		Role:      RoleUser,
+	}
+	s.users[username] = user
+	s.byID[user.ID] = user
+	s.identities[key] = user.ID
+	u := *user
+	return &u, nil
+}
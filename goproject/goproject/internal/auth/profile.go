@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrDisplayName = errors.New("display name must be at most 100 characters")
+	ErrEmail       = errors.New("email must be a plain address such as name@example.com")
+	ErrTimezone    = errors.New("timezone must be an IANA name such as Europe/Berlin")
+)
+
+// Profile is what users say about themselves. Every field is optional.
+type Profile struct {
+	DisplayName string
+	Email       string
+	Timezone    string // IANA name
+}
+
+// Validate trims p and checks each field.
+func (p *Profile) Validate() error {
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	p.Email = strings.TrimSpace(p.Email)
+	p.Timezone = strings.TrimSpace(p.Timezone)
+	if utf8.RuneCountInString(p.DisplayName) > 100 {
+		return ErrDisplayName
+	}
+	if p.Email != "" {
+		if addr, err := mail.ParseAddress(p.Email); err != nil || addr.Address != p.Email || addr.Name != "" {
+			return ErrEmail
+		}
+	}
+	if p.Timezone != "" {
+		// LoadLocation also accepts "Local", which means nothing to a client.
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return ErrTimezone
+		}
+	}
+	return nil
+}
+
+// SetProfile replaces a user's profile.
+func (s *UserStore) SetProfile(id string, p Profile) (User, error) {
+	if err := p.Validate(); err != nil {
+		return User{}, err
+	}
+	return s.update(id, func(u *User) error {
+		u.Profile = p
+		return nil
+	})
+}
+
+// HasPassword reports whether u can log in with a password. Users
+// provisioned from an identity provider cannot until one is set.
+func (u *User) HasPassword() bool { return u.PasswordHash != "" }
+
+// CheckPassword reports whether password is the user's, returning
+// ErrWrongPassword if not.
+func (s *UserStore) CheckPassword(id, password string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.byID[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !user.HasPassword() || hashPassword(password, user.Salt) != user.PasswordHash {
+		return ErrWrongPassword
+	}
+	return nil
+}
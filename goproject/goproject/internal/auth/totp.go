@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTOTPEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotPending = errors.New("no two-factor setup to confirm")
+	ErrInvalidCode    = errors.New("invalid code")
+	ErrChallengeUsed  = errors.New("challenge already used")
+)
+
+// TOTP parameters (RFC 6238). They are the defaults authenticator apps
+// assume, so the otpauth URI need not spell them out, though it does.
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpSkew   = 1 // steps accepted either side of now, for clock drift
+)
+
+// RecoveryCodes is how many one-time recovery codes confirming 2FA makes.
+const RecoveryCodes = 10
+
+// TOTPCode returns the code for secret at t.
+func TOTPCode(secret []byte, t time.Time) string {
+	return hotp(secret, uint64(t.Unix()/int64(totpPeriod/time.Second)))
+}
+
+// hotp is RFC 4226 with HMAC-SHA1, truncated to totpDigits digits.
+func hotp(secret []byte, counter uint64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, n%1_000_000)
+}
+
+// TOTPSecretString encodes a secret the way authenticator apps expect it
+// to be typed in.
+func TOTPSecretString(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// TOTPURI returns the otpauth:// URI for enrolling secret in an
+// authenticator app, usually shown as a QR code.
+func TOTPURI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", TOTPSecretString(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + account, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// totpStep returns the time step code is valid for near now, or -1.
+func totpStep(secret []byte, code string, now time.Time) int64 {
+	step := now.Unix() / int64(totpPeriod/time.Second)
+	for i := step - totpSkew; i <= step+totpSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, uint64(i))), []byte(code)) == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCodes() (plain, hashed []string) {
+	for range RecoveryCodes {
+		b := make([]byte, 5)
+		rand.Read(b)
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		plain = append(plain, code)
+		hashed = append(hashed, hashRecoveryCode(code))
+	}
+	return plain, hashed
+}
+
+// TwoFactorEnabled reports whether logging in as u needs a second factor.
+func (u *User) TwoFactorEnabled() bool { return len(u.totpSecret) > 0 }
+
+// BeginTOTP makes a new secret for the user. It takes effect once
+// confirmed with ConfirmTOTP; until then login is unchanged.
+func (s *UserStore) BeginTOTP(id string) ([]byte, error) {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	_, err := s.update(id, func(u *User) error {
+		if u.TwoFactorEnabled() {
+			return ErrTOTPEnabled
+		}
+		u.totpPending = secret
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once code shows the user
+// has enrolled the pending secret. It returns the recovery codes, which
+// are only kept hashed.
+func (s *UserStore) ConfirmTOTP(id, code string) ([]string, error) {
+	plain, hashed := newRecoveryCodes()
+	_, err := s.update(id, func(u *User) error {
+		switch {
+		case u.TwoFactorEnabled():
+			return ErrTOTPEnabled
+		case u.totpPending == nil:
+			return ErrTOTPNotPending
+		}
+		step := totpStep(u.totpPending, code, time.Now())
+		if step < 0 {
+			return ErrInvalidCode
+		}
+		u.totpSecret, u.totpPending = u.totpPending, nil
+		u.totpLastStep = step
+		u.recoveryCodes = hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// VerifySecondFactor accepts a current TOTP code, each at most once, or an
+// unused recovery code, which is then spent.
+func (s *UserStore) VerifySecondFactor(id, code string) error {
+	_, err := s.update(id, func(u *User) error {
+		if !u.TwoFactorEnabled() {
+			return ErrTOTPNotEnabled
+		}
+		return u.useSecondFactor(code)
+	})
+	return err
+}
+
+// CompleteChallenge is VerifySecondFactor for the user behind a challenge
+// made by CreateChallenge, which it then spends: each challenge completes
+// at most one login. Wrong codes leave it unspent.
+func (s *UserStore) CompleteChallenge(c *Claims, code string) error {
+	_, err := s.update(c.UserID, func(u *User) error {
+		now := time.Now()
+		if _, used := u.usedChallenges[c.ID]; used || c.ID == "" {
+			return ErrChallengeUsed
+		}
+		if !u.TwoFactorEnabled() {
+			return ErrTOTPNotEnabled
+		}
+		if err := u.useSecondFactor(code); err != nil {
+			return err
+		}
+		for id, expires := range u.usedChallenges {
+			if now.After(expires) {
+				delete(u.usedChallenges, id)
+			}
+		}
+		if u.usedChallenges == nil {
+			u.usedChallenges = make(map[string]time.Time)
+		}
+		u.usedChallenges[c.ID] = c.Expires
+		return nil
+	})
+	return err
+}
+
+// DisableTOTP turns two-factor authentication off. It needs a code, like
+// logging in does, so a stolen token alone cannot weaken the account.
+func (s *UserStore) DisableTOTP(id, code string) error {
+	_, err := s.update(id, func(u *User) error {
+		if !u.TwoFactorEnabled() {
+			return ErrTOTPNotEnabled
+		}
+		if err := u.useSecondFactor(code); err != nil {
+			return err
+		}
+		u.totpSecret, u.totpLastStep, u.recoveryCodes = nil, 0, nil
+		return nil
+	})
+	return err
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has.
+func (u *User) RecoveryCodesLeft() int { return len(u.recoveryCodes) }
+
+func (u *User) useSecondFactor(code string) error {
+	if step := totpStep(u.totpSecret, code, time.Now()); step > u.totpLastStep {
+		u.totpLastStep = step
+		return nil
+	}
+	h := hashRecoveryCode(code)
+	for i, rc := range u.recoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(rc), []byte(h)) == 1 {
+			u.recoveryCodes = slices.Delete(slices.Clone(u.recoveryCodes), i, i+1)
+			return nil
+		}
+	}
+	return ErrInvalidCode
+}
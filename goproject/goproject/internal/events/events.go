@@ -0,0 +1,251 @@
+// Package events is an in-memory, per-user publish/subscribe bus. Every
+// event gets an increasing ID, and recent events are kept so that a
+// subscriber that reconnects can resume after the last ID it saw. A user's
+// events are forgotten once nobody has subscribed to them or published any
+// for the resume window.
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSlowConsumer ends a subscription whose buffer filled up. The
+	// subscriber can resubscribe from the last ID it processed.
+	ErrSlowConsumer = errors.New("events: subscriber fell behind")
+	// ErrClosed ends every subscription when the bus is closed.
+	ErrClosed = errors.New("events: bus closed")
+	// ErrRemoved ends a user's subscriptions when Remove is called.
+	ErrRemoved = errors.New("events: user removed")
+)
+
+// Event is one message on the bus.
+type Event struct {
+	ID     uint64
+	UserID string
+	Type   string
+	Data   any
+}
+
+// Bus fans events out to the subscribers of each user.
+type Bus struct {
+	history int
+	buffer  int
+	retain  time.Duration
+
+	mu     sync.Mutex
+	lastID uint64
+	users  map[string]*stream
+	pruned time.Time
+	closed bool
+}
+
+// stream is one user's recent events and live subscribers.
+type stream struct {
+	recent  []Event
+	dropped uint64 // ID of the newest event evicted from recent
+	subs    map[*Subscription]struct{}
+	active  time.Time // last publish, or last subscriber leaving
+}
+
+// NewBus keeps the last history events per user and gives each subscriber a
+// buffer of that many undelivered events before it is cut off. A user's
+// events are kept for resuming until retain has passed with no subscriber
+// and no new event.
+func NewBus(history, buffer int, retain time.Duration) *Bus {
+	return &Bus{history: history, buffer: buffer, retain: retain, users: make(map[string]*stream), pruned: time.Now()}
+}
+
+func (b *Bus) stream(userID string) *stream {
+	st, ok := b.users[userID]
+	if !ok {
+		// Earlier events for the user, if any, were pruned or never seen.
+		st = &stream{dropped: b.lastID, subs: make(map[*Subscription]struct{}), active: time.Now()}
+		b.users[userID] = st
+	}
+	return st
+}
+
+// Publish assigns the next ID to an event and delivers it to the user's
+// subscribers. It never blocks: a subscriber whose buffer is full is
+// closed with ErrSlowConsumer.
+func (b *Bus) Publish(userID, typ string, data any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.pruned) >= b.retain {
+		b.prune(now)
+	}
+	b.lastID++
+	ev := Event{ID: b.lastID, UserID: userID, Type: typ, Data: data}
+	st := b.stream(userID)
+	st.active = now
+	st.recent = append(st.recent, ev)
+	if len(st.recent) > b.history {
+		st.dropped = st.recent[0].ID
+		st.recent = append(st.recent[:0:0], st.recent[1:]...)
+	}
+	for sub := range st.subs {
+		select {
+		case sub.c <- ev:
+		default:
+			b.end(st, sub, ErrSlowConsumer)
+		}
+	}
+	return ev
+}
+
+// Subscribe starts delivering the user's events. If after is non-zero,
+// retained events with a greater ID are delivered first. missed reports
+// that some events after that ID are no longer retained, so the subscriber
+// has to resynchronise some other way.
+func (b *Bus) Subscribe(userID string, after uint64) (sub *Subscription, missed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.stream(userID)
+	var replay []Event
+	if after > 0 {
+		missed = after < st.dropped || after > b.lastID
+		for _, ev := range st.recent {
+			if ev.ID > after {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	c := make(chan Event, b.buffer+len(replay))
+	for _, ev := range replay {
+		c <- ev
+	}
+	sub = &Subscription{C: c, c: c, bus: b, userID: userID}
+	if b.closed {
+		sub.err = ErrClosed
+		close(c)
+		return sub, missed
+	}
+	st.subs[sub] = struct{}{}
+	return sub, missed
+}
+
+// Prune forgets the users that have had no subscriber and no new event
+// since now minus the retain period, and returns how many there were.
+// Publish calls it once per retain period; a later Subscribe for a pruned
+// user starts afresh, and asking to resume reports missed.
+func (b *Bus) Prune(now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.prune(now)
+}
+
+func (b *Bus) prune(now time.Time) int {
+	b.pruned = now
+	n := 0
+	for userID, st := range b.users {
+		if len(st.subs) == 0 && now.Sub(st.active) >= b.retain {
+			delete(b.users, userID)
+			n++
+		}
+	}
+	return n
+}
+
+// Remove forgets a user's events and ends their subscriptions with
+// ErrRemoved, for when the account is deleted.
+func (b *Bus) Remove(userID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.users[userID]
+	if !ok {
+		return
+	}
+	for sub := range st.subs {
+		b.end(st, sub, ErrRemoved)
+	}
+	delete(b.users, userID)
+}
+
+// Users returns the number of users whose events are retained.
+func (b *Bus) Users() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.users)
+}
+
+// Subscribers returns the number of live subscriptions.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, st := range b.users {
+		n += len(st.subs)
+	}
+	return n
+}
+
+// Err returns ErrClosed once the bus is closed, and nil before.
+func (b *Bus) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close ends every subscription with ErrClosed. Later subscriptions are
+// closed immediately.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, st := range b.users {
+		for sub := range st.subs {
+			b.end(st, sub, ErrClosed)
+		}
+	}
+}
+
+// end removes sub and closes its channel. Callers must hold b.mu.
+func (b *Bus) end(st *stream, sub *Subscription, err error) {
+	delete(st.subs, sub)
+	st.active = time.Now()
+	sub.err = err
+	close(sub.c)
+}
+
+// Subscription receives one user's events on C until it is closed.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	bus    *Bus
+	userID string
+	err    error // guarded by bus.mu
+}
+
+// Err explains why C was closed: ErrSlowConsumer, ErrClosed, ErrRemoved,
+// or nil after Close.
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+// Close stops delivery. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	st, ok := s.bus.users[s.userID]
+	if !ok {
+		return // removed, which closed C
+	}
+	if _, ok := st.subs[s]; ok {
+		delete(st.subs, s)
+		st.active = time.Now()
+		close(s.c)
+	}
+}
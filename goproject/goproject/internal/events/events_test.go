@@ -0,0 +1,130 @@
+package events_test
+
+import (
+	"testing"
+	"time"
+
+	"goproject/internal/events"
+)
+
+func drain(sub *events.Subscription) []uint64 {
+	var ids []uint64
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, ev.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestPublishIsPerUser(t *testing.T) {
+	b := events.NewBus(10, 10, time.Hour)
+	alice, _ := b.Subscribe("alice", 0)
+	bob, _ := b.Subscribe("bob", 0)
+	defer alice.Close()
+	defer bob.Close()
+
+	b.Publish("alice", "created", 1)
+	b.Publish("bob", "created", 2)
+	b.Publish("alice", "updated", 3)
+
+	if got := drain(alice); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("alice got %v", got)
+	}
+	if got := drain(bob); len(got) != 1 || got[0] != 2 {
+		t.Errorf("bob got %v", got)
+	}
+}
+
+func TestResumeAfterLastID(t *testing.T) {
+	b := events.NewBus(3, 10, time.Hour)
+	for i := 0; i < 5; i++ {
+		b.Publish("u", "updated", i)
+	}
+
+	sub, missed := b.Subscribe("u", 3)
+	if missed {
+		t.Error("events after 3 are retained, nothing was missed")
+	}
+	if got := drain(sub); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("replay = %v, want [4 5]", got)
+	}
+
+	sub, missed = b.Subscribe("u", 1)
+	if !missed {
+		t.Error("event 2 was evicted, expected missed")
+	}
+	if got := drain(sub); len(got) != 3 {
+		t.Errorf("replay = %v, want the 3 retained events", got)
+	}
+
+	if _, missed := b.Subscribe("u", 99); !missed {
+		t.Error("an ID from the future should count as missed")
+	}
+}
+
+func TestSlowConsumerIsCutOff(t *testing.T) {
+	b := events.NewBus(100, 2, time.Hour)
+	slow, _ := b.Subscribe("u", 0)
+	fast, _ := b.Subscribe("u", 0)
+
+	for i := 0; i < 3; i++ {
+		b.Publish("u", "updated", i)
+		drain(fast)
+	}
+
+	if got := drain(slow); len(got) != 2 {
+		t.Errorf("slow subscriber got %v, want its 2 buffered events", got)
+	}
+	if _, ok := <-slow.C; ok || slow.Err() != events.ErrSlowConsumer {
+		t.Errorf("slow subscriber not closed with ErrSlowConsumer: %v", slow.Err())
+	}
+	if b.Subscribers() != 1 {
+		t.Errorf("subscribers = %d, want 1", b.Subscribers())
+	}
+
+	b.Close()
+	if _, ok := <-fast.C; ok || fast.Err() != events.ErrClosed {
+		t.Errorf("Close did not end subscription: %v", fast.Err())
+	}
+	fast.Close()
+}
+
+func TestPruneIdleUsers(t *testing.T) {
+	b := events.NewBus(10, 10, time.Hour)
+	b.Publish("idle", "created", 1)
+	watched, _ := b.Subscribe("watched", 0)
+	defer watched.Close()
+	b.Publish("watched", "created", 2)
+
+	if n := b.Prune(time.Now()); n != 0 {
+		t.Errorf("pruned %d users inside the resume window", n)
+	}
+	if n := b.Prune(time.Now().Add(time.Hour)); n != 1 || b.Users() != 1 {
+		t.Errorf("pruned %d, %d users left; want only the unsubscribed one gone", n, b.Users())
+	}
+	if _, missed := b.Subscribe("idle", 1); !missed {
+		t.Error("resuming a pruned user should count as missed")
+	}
+}
+
+func TestRemoveEndsSubscriptions(t *testing.T) {
+	b := events.NewBus(10, 10, time.Hour)
+	sub, _ := b.Subscribe("gone", 0)
+	b.Publish("gone", "created", 1)
+
+	b.Remove("gone")
+	drain(sub)
+	if _, ok := <-sub.C; ok || sub.Err() != events.ErrRemoved {
+		t.Errorf("Remove did not end subscription: %v", sub.Err())
+	}
+	sub.Close()
+	if b.Users() != 0 || b.Subscribers() != 0 {
+		t.Errorf("%d users and %d subscribers left after Remove", b.Users(), b.Subscribers())
+	}
+}
@@ -0,0 +1,874 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Error codes set in the "code" extension of request errors.
+const (
+	CodeParseFailed      = "GRAPHQL_PARSE_FAILED"
+	CodeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+	CodeBadUserInput     = "BAD_USER_INPUT"
+	CodeTooComplex       = "QUERY_TOO_COMPLEX"
+)
+
+func requestError(code string, loc *Location, format string, args ...any) *Error {
+	e := &Error{Message: fmt.Sprintf(format, args...), Extensions: map[string]any{"code": code}}
+	if loc != nil {
+		e.Locations = []Location{*loc}
+	}
+	return e
+}
+
+func failed(errs ...*Error) *Response { return &Response{Errors: errs} }
+
+// Prepared is a parsed, validated operation with its variables, ready to
+// run.
+type Prepared struct {
+	s    *Schema
+	doc  *document
+	op   *operation
+	vars map[string]any
+}
+
+// Type returns "query", "mutation" or "subscription".
+func (p *Prepared) Type() string { return p.op.kind }
+
+// Execute runs a query or mutation.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	p, resp := s.Prepare(req)
+	if resp != nil {
+		return resp
+	}
+	if p.Type() == "subscription" {
+		return failed(requestError(CodeValidationFailed, &p.op.loc, "subscriptions must be sent over a streaming transport"))
+	}
+	return p.Execute(ctx)
+}
+
+// Prepare parses and validates a request. On failure it returns a response
+// with the errors instead.
+func (s *Schema) Prepare(req Request) (*Prepared, *Response) {
+	doc, err := parse(req.Query)
+	if err != nil {
+		se := err.(*syntaxError)
+		return nil, failed(requestError(CodeParseFailed, &se.loc, "%s", se.Error()))
+	}
+
+	var op *operation
+	for _, o := range doc.operations {
+		if req.OperationName == "" && len(doc.operations) > 1 {
+			return nil, failed(requestError(CodeValidationFailed, nil, "operationName is required for a document with several operations"))
+		}
+		if req.OperationName == "" || o.name == req.OperationName {
+			op = o
+			break
+		}
+	}
+	if op == nil {
+		return nil, failed(requestError(CodeValidationFailed, nil, "no operation named %q", req.OperationName))
+	}
+
+	p := &Prepared{s: s, doc: doc, op: op}
+	if errs := p.coerceVariables(req.Variables); len(errs) > 0 {
+		return nil, failed(errs...)
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		return nil, failed(errs...)
+	}
+	return p, nil
+}
+
+func (p *Prepared) root() *Object {
+	switch p.op.kind {
+	case "mutation":
+		return p.s.Mutation
+	case "subscription":
+		return p.s.Subscription
+	}
+	return p.s.Query
+}
+
+// ─── input coercion ─────────────────────────────────────────────────────────
+
+// inputType resolves a variable's declared type.
+func (s *Schema) inputType(ref *typeRef) (Type, bool) {
+	var t Type
+	if ref.elem != nil {
+		elem, ok := s.inputType(ref.elem)
+		if !ok {
+			return nil, false
+		}
+		t = ListOf(elem)
+	} else {
+		named, ok := s.types[ref.name]
+		if !ok {
+			return nil, false
+		}
+		if _, out := named.(*Object); out {
+			return nil, false
+		}
+		t = named
+	}
+	if ref.nonNull {
+		t = NonNullOf(t)
+	}
+	return t, true
+}
+
+func (p *Prepared) coerceVariables(given map[string]any) []*Error {
+	var errs []*Error
+	p.vars = make(map[string]any)
+	for _, d := range p.op.vars {
+		t, ok := p.s.inputType(d.typ)
+		if !ok {
+			errs = append(errs, requestError(CodeValidationFailed, &d.loc, "variable $%s has unknown or non-input type %s", d.name, d.typ))
+			continue
+		}
+		v, present := given[d.name]
+		if !present {
+			if d.def != nil {
+				val, _, err := p.literal(t, d.def)
+				if err != nil {
+					errs = append(errs, requestError(CodeValidationFailed, &d.loc, "default of $%s: %v", d.name, err))
+					continue
+				}
+				p.vars[d.name] = val
+			} else if _, nn := t.(*NonNull); nn {
+				errs = append(errs, requestError(CodeBadUserInput, &d.loc, "variable $%s of type %s is required", d.name, t))
+			}
+			continue
+		}
+		val, err := coerceJSON(t, v)
+		if err != nil {
+			errs = append(errs, requestError(CodeBadUserInput, &d.loc, "variable $%s: %v", d.name, err))
+			continue
+		}
+		p.vars[d.name] = val
+	}
+	return errs
+}
+
+// coerceJSON converts a variable value to type t.
+func coerceJSON(t Type, v any) (any, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("expected %s, got null", t)
+		}
+		return coerceJSON(nn.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *List:
+		items, ok := v.([]any)
+		if !ok {
+			items = []any{v}
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			c, err := coerceJSON(t.Of, item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = c
+		}
+		return out, nil
+	case *InputObject:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected %s object", t.Name)
+		}
+		out := make(map[string]any)
+		for k := range m {
+			if inputField(t, k) == nil {
+				return nil, fmt.Errorf("%s has no field %q", t.Name, k)
+			}
+		}
+		for _, f := range t.Fields {
+			fv, present := m[f.Name]
+			if !present {
+				if err := applyDefault(out, f); err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", t.Name, f.Name, err)
+				}
+				continue
+			}
+			c, err := coerceJSON(f.Type, fv)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.Name, f.Name, err)
+			}
+			out[f.Name] = c
+		}
+		return out, nil
+	case *Enum:
+		if name, ok := v.(string); ok {
+			for _, ev := range t.Values {
+				if ev.Name == name {
+					return ev.Value, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("expected a value of enum %s", t.Name)
+	case *Scalar:
+		if c, ok := t.Parse(v); ok {
+			return c, nil
+		}
+		return nil, fmt.Errorf("expected %s", t.Name)
+	}
+	return nil, fmt.Errorf("%s is not an input type", t)
+}
+
+func inputField(t *InputObject, name string) *Argument {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// applyDefault fills in an omitted argument or input field.
+func applyDefault(out map[string]any, a *Argument) error {
+	if a.Default != nil {
+		out[a.Name] = a.Default
+		return nil
+	}
+	if _, nn := a.Type.(*NonNull); nn {
+		return fmt.Errorf("required %s is missing", a.Type)
+	}
+	return nil
+}
+
+// literal converts a value in the query to type t. present is false for a
+// variable that was not provided, which makes the argument count as
+// omitted.
+func (p *Prepared) literal(t Type, v *value) (val any, present bool, err error) {
+	if v.kind == varValue {
+		if !p.defined(v.raw) {
+			return nil, false, fmt.Errorf("variable $%s is not defined", v.raw)
+		}
+		val, present = p.vars[v.raw]
+		if _, nn := t.(*NonNull); nn && val == nil {
+			return nil, false, fmt.Errorf("expected %s, variable $%s is null or missing", t, v.raw)
+		}
+		return val, present, nil
+	}
+	if nn, ok := t.(*NonNull); ok {
+		if v.kind == nullValue {
+			return nil, false, fmt.Errorf("expected %s, got null", t)
+		}
+		return p.literal(nn.Of, v)
+	}
+	if v.kind == nullValue {
+		return nil, true, nil
+	}
+	switch t := t.(type) {
+	case *List:
+		items := v.list
+		if v.kind != listValue {
+			items = []*value{v}
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			c, _, err := p.literal(t.Of, item)
+			if err != nil {
+				return nil, false, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = c
+		}
+		return out, true, nil
+	case *InputObject:
+		if v.kind != objectValue {
+			return nil, false, fmt.Errorf("expected %s object", t.Name)
+		}
+		given := make(map[string]*value, len(v.fields))
+		for _, f := range v.fields {
+			if inputField(t, f.name) == nil {
+				return nil, false, fmt.Errorf("%s has no field %q", t.Name, f.name)
+			}
+			if given[f.name] != nil {
+				return nil, false, fmt.Errorf("field %q is given twice", f.name)
+			}
+			given[f.name] = f.val
+		}
+		out := make(map[string]any)
+		for _, f := range t.Fields {
+			fv, ok := given[f.Name]
+			var c any
+			var present bool
+			if ok {
+				if c, present, err = p.literal(f.Type, fv); err != nil {
+					return nil, false, fmt.Errorf("%s.%s: %w", t.Name, f.Name, err)
+				}
+			}
+			if !present {
+				if err := applyDefault(out, f); err != nil {
+					return nil, false, fmt.Errorf("%s.%s: %w", t.Name, f.Name, err)
+				}
+				continue
+			}
+			out[f.Name] = c
+		}
+		return out, true, nil
+	case *Enum:
+		if v.kind == enumValue {
+			for _, ev := range t.Values {
+				if ev.Name == v.raw {
+					return ev.Value, true, nil
+				}
+			}
+		}
+		return nil, false, fmt.Errorf("expected a value of enum %s", t.Name)
+	case *Scalar:
+		var raw any
+		switch v.kind {
+		case intValue:
+			n, err := strconv.ParseInt(v.raw, 10, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("integer %s is out of range", v.raw)
+			}
+			raw = n
+		case floatValue:
+			raw, _ = strconv.ParseFloat(v.raw, 64)
+		case stringValue:
+			raw = v.raw
+		case boolValue:
+			raw = v.raw == "true"
+		}
+		if c, ok := t.Parse(raw); ok && raw != nil {
+			return c, true, nil
+		}
+		return nil, false, fmt.Errorf("expected %s", t.Name)
+	}
+	return nil, false, fmt.Errorf("%s is not an input type", t)
+}
+
+func (p *Prepared) defined(name string) bool {
+	for _, d := range p.op.vars {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// args coerces the arguments of a field.
+func (p *Prepared) args(defs []*Argument, given []*argument) (map[string]any, error) {
+	byName := make(map[string]*argument, len(given))
+	for _, a := range given {
+		if byName[a.name] != nil {
+			return nil, fmt.Errorf("argument %q is given twice", a.name)
+		}
+		byName[a.name] = a
+	}
+	out := make(map[string]any)
+	for _, d := range defs {
+		a, ok := byName[d.Name]
+		delete(byName, d.Name)
+		if ok {
+			v, present, err := p.literal(d.Type, a.val)
+			if err != nil {
+				return nil, fmt.Errorf("argument %q: %w", d.Name, err)
+			}
+			if present {
+				out[d.Name] = v
+				continue
+			}
+		}
+		if err := applyDefault(out, d); err != nil {
+			return nil, fmt.Errorf("argument %q: %w", d.Name, err)
+		}
+	}
+	for name := range byName {
+		return nil, fmt.Errorf("unknown argument %q", name)
+	}
+	return out, nil
+}
+
+// ─── validation ─────────────────────────────────────────────────────────────
+
+// field finds a field of obj, including the introspection fields of the
+// query type.
+func (s *Schema) field(obj *Object, name string) *Field {
+	if f := obj.byName[name]; f != nil {
+		return f
+	}
+	if obj == s.Query && !s.DisableIntrospection {
+		return s.intro[name]
+	}
+	return nil
+}
+
+// included evaluates @skip and @include.
+func (p *Prepared) included(dirs []*directive) (bool, error) {
+	for _, d := range dirs {
+		if d.name != "skip" && d.name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", d.name)
+		}
+		args, err := p.args([]*Argument{{Name: "if", Type: NonNullOf(Boolean)}}, d.args)
+		if err != nil {
+			return false, fmt.Errorf("@%s: %w", d.name, err)
+		}
+		if args["if"].(bool) == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// maxIntrospectionDepth caps the depth of __schema and __type selections,
+// which do not count towards Schema.MaxDepth: the introspection query of
+// common tools nests ofType a dozen levels deep.
+const maxIntrospectionDepth = 15
+
+type checker struct {
+	p        *Prepared
+	errs     []*Error
+	visiting map[string]bool
+	// fragments holds the depth and cost of each fragment checked, so a
+	// fragment spread many times is walked once.
+	fragments map[string][2]int
+	// tooComplex is set, and the walk stopped, once a limit is passed.
+	tooComplex *Error
+}
+
+func (c *checker) fail(loc Location, format string, args ...any) {
+	c.errs = append(c.errs, requestError(CodeValidationFailed, &loc, format, args...))
+}
+
+func (p *Prepared) validate() []*Error {
+	root := p.root()
+	if root == nil {
+		return []*Error{requestError(CodeValidationFailed, &p.op.loc, "this schema does not support %ss", p.op.kind)}
+	}
+	c := &checker{p: p, visiting: make(map[string]bool), fragments: make(map[string][2]int)}
+	if p.op.kind == "subscription" {
+		if fields := p.collect(root, p.op.sel); len(fields.keys) != 1 {
+			c.fail(p.op.loc, "a subscription must select exactly one top-level field")
+		}
+	}
+	c.selectionSet(root, p.op.sel, 1, p.s.MaxDepth, true)
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	if c.tooComplex != nil {
+		return []*Error{c.tooComplex}
+	}
+	return nil
+}
+
+// exceeds reports whether a limit has been passed, recording the first
+// one passed.
+func (c *checker) exceeds(depth, maxDepth, cost int) bool {
+	switch {
+	case c.tooComplex != nil:
+	case maxDepth > 0 && depth > maxDepth:
+		c.tooComplex = requestError(CodeTooComplex, &c.p.op.loc, "query depth %d exceeds the limit of %d", depth, maxDepth)
+	case c.p.s.MaxComplexity > 0 && cost > c.p.s.MaxComplexity:
+		c.tooComplex = requestError(CodeTooComplex, &c.p.op.loc, "query complexity %d exceeds the limit of %d", cost, c.p.s.MaxComplexity)
+	}
+	return c.tooComplex != nil
+}
+
+// addCost adds costs without overflowing.
+func addCost(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// selectionSet checks sel against obj, whose fields are at depth, and
+// returns the depth of its deepest selection relative to obj and the total
+// cost. The walk stops once the depth passes maxDepth or, at the top
+// level, the cost passes the schema's limit.
+func (c *checker) selectionSet(obj *Object, sel []*selection, depth, maxDepth int, top bool) (relDepth, cost int) {
+	if len(sel) > 0 && c.exceeds(depth, maxDepth, 0) {
+		return 0, 0
+	}
+	for _, s := range sel {
+		if c.tooComplex != nil {
+			return relDepth, cost
+		}
+		ok, err := c.p.included(s.dirs)
+		if err != nil {
+			c.fail(s.loc, "%v", err)
+			continue
+		}
+		limit := maxDepth
+		if !ok {
+			limit = 0 // skipped selections are checked but not limited
+		}
+		var d, n int
+		switch {
+		case s.spread != "":
+			f := c.p.doc.fragments[s.spread]
+			switch {
+			case f == nil:
+				c.fail(s.loc, "unknown fragment %q", s.spread)
+				continue
+			case c.visiting[f.name]:
+				c.fail(s.loc, "fragment %q spreads itself", f.name)
+				continue
+			case f.on != obj.Name:
+				c.fail(s.loc, "fragment %q on %s cannot be spread on %s", f.name, f.on, obj.Name)
+				continue
+			}
+			memo, seen := c.fragments[f.name]
+			if !seen {
+				c.visiting[f.name] = true
+				memo[0], memo[1] = c.selectionSet(obj, f.sel, depth, limit, false)
+				c.visiting[f.name] = false
+				c.fragments[f.name] = memo
+			}
+			d, n = memo[0], memo[1]
+		case s.inline:
+			if s.on != "" && s.on != obj.Name {
+				c.fail(s.loc, "fragment on %s cannot be spread on %s", s.on, obj.Name)
+				continue
+			}
+			d, n = c.selectionSet(obj, s.sel, depth, limit, false)
+		default:
+			d, n = c.field(obj, s, depth, limit)
+			d++
+		}
+		if !ok {
+			continue
+		}
+		relDepth = max(relDepth, d)
+		cost = addCost(cost, n)
+		if c.exceeds(depth-1+relDepth, maxDepth, 0) || top && c.exceeds(0, 0, cost) {
+			return relDepth, cost
+		}
+	}
+	return relDepth, cost
+}
+
+// field checks one field and returns the depth of its subfields and its
+// cost, at least 1.
+func (c *checker) field(obj *Object, s *selection, depth, maxDepth int) (relDepth, cost int) {
+	if s.name == "__typename" {
+		if len(s.sel) > 0 {
+			c.fail(s.loc, "__typename has no fields")
+		}
+		return 0, 1
+	}
+	f := c.p.s.field(obj, s.name)
+	if f == nil {
+		c.fail(s.loc, "cannot query field %q on type %s", s.name, obj.Name)
+		return 0, 0
+	}
+	args, err := c.p.args(f.Args, s.args)
+	if err != nil {
+		c.fail(s.loc, "%s.%s: %v", obj.Name, f.Name, err)
+		return 0, 0
+	}
+	_, intro := c.p.s.intro[s.name]
+	if intro = intro && obj == c.p.s.Query; intro {
+		maxDepth = depth - 1 + maxIntrospectionDepth
+	}
+
+	var child int
+	if sub, ok := named(f.Type).(*Object); ok {
+		if len(s.sel) == 0 {
+			c.fail(s.loc, "field %q of type %s must have a selection of subfields", s.name, f.Type)
+			return 0, 0
+		}
+		relDepth, child = c.selectionSet(sub, s.sel, depth+1, maxDepth, false)
+		if intro {
+			relDepth = 0 // checked against its own cap
+		}
+	} else if len(s.sel) > 0 {
+		c.fail(s.loc, "field %q of type %s has no subfields", s.name, f.Type)
+		return 0, 0
+	}
+	if f.Complexity != nil {
+		return relDepth, max(1, f.Complexity(args, child))
+	}
+	return relDepth, addCost(1, child)
+}
+
+// ─── execution ──────────────────────────────────────────────────────────────
+
+// fieldSet is the fields of a selection set grouped by response key, in
+// order.
+type fieldSet struct {
+	keys   []string
+	groups map[string][]*selection
+}
+
+// collect groups the fields selected on obj, expanding fragments and
+// applying @skip and @include. Validation has run, so errors are ignored.
+func (p *Prepared) collect(obj *Object, sel []*selection) *fieldSet {
+	fs := &fieldSet{groups: make(map[string][]*selection)}
+	visited := make(map[string]bool)
+	var walk func([]*selection)
+	walk = func(sel []*selection) {
+		for _, s := range sel {
+			if ok, _ := p.included(s.dirs); !ok {
+				continue
+			}
+			switch {
+			case s.spread != "":
+				if visited[s.spread] {
+					continue
+				}
+				visited[s.spread] = true
+				walk(p.doc.fragments[s.spread].sel)
+			case s.inline:
+				walk(s.sel)
+			default:
+				key := s.responseKey()
+				if _, seen := fs.groups[key]; !seen {
+					fs.keys = append(fs.keys, key)
+				}
+				fs.groups[key] = append(fs.groups[key], s)
+			}
+		}
+	}
+	walk(sel)
+	return fs
+}
+
+type execution struct {
+	*Prepared
+	ctx  context.Context
+	errs []*Error
+}
+
+// Execute runs the operation. It must not be a subscription.
+func (p *Prepared) Execute(ctx context.Context) *Response {
+	return p.run(ctx, nil)
+}
+
+func (p *Prepared) run(ctx context.Context, source any) *Response {
+	ex := &execution{Prepared: p, ctx: ctx}
+	data, _ := ex.selectionSet(p.root(), source, p.op.sel, nil)
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return failed(&Error{Message: "cannot encode result: " + err.Error()})
+	}
+	return &Response{Data: raw, Errors: ex.errs}
+}
+
+func (ex *execution) fail(s *selection, path []any, err error) {
+	e, ok := err.(*Error)
+	if ok {
+		c := *e
+		e = &c
+	} else {
+		e = &Error{Message: err.Error()}
+	}
+	e.Locations = []Location{s.loc}
+	e.Path = append([]any(nil), path...)
+	ex.errs = append(ex.errs, e)
+}
+
+func isNonNull(t Type) bool {
+	_, ok := t.(*NonNull)
+	return ok
+}
+
+// selectionSet executes the fields selected on obj. errored means a
+// non-null field became null, so the object itself must be null.
+func (ex *execution) selectionSet(obj *Object, source any, sel []*selection, path []any) (out *orderedMap, errored bool) {
+	fs := ex.collect(obj, sel)
+	out = &orderedMap{keys: fs.keys, values: make([]any, len(fs.keys))}
+	for i, key := range fs.keys {
+		group := fs.groups[key]
+		if group[0].name == "__typename" {
+			out.values[i] = obj.Name
+			continue
+		}
+		f := ex.s.field(obj, group[0].name)
+		v, errored := ex.field(obj, f, source, group, append(path, key))
+		if v == nil && errored && isNonNull(f.Type) {
+			return nil, true
+		}
+		out.values[i] = v
+	}
+	return out, false
+}
+
+func (ex *execution) field(obj *Object, f *Field, source any, group []*selection, path []any) (v any, errored bool) {
+	if err := ex.ctx.Err(); err != nil {
+		ex.fail(group[0], path, err)
+		return nil, true
+	}
+	args, err := ex.args(f.Args, group[0].args)
+	if err != nil {
+		ex.fail(group[0], path, err)
+		return nil, true
+	}
+	resolved, err := ex.resolve(obj, f, Params{Context: ex.ctx, Source: source, Args: args})
+	if err != nil {
+		ex.fail(group[0], path, err)
+		return nil, true
+	}
+	return ex.complete(f.Type, group, path, resolved)
+}
+
+func (ex *execution) resolve(obj *Object, f *Field, p Params) (v any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error resolving %s.%s", obj.Name, f.Name)
+		}
+	}()
+	switch {
+	case f.Resolve != nil:
+		return f.Resolve(p)
+	case obj == ex.s.Subscription:
+		return p.Source, nil
+	}
+	if m, ok := p.Source.(map[string]any); ok {
+		return m[f.Name], nil
+	}
+	return nil, nil
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func (ex *execution) complete(t Type, group []*selection, path []any, v any) (any, bool) {
+	if nn, ok := t.(*NonNull); ok {
+		out, errored := ex.complete(nn.Of, group, path, v)
+		if out == nil {
+			if !errored {
+				ex.fail(group[0], path, fmt.Errorf("cannot return null for non-null field of type %s", t))
+			}
+			return nil, true
+		}
+		return out, false
+	}
+	if isNil(v) {
+		return nil, false
+	}
+
+	switch t := t.(type) {
+	case *List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			ex.fail(group[0], path, fmt.Errorf("expected a list for %s", t))
+			return nil, true
+		}
+		out := make([]any, rv.Len())
+		for i := range out {
+			item, errored := ex.complete(t.Of, group, append(path, i), rv.Index(i).Interface())
+			if item == nil && errored && isNonNull(t.Of) {
+				return nil, true
+			}
+			out[i] = item
+		}
+		return out, false
+	case *Scalar:
+		out, ok := t.Serialize(v)
+		if !ok {
+			ex.fail(group[0], path, fmt.Errorf("cannot serialize %T as %s", v, t.Name))
+			return nil, true
+		}
+		return out, false
+	case *Enum:
+		for _, ev := range t.Values {
+			if ev.Value == v {
+				return ev.Name, false
+			}
+		}
+		ex.fail(group[0], path, fmt.Errorf("%v is not a value of enum %s", v, t.Name))
+		return nil, true
+	case *Object:
+		var sel []*selection
+		for _, s := range group {
+			sel = append(sel, s.sel...)
+		}
+		out, errored := ex.selectionSet(t, v, sel, path)
+		if errored {
+			return nil, true
+		}
+		return out, false
+	}
+	return nil, false
+}
+
+// Subscribe starts a subscription. The channel gets one response per
+// source event and is closed when the source ends or ctx is done.
+func (p *Prepared) Subscribe(ctx context.Context) (<-chan *Response, *Response) {
+	if p.op.kind != "subscription" {
+		return nil, failed(requestError(CodeValidationFailed, &p.op.loc, "operation is a %s, not a subscription", p.op.kind))
+	}
+	fs := p.collect(p.s.Subscription, p.op.sel)
+	s := fs.groups[fs.keys[0]][0]
+	f := p.s.field(p.s.Subscription, s.name)
+	args, err := p.args(f.Args, s.args)
+	if err != nil {
+		return nil, failed(&Error{Message: err.Error(), Locations: []Location{s.loc}})
+	}
+	stream, err := f.Subscribe(Params{Context: ctx, Args: args})
+	if err != nil {
+		ex := &execution{Prepared: p, ctx: ctx}
+		ex.fail(s, []any{s.responseKey()}, err)
+		return nil, failed(ex.errs...)
+	}
+
+	out := make(chan *Response)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case ev, ok := <-stream:
+				if !ok {
+					return
+				}
+				select {
+				case out <- p.run(ctx, ev):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// orderedMap is a JSON object that keeps the order of its keys, as the
+// GraphQL response format requires.
+type orderedMap struct {
+	keys   []string
+	values []any
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,388 @@
+// Package graphql is a small GraphQL server: a parser for executable
+// documents, a schema of Go-defined object, input, enum and scalar types,
+// and an executor for queries, mutations and subscriptions. Requests are
+// validated before they run, and can be limited in depth and complexity.
+//
+// Interfaces, unions and custom directives are not supported; @skip and
+// @include are.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Type is a GraphQL type: *Scalar, *Enum, *Object, *InputObject, *List or
+// *NonNull.
+type Type interface {
+	String() string // type reference syntax, such as "[Note!]!"
+}
+
+// Scalar is a leaf type. Parse converts an input value (a literal or a
+// variable decoded with json.Decoder.UseNumber) to its Go value; Serialize
+// converts a resolved Go value to its JSON form. Both report false for a
+// value of the wrong type.
+type Scalar struct {
+	Name        string
+	Description string
+	Parse       func(v any) (any, bool)
+	Serialize   func(v any) (any, bool)
+}
+
+// EnumValue is one value of an Enum. Value is what resolvers see and
+// return.
+type EnumValue struct {
+	Name        string
+	Description string
+	Value       any
+}
+
+type Enum struct {
+	Name        string
+	Description string
+	Values      []EnumValue
+}
+
+// Object is an output type with fields.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+
+	byName map[string]*Field
+}
+
+// InputObject is an argument type with fields. Coerced values are
+// map[string]any holding only the fields the client gave, so resolvers can
+// tell an omitted field from an explicit null.
+type InputObject struct {
+	Name        string
+	Description string
+	Fields      []*Argument
+}
+
+type List struct{ Of Type }
+
+type NonNull struct{ Of Type }
+
+func ListOf(t Type) *List       { return &List{Of: t} }
+func NonNullOf(t Type) *NonNull { return &NonNull{Of: t} }
+
+func (t *Scalar) String() string      { return t.Name }
+func (t *Enum) String() string        { return t.Name }
+func (t *Object) String() string      { return t.Name }
+func (t *InputObject) String() string { return t.Name }
+func (t *List) String() string        { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string     { return t.Of.String() + "!" }
+
+// Field is a field of an Object.
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*Argument
+
+	// Resolve returns the field's value. Nil means the parent's value is a
+	// map[string]any holding the field by name.
+	Resolve func(p Params) (any, error)
+
+	// Subscribe, on a field of the subscription type, returns the stream
+	// of source events. Each event is passed to Resolve as p.Source. The
+	// stream ends when the channel is closed or p.Context is done.
+	Subscribe func(p Params) (<-chan any, error)
+
+	// Complexity returns the cost of the field given its arguments and the
+	// cost of its selection set. Nil means 1 + child.
+	Complexity func(args map[string]any, child int) int
+}
+
+// Argument is an argument of a field, or a field of an input object.
+// Default is a Go value as Parse would return it.
+type Argument struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     any
+}
+
+// Params is passed to resolvers.
+type Params struct {
+	Context context.Context
+	Source  any
+	Args    map[string]any
+}
+
+// Error is a GraphQL error. Resolvers may return one to set Extensions,
+// such as a machine-readable "code"; any other error becomes an Error with
+// its message.
+type Error struct {
+	Message    string         `json:"message"`
+	Locations  []Location     `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is absent when the request
+// failed before execution.
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []*Error        `json:"errors,omitempty"`
+}
+
+// ─── schema ─────────────────────────────────────────────────────────────────
+
+// Schema is a validated set of types. The limits apply to every request;
+// zero means no limit. Every selection costs at least 1. Introspection
+// fields (__schema, __type) count towards MaxComplexity but have their own
+// depth limit of 15.
+type Schema struct {
+	Query        *Object
+	Mutation     *Object
+	Subscription *Object
+
+	MaxDepth             int
+	MaxComplexity        int
+	DisableIntrospection bool
+
+	types map[string]Type
+	order []string          // type names in definition order
+	intro map[string]*Field // __schema and __type
+}
+
+// NewSchema collects and checks every type reachable from the root types.
+func NewSchema(query, mutation, subscription *Object) (*Schema, error) {
+	s := &Schema{Query: query, Mutation: mutation, Subscription: subscription, types: make(map[string]Type)}
+	if query == nil {
+		return nil, errors.New("graphql: schema needs a query type")
+	}
+	for _, t := range []Type{String, Int, Float, Boolean, ID} {
+		if err := s.add(t); err != nil {
+			return nil, err
+		}
+	}
+	for _, root := range []*Object{query, mutation, subscription} {
+		if root != nil {
+			if err := s.add(root); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.addIntrospection(); err != nil {
+		return nil, err
+	}
+	if subscription != nil {
+		for _, f := range subscription.Fields {
+			if f.Subscribe == nil {
+				return nil, fmt.Errorf("graphql: subscription field %s has no Subscribe", f.Name)
+			}
+		}
+	}
+	return s, nil
+}
+
+func named(t Type) Type {
+	for {
+		switch w := t.(type) {
+		case *List:
+			t = w.Of
+		case *NonNull:
+			t = w.Of
+		default:
+			return t
+		}
+	}
+}
+
+func typeName(t Type) string {
+	switch t := t.(type) {
+	case *Scalar:
+		return t.Name
+	case *Enum:
+		return t.Name
+	case *Object:
+		return t.Name
+	case *InputObject:
+		return t.Name
+	}
+	return ""
+}
+
+// add registers t and every type it refers to.
+func (s *Schema) add(t Type) error {
+	t = named(t)
+	name := typeName(t)
+	if prev, ok := s.types[name]; ok {
+		if prev != t {
+			return fmt.Errorf("graphql: two types are named %s", name)
+		}
+		return nil
+	}
+	s.types[name] = t
+	s.order = append(s.order, name)
+
+	switch t := t.(type) {
+	case *Object:
+		if len(t.Fields) == 0 {
+			return fmt.Errorf("graphql: object %s has no fields", name)
+		}
+		t.byName = make(map[string]*Field, len(t.Fields))
+		for _, f := range t.Fields {
+			if _, dup := t.byName[f.Name]; dup {
+				return fmt.Errorf("graphql: %s.%s is defined twice", name, f.Name)
+			}
+			t.byName[f.Name] = f
+			if err := s.addOutput(name+"."+f.Name, f.Type); err != nil {
+				return err
+			}
+			for _, a := range f.Args {
+				if err := s.addInput(name+"."+f.Name+"("+a.Name+")", a.Type); err != nil {
+					return err
+				}
+			}
+		}
+	case *InputObject:
+		for _, a := range t.Fields {
+			if err := s.addInput(name+"."+a.Name, a.Type); err != nil {
+				return err
+			}
+		}
+	case *Enum:
+		if len(t.Values) == 0 {
+			return fmt.Errorf("graphql: enum %s has no values", name)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) addOutput(where string, t Type) error {
+	if _, ok := named(t).(*InputObject); ok {
+		return fmt.Errorf("graphql: %s has input type %s", where, t)
+	}
+	return s.add(t)
+}
+
+func (s *Schema) addInput(where string, t Type) error {
+	if _, ok := named(t).(*Object); ok {
+		return fmt.Errorf("graphql: %s has output type %s", where, t)
+	}
+	return s.add(t)
+}
+
+// ─── built-in scalars ───────────────────────────────────────────────────────
+
+func parseInt(v any) (any, bool) {
+	var f float64
+	switch v := v.(type) {
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return nil, false
+		}
+		f = n
+	default:
+		return nil, false
+	}
+	if f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+		return nil, false
+	}
+	return int(f), true
+}
+
+func parseFloat(v any) (any, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return nil, false
+}
+
+func parseString(v any) (any, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
+
+func parseBoolean(v any) (any, bool) {
+	b, ok := v.(bool)
+	return b, ok
+}
+
+func parseID(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return v.String(), true
+		}
+	}
+	return nil, false
+}
+
+func serializeInt(v any) (any, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int32:
+		return v, true
+	case int64:
+		return v, v >= math.MinInt32 && v <= math.MaxInt32
+	case uint64:
+		return v, v <= math.MaxInt32
+	}
+	return nil, false
+}
+
+func serializeFloat(v any) (any, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, !math.IsInf(v, 0) && !math.IsNaN(v)
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return nil, false
+}
+
+func serializeID(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.Itoa(v), true
+	}
+	return nil, false
+}
+
+// The built-in scalars.
+var (
+	Int     = &Scalar{Name: "Int", Description: "A 32-bit signed integer.", Parse: parseInt, Serialize: serializeInt}
+	Float   = &Scalar{Name: "Float", Description: "A double-precision number.", Parse: parseFloat, Serialize: serializeFloat}
+	String  = &Scalar{Name: "String", Description: "UTF-8 text.", Parse: parseString, Serialize: parseString}
+	Boolean = &Scalar{Name: "Boolean", Description: "true or false.", Parse: parseBoolean, Serialize: parseBoolean}
+	ID      = &Scalar{Name: "ID", Description: "An opaque identifier, serialized as a string.", Parse: parseID, Serialize: serializeID}
+)
@@ -0,0 +1,267 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"goproject/internal/graphql"
+)
+
+type item struct {
+	ID    int
+	Title string
+	Tags  []string
+}
+
+func testSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+	items := []*item{{1, "one", []string{"a"}}, {2, "two", []string{}}}
+	color := &graphql.Enum{Name: "Color", Values: []graphql.EnumValue{{Name: "RED", Value: "red"}, {Name: "BLUE", Value: "blue"}}}
+	itemType := &graphql.Object{Name: "Item", Fields: []*graphql.Field{
+		{Name: "id", Type: graphql.NonNullOf(graphql.ID), Resolve: func(p graphql.Params) (any, error) { return p.Source.(*item).ID, nil }},
+		{Name: "title", Type: graphql.NonNullOf(graphql.String), Resolve: func(p graphql.Params) (any, error) { return p.Source.(*item).Title, nil }},
+		{Name: "tags", Type: graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(graphql.String))), Resolve: func(p graphql.Params) (any, error) {
+			return p.Source.(*item).Tags, nil
+		}},
+		{Name: "broken", Type: graphql.NonNullOf(graphql.String), Resolve: func(graphql.Params) (any, error) {
+			return nil, &graphql.Error{Message: "no", Extensions: map[string]any{"code": "FORBIDDEN"}}
+		}},
+		{Name: "color", Type: color, Resolve: func(graphql.Params) (any, error) { return "blue", nil }},
+	}}
+	itemType.Fields = append(itemType.Fields, &graphql.Field{Name: "next", Type: itemType, Resolve: func(p graphql.Params) (any, error) {
+		return items[p.Source.(*item).ID%len(items)], nil
+	}})
+	input := &graphql.InputObject{Name: "ItemInput", Fields: []*graphql.Argument{
+		{Name: "title", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "tags", Type: graphql.ListOf(graphql.String)},
+	}}
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "items", Type: graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(itemType))),
+			Args: []*graphql.Argument{{Name: "first", Type: graphql.Int, Default: 10}},
+			Resolve: func(p graphql.Params) (any, error) {
+				return items[:min(p.Args["first"].(int), len(items))], nil
+			},
+			Complexity: func(args map[string]any, child int) int { return args["first"].(int) * child },
+		},
+		{Name: "item", Type: itemType, Args: []*graphql.Argument{{Name: "id", Type: graphql.NonNullOf(graphql.ID)}},
+			Resolve: func(p graphql.Params) (any, error) {
+				for _, it := range items {
+					if p.Args["id"] == strconv.Itoa(it.ID) {
+						return it, nil
+					}
+				}
+				return nil, nil
+			}},
+	}}
+	mutation := &graphql.Object{Name: "Mutation", Fields: []*graphql.Field{
+		{Name: "add", Type: graphql.NonNullOf(itemType), Args: []*graphql.Argument{{Name: "input", Type: graphql.NonNullOf(input)}},
+			Resolve: func(p graphql.Params) (any, error) {
+				in := p.Args["input"].(map[string]any)
+				it := &item{ID: len(items) + 1, Title: in["title"].(string), Tags: []string{}}
+				if _, ok := in["tags"]; ok {
+					for _, tag := range in["tags"].([]any) {
+						it.Tags = append(it.Tags, tag.(string))
+					}
+				}
+				items = append(items, it)
+				return it, nil
+			}},
+	}}
+	subscription := &graphql.Object{Name: "Subscription", Fields: []*graphql.Field{
+		{Name: "ticks", Type: graphql.NonNullOf(graphql.Int), Args: []*graphql.Argument{{Name: "n", Type: graphql.NonNullOf(graphql.Int)}},
+			Subscribe: func(p graphql.Params) (<-chan any, error) {
+				n := p.Args["n"].(int)
+				if n < 0 {
+					return nil, errors.New("n must not be negative")
+				}
+				ch := make(chan any)
+				go func() {
+					defer close(ch)
+					for i := 1; i <= n; i++ {
+						ch <- i
+					}
+				}()
+				return ch, nil
+			}},
+	}}
+	s, err := graphql.NewSchema(query, mutation, subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// run executes a request and returns its JSON encoding.
+func run(t *testing.T, s *graphql.Schema, query string, vars map[string]any) string {
+	t.Helper()
+	b, err := json.Marshal(s.Execute(context.Background(), graphql.Request{Query: query, Variables: vars}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestExecute(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct {
+		name, query string
+		vars        map[string]any
+		want        string
+	}{
+		{"aliases and fragments",
+			`{ items(first: 1) { ...f next { t: title } } } fragment f on Item { id title tags __typename }`, nil,
+			`{"data":{"items":[{"id":"1","title":"one","tags":["a"],"__typename":"Item","next":{"t":"two"}}]}}`},
+		{"variables and directives",
+			`query($id: ID!, $skip: Boolean = true) { item(id: $id) { title color tags @skip(if: $skip) } }`, map[string]any{"id": "2"},
+			`{"data":{"item":{"title":"two","color":"BLUE"}}}`},
+		{"null item", `{ item(id: 9) { title } }`, nil, `{"data":{"item":null}}`},
+		{"error nulls the nearest nullable parent",
+			`{ item(id: 1) { title broken } }`, nil,
+			`{"data":{"item":null},"errors":[{"message":"no","locations":[{"line":1,"column":23}],"path":["item","broken"],"extensions":{"code":"FORBIDDEN"}}]}`},
+		{"mutation with input",
+			`mutation { add(input: {title: "three", tags: ["x", "y"]}) { id tags } }`, nil,
+			`{"data":{"add":{"id":"3","tags":["x","y"]}}}`},
+		{"input variable",
+			`mutation($in: ItemInput!) { add(input: $in) { title tags } }`, map[string]any{"in": map[string]any{"title": "four"}},
+			`{"data":{"add":{"title":"four","tags":[]}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(t, s, tt.query, tt.vars); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	s := testSchema(t)
+	tests := []struct{ query, code, message string }{
+		{`{ items { title `, graphql.CodeParseFailed, "unexpected end of document"},
+		{`{ items { nope } }`, graphql.CodeValidationFailed, `cannot query field "nope" on type Item`},
+		{`{ items }`, graphql.CodeValidationFailed, "must have a selection of subfields"},
+		{`{ item { title } }`, graphql.CodeValidationFailed, `required ID! is missing`},
+		{`{ items(first: "x") { id } }`, graphql.CodeValidationFailed, "expected Int"},
+		{`{ ...f } fragment f on Query { ...f }`, graphql.CodeValidationFailed, "spreads itself"},
+		{`query($n: Int!) { items(first: $n) { id } }`, graphql.CodeBadUserInput, "is required"},
+		{`subscription { ticks(n: 1) }`, graphql.CodeValidationFailed, "streaming transport"},
+	}
+	for _, tt := range tests {
+		resp := s.Execute(context.Background(), graphql.Request{Query: tt.query})
+		if resp.Data != nil || len(resp.Errors) == 0 {
+			t.Errorf("%s: response = %+v", tt.query, resp)
+			continue
+		}
+		if e := resp.Errors[0]; e.Extensions["code"] != tt.code || !strings.Contains(e.Message, tt.message) {
+			t.Errorf("%s: error = %q %v, want %s containing %q", tt.query, e.Message, e.Extensions, tt.code, tt.message)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := testSchema(t)
+	s.MaxDepth = 3
+	s.MaxComplexity = 20
+	if got := run(t, s, `{ items(first: 2) { next { id } } }`, nil); !strings.Contains(got, `"next":{"id"`) {
+		t.Errorf("depth 3: %s", got)
+	}
+	if got := run(t, s, `{ items { next { next { id } } } }`, nil); !strings.Contains(got, "depth 4 exceeds the limit of 3") {
+		t.Errorf("depth 4: %s", got)
+	}
+	if got := run(t, s, `{ items(first: 5) { id title tags color } }`, nil); strings.Contains(got, "errors") {
+		t.Errorf("complexity 20: %s", got)
+	}
+	if got := run(t, s, `{ items(first: 6) { id title tags color } }`, nil); !strings.Contains(got, "complexity 24 exceeds the limit of 20") {
+		t.Errorf("complexity 24: %s", got)
+	}
+	if got := run(t, s, `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`, nil); strings.Contains(got, "errors") {
+		t.Errorf("introspection counted towards the depth limit: %s", got)
+	}
+	deep := `{ __schema { types { fields { type ` + strings.Repeat("{ ofType ", 12) + "{ name }" + strings.Repeat(" }", 12) + ` } } } }`
+	if got := run(t, s, deep, nil); !strings.Contains(got, "depth 16 exceeds the limit of 15") {
+		t.Errorf("deep introspection: %s", got)
+	}
+	if got := run(t, s, `{ `+strings.Repeat("__typename ", 21)+`}`, nil); !strings.Contains(got, "complexity 21 exceeds") {
+		t.Errorf("21 __typename: %s", got)
+	}
+
+	// Fragments spread twice per level would take 2^40 steps to walk
+	// naively; each is checked once.
+	bomb := "{ ...f40 } fragment f0 on Query { items(first: 1) { id } }"
+	for i := 1; i <= 40; i++ {
+		bomb += fmt.Sprintf(" fragment f%d on Query { ...f%d ...f%d }", i, i-1, i-1)
+	}
+	if got := run(t, s, bomb, nil); !strings.Contains(got, "complexity") {
+		t.Errorf("fragment bomb: %s", got)
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	s := testSchema(t)
+	got := run(t, s, `{
+		__type(name: "Item") { kind name fields { name type { kind ofType { name } } } }
+		__schema { queryType { name } subscriptionType { name } directives { name } }
+	}`, nil)
+	for _, want := range []string{
+		`"kind":"OBJECT","name":"Item"`,
+		`{"name":"id","type":{"kind":"NON_NULL","ofType":{"name":"ID"}}}`,
+		`"queryType":{"name":"Query"},"subscriptionType":{"name":"Subscription"}`,
+		`"directives":[{"name":"skip"},{"name":"include"}]`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("introspection lacks %s:\n%s", want, got)
+		}
+	}
+	if got := run(t, s, `{ __type(name: "Query") { fields { name args { name defaultValue } } } }`, nil); !strings.Contains(got, `{"name":"first","defaultValue":"10"}`) {
+		t.Errorf("default value: %s", got)
+	}
+
+	s.DisableIntrospection = true
+	if got := run(t, s, `{ __schema { types { name } } }`, nil); !strings.Contains(got, `cannot query field \"__schema\"`) {
+		t.Errorf("disabled introspection: %s", got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := testSchema(t)
+	p, resp := s.Prepare(graphql.Request{Query: `subscription { ticks(n: 3) }`})
+	if resp != nil {
+		t.Fatal(resp.Errors[0])
+	}
+	events, resp := p.Subscribe(context.Background())
+	if resp != nil {
+		t.Fatal(resp.Errors[0])
+	}
+	var got []string
+	for {
+		select {
+		case r, ok := <-events:
+			if !ok {
+				if want := `{"ticks":1},{"ticks":2},{"ticks":3}`; strings.Join(got, ",") != want {
+					t.Errorf("events = %v, want %s", got, want)
+				}
+				return
+			}
+			got = append(got, string(r.Data))
+		case <-time.After(5 * time.Second):
+			t.Fatal("subscription did not end")
+		}
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	s := testSchema(t)
+	if _, resp := s.Prepare(graphql.Request{Query: `subscription { a: ticks(n: 1) b: ticks(n: 2) }`}); resp == nil {
+		t.Error("two root fields accepted")
+	}
+	p, _ := s.Prepare(graphql.Request{Query: `subscription { ticks(n: -1) }`})
+	if _, resp := p.Subscribe(context.Background()); resp == nil || resp.Errors[0].Message != "n must not be negative" {
+		t.Errorf("Subscribe error = %+v", resp)
+	}
+}
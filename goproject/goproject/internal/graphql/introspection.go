@@ -0,0 +1,242 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// addIntrospection defines the __schema and __type fields of the query
+// type and the types they return.
+func (s *Schema) addIntrospection() error {
+	str := func(get func(src any) string) func(Params) (any, error) {
+		return func(p Params) (any, error) {
+			if v := get(p.Source); v != "" {
+				return v, nil
+			}
+			return nil, nil
+		}
+	}
+	constant := func(v any) func(Params) (any, error) {
+		return func(Params) (any, error) { return v, nil }
+	}
+
+	kinds := []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"}
+	typeKind := &Enum{Name: "__TypeKind", Description: "The kind of a type."}
+	for _, k := range kinds {
+		typeKind.Values = append(typeKind.Values, EnumValue{Name: k, Value: k})
+	}
+	locations := []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"}
+	directiveLocation := &Enum{Name: "__DirectiveLocation", Description: "Where a directive may appear."}
+	for _, l := range locations {
+		directiveLocation.Values = append(directiveLocation.Values, EnumValue{Name: l, Value: l})
+	}
+
+	typ := &Object{Name: "__Type", Description: "A type in the schema, or a list or non-null wrapper of one."}
+	field := &Object{Name: "__Field", Description: "A field of an object type."}
+	inputValue := &Object{Name: "__InputValue", Description: "An argument or input object field."}
+	enumValue := &Object{Name: "__EnumValue", Description: "A value of an enum type."}
+	directive := &Object{Name: "__Directive", Description: "A directive the server supports."}
+	schema := &Object{Name: "__Schema", Description: "The types and directives of the schema."}
+
+	includeDeprecated := []*Argument{{Name: "includeDeprecated", Type: Boolean, Default: false}}
+	inputValues := NonNullOf(ListOf(NonNullOf(inputValue)))
+	notDeprecated := []*Field{
+		{Name: "isDeprecated", Type: NonNullOf(Boolean), Resolve: constant(false)},
+		{Name: "deprecationReason", Type: String, Resolve: constant(nil)},
+	}
+
+	typ.Fields = []*Field{
+		{Name: "kind", Type: NonNullOf(typeKind), Resolve: func(p Params) (any, error) {
+			switch p.Source.(type) {
+			case *Scalar:
+				return "SCALAR", nil
+			case *Object:
+				return "OBJECT", nil
+			case *Enum:
+				return "ENUM", nil
+			case *InputObject:
+				return "INPUT_OBJECT", nil
+			case *List:
+				return "LIST", nil
+			}
+			return "NON_NULL", nil
+		}},
+		{Name: "name", Type: String, Resolve: str(func(src any) string { return typeName(src.(Type)) })},
+		{Name: "description", Type: String, Resolve: str(func(src any) string { return description(src.(Type)) })},
+		{Name: "specifiedByURL", Type: String, Resolve: constant(nil)},
+		{Name: "fields", Type: ListOf(NonNullOf(field)), Args: includeDeprecated, Resolve: func(p Params) (any, error) {
+			if o, ok := p.Source.(*Object); ok {
+				return o.Fields, nil
+			}
+			return nil, nil
+		}},
+		{Name: "interfaces", Type: ListOf(NonNullOf(typ)), Resolve: func(p Params) (any, error) {
+			if _, ok := p.Source.(*Object); ok {
+				return []Type{}, nil
+			}
+			return nil, nil
+		}},
+		{Name: "possibleTypes", Type: ListOf(NonNullOf(typ)), Resolve: constant(nil)},
+		{Name: "enumValues", Type: ListOf(NonNullOf(enumValue)), Args: includeDeprecated, Resolve: func(p Params) (any, error) {
+			if e, ok := p.Source.(*Enum); ok {
+				return e.Values, nil
+			}
+			return nil, nil
+		}},
+		{Name: "inputFields", Type: ListOf(NonNullOf(inputValue)), Resolve: func(p Params) (any, error) {
+			if o, ok := p.Source.(*InputObject); ok {
+				return o.Fields, nil
+			}
+			return nil, nil
+		}},
+		{Name: "ofType", Type: typ, Resolve: func(p Params) (any, error) {
+			switch t := p.Source.(type) {
+			case *List:
+				return t.Of, nil
+			case *NonNull:
+				return t.Of, nil
+			}
+			return nil, nil
+		}},
+	}
+	field.Fields = append([]*Field{
+		{Name: "name", Type: NonNullOf(String), Resolve: str(func(src any) string { return src.(*Field).Name })},
+		{Name: "description", Type: String, Resolve: str(func(src any) string { return src.(*Field).Description })},
+		{Name: "args", Type: inputValues, Resolve: func(p Params) (any, error) { return nonNilArgs(p.Source.(*Field).Args), nil }},
+		{Name: "type", Type: NonNullOf(typ), Resolve: func(p Params) (any, error) { return p.Source.(*Field).Type, nil }},
+	}, notDeprecated...)
+	inputValue.Fields = []*Field{
+		{Name: "name", Type: NonNullOf(String), Resolve: str(func(src any) string { return src.(*Argument).Name })},
+		{Name: "description", Type: String, Resolve: str(func(src any) string { return src.(*Argument).Description })},
+		{Name: "type", Type: NonNullOf(typ), Resolve: func(p Params) (any, error) { return p.Source.(*Argument).Type, nil }},
+		{Name: "defaultValue", Type: String, Resolve: func(p Params) (any, error) {
+			a := p.Source.(*Argument)
+			if a.Default == nil {
+				return nil, nil
+			}
+			return literalOf(a.Type, a.Default), nil
+		}},
+	}
+	enumValue.Fields = append([]*Field{
+		{Name: "name", Type: NonNullOf(String), Resolve: str(func(src any) string { return src.(EnumValue).Name })},
+		{Name: "description", Type: String, Resolve: str(func(src any) string { return src.(EnumValue).Description })},
+	}, notDeprecated...)
+	directive.Fields = []*Field{
+		{Name: "name", Type: NonNullOf(String)},
+		{Name: "description", Type: String},
+		{Name: "locations", Type: NonNullOf(ListOf(NonNullOf(directiveLocation))), Resolve: constant(locations)},
+		{Name: "args", Type: inputValues, Resolve: constant([]*Argument{{Name: "if", Type: NonNullOf(Boolean)}})},
+		{Name: "isRepeatable", Type: NonNullOf(Boolean), Resolve: constant(false)},
+	}
+	schema.Fields = []*Field{
+		{Name: "description", Type: String, Resolve: constant(nil)},
+		{Name: "types", Type: NonNullOf(ListOf(NonNullOf(typ))), Resolve: func(Params) (any, error) {
+			out := make([]Type, len(s.order))
+			for i, name := range s.order {
+				out[i] = s.types[name]
+			}
+			return out, nil
+		}},
+		{Name: "queryType", Type: NonNullOf(typ), Resolve: constant(s.Query)},
+		{Name: "mutationType", Type: typ, Resolve: func(Params) (any, error) { return nilIfNone(s.Mutation), nil }},
+		{Name: "subscriptionType", Type: typ, Resolve: func(Params) (any, error) { return nilIfNone(s.Subscription), nil }},
+		{Name: "directives", Type: NonNullOf(ListOf(NonNullOf(directive))), Resolve: constant([]map[string]any{
+			{"name": "skip", "description": "Leaves out the selection when if is true."},
+			{"name": "include", "description": "Includes the selection only when if is true."},
+		})},
+	}
+
+	s.intro = map[string]*Field{
+		"__schema": {Name: "__schema", Type: NonNullOf(schema), Resolve: constant(s)},
+		"__type": {Name: "__type", Type: typ, Args: []*Argument{{Name: "name", Type: NonNullOf(String)}}, Resolve: func(p Params) (any, error) {
+			if t, ok := s.types[p.Args["name"].(string)]; ok {
+				return t, nil
+			}
+			return nil, nil
+		}},
+	}
+	for _, t := range []Type{schema, directiveLocation} {
+		if err := s.add(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func description(t Type) string {
+	switch t := t.(type) {
+	case *Scalar:
+		return t.Description
+	case *Enum:
+		return t.Description
+	case *Object:
+		return t.Description
+	case *InputObject:
+		return t.Description
+	}
+	return ""
+}
+
+func nonNilArgs(args []*Argument) []*Argument {
+	if args == nil {
+		return []*Argument{}
+	}
+	return args
+}
+
+// nilIfNone keeps a nil *Object from becoming a non-nil interface.
+func nilIfNone(o *Object) any {
+	if o == nil {
+		return nil
+	}
+	return o
+}
+
+// literalOf formats a Go input value as GraphQL, for defaultValue.
+func literalOf(t Type, v any) string {
+	if nn, ok := t.(*NonNull); ok {
+		t = nn.Of
+	}
+	if v == nil {
+		return "null"
+	}
+	switch t := t.(type) {
+	case *Enum:
+		for _, ev := range t.Values {
+			if ev.Value == v {
+				return ev.Name
+			}
+		}
+	case *List:
+		if items, ok := v.([]any); ok {
+			parts := make([]string, len(items))
+			for i, item := range items {
+				parts[i] = literalOf(t.Of, item)
+			}
+			return "[" + strings.Join(parts, ", ") + "]"
+		}
+	case *InputObject:
+		if m, ok := v.(map[string]any); ok {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			parts := make([]string, len(keys))
+			for i, k := range keys {
+				var ft Type = String
+				if f := inputField(t, k); f != nil {
+					ft = f.Type
+				}
+				parts[i] = k + ": " + literalOf(ft, m[k])
+			}
+			return "{" + strings.Join(parts, ", ") + "}"
+		}
+	}
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,616 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ─── syntax tree ────────────────────────────────────────────────────────────
+
+// Location is a line and column in the query, both starting at 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind string // query, mutation or subscription
+	name string
+	vars []*varDef
+	sel  []*selection
+	loc  Location
+}
+
+type varDef struct {
+	name string
+	typ  *typeRef
+	def  *value
+	loc  Location
+}
+
+type typeRef struct {
+	name    string   // set for named types
+	elem    *typeRef // set for list types
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+type fragment struct {
+	name string
+	on   string
+	sel  []*selection
+	loc  Location
+}
+
+// selection is a field, a fragment spread (spread set) or an inline
+// fragment (inline set).
+type selection struct {
+	alias, name string
+	args        []*argument
+	dirs        []*directive
+	sel         []*selection
+
+	spread string
+	inline bool
+	on     string // type condition of an inline fragment, may be empty
+
+	loc Location
+}
+
+func (s *selection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type argument struct {
+	name string
+	val  *value
+	loc  Location
+}
+
+type directive struct {
+	name string
+	args []*argument
+	loc  Location
+}
+
+type valueKind int
+
+const (
+	varValue valueKind = iota
+	intValue
+	floatValue
+	stringValue
+	boolValue
+	nullValue
+	enumValue
+	listValue
+	objectValue
+)
+
+type value struct {
+	kind   valueKind
+	raw    string // name, digits or unescaped string
+	list   []*value
+	fields []*argument
+	loc    Location
+}
+
+// ─── lexer ──────────────────────────────────────────────────────────────────
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	loc  Location
+}
+
+type lexer struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+}
+
+// syntaxError is reported as the only error of a request that does not
+// parse.
+type syntaxError struct {
+	msg string
+	loc Location
+}
+
+func (e *syntaxError) Error() string { return "syntax error: " + e.msg }
+
+func (l *lexer) loc() Location {
+	return Location{Line: l.line, Column: utf8.RuneCountInString(l.src[l.lineStart:l.pos]) + 1}
+}
+
+func (l *lexer) fail(format string, args ...any) {
+	panic(&syntaxError{fmt.Sprintf(format, args...), l.loc()})
+}
+
+// skip passes over whitespace, commas and comments.
+func (l *lexer) skip() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case ' ', '\t', ',', '\r':
+			l.pos++
+		case '\n':
+			l.pos++
+			l.line++
+			l.lineStart = l.pos
+		case '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			if strings.HasPrefix(l.src[l.pos:], "\uFEFF") {
+				l.pos += 3
+				continue
+			}
+			return
+		}
+	}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func (l *lexer) next() token {
+	l.skip()
+	loc := l.loc()
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, loc: loc}
+	}
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{tokPunct, "...", loc}
+	case strings.IndexByte("!$()&:=@[]{}|", c) >= 0:
+		l.pos++
+		return token{tokPunct, string(c), loc}
+	case isNameStart(c):
+		for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{tokName, l.src[start:l.pos], loc}
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case c == '"':
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			return l.blockString(loc)
+		}
+		return l.string(loc)
+	}
+	l.fail("unexpected character %q", c)
+	return token{}
+}
+
+func (l *lexer) digits() {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.fail("expected digit")
+	}
+}
+
+func (l *lexer) number(loc Location) token {
+	start := l.pos
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	intStart := l.pos
+	l.digits()
+	if l.src[intStart] == '0' && l.pos-intStart > 1 {
+		l.fail("leading zero in number")
+	}
+	kind := tokInt
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		l.digits()
+		kind = tokFloat
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		l.digits()
+		kind = tokFloat
+	}
+	if l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || l.src[l.pos] == '.') {
+		l.fail("invalid number")
+	}
+	return token{kind, l.src[start:l.pos], loc}
+}
+
+func (l *lexer) string(loc Location) token {
+	l.pos++ // opening quote
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			l.fail("unterminated string")
+		}
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{tokString, b.String(), loc}
+		case c == '\\':
+			if l.pos+1 >= len(l.src) {
+				l.fail("unterminated string")
+			}
+			esc := l.src[l.pos+1]
+			l.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					l.fail("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					l.fail("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				l.fail("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+// blockString reads a """ string and removes its common indentation.
+func (l *lexer) blockString(loc Location) token {
+	l.pos += 3
+	end := strings.Index(l.src[l.pos:], `"""`)
+	for end > 0 && l.src[l.pos+end-1] == '\\' {
+		next := strings.Index(l.src[l.pos+end+3:], `"""`)
+		if next < 0 {
+			end = -1
+			break
+		}
+		end += 3 + next
+	}
+	if end < 0 {
+		l.fail("unterminated block string")
+	}
+	raw := l.src[l.pos : l.pos+end]
+	for _, c := range raw {
+		if c == '\n' {
+			l.line++
+		}
+	}
+	if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+		l.lineStart = l.pos + i + 1
+	}
+	l.pos += end + 3
+
+	lines := strings.Split(strings.ReplaceAll(strings.ReplaceAll(raw, `\"""`, `"""`), "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return token{tokString, strings.Join(lines, "\n"), loc}
+}
+
+// ─── parser ─────────────────────────────────────────────────────────────────
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// parse parses an executable document. Type system definitions are not
+// accepted.
+func parse(src string) (doc *document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*syntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = se
+		}
+	}()
+	p := &parser{lex: &lexer{src: src, line: 1}}
+	p.advance()
+	doc = &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek("{"):
+			op := &operation{kind: "query", loc: p.tok.loc}
+			op.sel = p.selectionSet()
+			doc.operations = append(doc.operations, op)
+		case p.tok.kind == tokName && (p.tok.text == "query" || p.tok.text == "mutation" || p.tok.text == "subscription"):
+			doc.operations = append(doc.operations, p.operation())
+		case p.tok.kind == tokName && p.tok.text == "fragment":
+			f := p.fragment()
+			if doc.fragments[f.name] != nil {
+				p.failAt(f.loc, "fragment %q is defined more than once", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.failAt(Location{1, 1}, "document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() { p.tok = p.lex.next() }
+
+func (p *parser) failAt(loc Location, format string, args ...any) {
+	panic(&syntaxError{fmt.Sprintf(format, args...), loc})
+}
+
+func (p *parser) unexpected() {
+	if p.tok.kind == tokEOF {
+		p.failAt(p.tok.loc, "unexpected end of document")
+	}
+	p.failAt(p.tok.loc, "unexpected %q", p.tok.text)
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == punct
+}
+
+func (p *parser) skip(punct string) bool {
+	if p.peek(punct) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.skip(punct) {
+		p.unexpected()
+	}
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokName {
+		p.unexpected()
+	}
+	s := p.tok.text
+	p.advance()
+	return s
+}
+
+func (p *parser) operation() *operation {
+	op := &operation{kind: p.tok.text, loc: p.tok.loc}
+	p.advance()
+	if p.tok.kind == tokName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			v := &varDef{loc: p.tok.loc}
+			p.expect("$")
+			v.name = p.name()
+			p.expect(":")
+			v.typ = p.typeRef()
+			if p.skip("=") {
+				v.def = p.value(true)
+			}
+			op.vars = append(op.vars, v)
+		}
+	}
+	p.directives()
+	op.sel = p.selectionSet()
+	return op
+}
+
+func (p *parser) fragment() *fragment {
+	f := &fragment{loc: p.tok.loc}
+	p.advance()
+	if f.name = p.name(); f.name == "on" {
+		p.failAt(f.loc, "fragment cannot be named on")
+	}
+	if p.name() != "on" {
+		p.failAt(f.loc, "expected type condition")
+	}
+	f.on = p.name()
+	p.directives()
+	f.sel = p.selectionSet()
+	return f
+}
+
+func (p *parser) typeRef() *typeRef {
+	var t *typeRef
+	if p.skip("[") {
+		t = &typeRef{elem: p.typeRef()}
+		p.expect("]")
+	} else {
+		t = &typeRef{name: p.name()}
+	}
+	t.nonNull = p.skip("!")
+	return t
+}
+
+func (p *parser) selectionSet() []*selection {
+	p.expect("{")
+	var sel []*selection
+	for !p.skip("}") {
+		sel = append(sel, p.selection())
+	}
+	if len(sel) == 0 {
+		p.failAt(p.tok.loc, "empty selection set")
+	}
+	return sel
+}
+
+func (p *parser) selection() *selection {
+	s := &selection{loc: p.tok.loc}
+	if p.skip("...") {
+		if p.tok.kind == tokName && p.tok.text != "on" {
+			s.spread = p.name()
+			s.dirs = p.directives()
+			return s
+		}
+		s.inline = true
+		if p.tok.kind == tokName {
+			p.advance()
+			s.on = p.name()
+		}
+		s.dirs = p.directives()
+		s.sel = p.selectionSet()
+		return s
+	}
+	s.name = p.name()
+	if p.skip(":") {
+		s.alias, s.name = s.name, p.name()
+	}
+	s.args = p.arguments(false)
+	s.dirs = p.directives()
+	if p.peek("{") {
+		s.sel = p.selectionSet()
+	}
+	return s
+}
+
+func (p *parser) arguments(constant bool) []*argument {
+	var args []*argument
+	if p.skip("(") {
+		for !p.skip(")") {
+			a := &argument{loc: p.tok.loc, name: p.name()}
+			p.expect(":")
+			a.val = p.value(constant)
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+func (p *parser) directives() []*directive {
+	var dirs []*directive
+	for p.peek("@") {
+		d := &directive{loc: p.tok.loc}
+		p.advance()
+		d.name = p.name()
+		d.args = p.arguments(false)
+		dirs = append(dirs, d)
+	}
+	return dirs
+}
+
+func (p *parser) value(constant bool) *value {
+	v := &value{loc: p.tok.loc, raw: p.tok.text}
+	switch p.tok.kind {
+	case tokInt:
+		v.kind = intValue
+	case tokFloat:
+		v.kind = floatValue
+	case tokString:
+		v.kind = stringValue
+	case tokName:
+		switch p.tok.text {
+		case "true", "false":
+			v.kind = boolValue
+		case "null":
+			v.kind = nullValue
+		default:
+			v.kind = enumValue
+		}
+	case tokPunct:
+		switch p.tok.text {
+		case "$":
+			if constant {
+				p.unexpected()
+			}
+			p.advance()
+			v.kind, v.raw = varValue, p.name()
+			return v
+		case "[":
+			p.advance()
+			v.kind = listValue
+			for !p.skip("]") {
+				v.list = append(v.list, p.value(constant))
+			}
+			return v
+		case "{":
+			p.advance()
+			v.kind = objectValue
+			for !p.skip("}") {
+				f := &argument{loc: p.tok.loc, name: p.name()}
+				p.expect(":")
+				f.val = p.value(constant)
+				v.fields = append(v.fields, f)
+			}
+			return v
+		}
+		p.unexpected()
+	default:
+		p.unexpected()
+	}
+	p.advance()
+	return v
+}
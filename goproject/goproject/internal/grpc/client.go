@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientStream reads the responses of a call made with NewStream.
+type ClientStream struct {
+	resp *http.Response
+	err  error
+}
+
+// NewStream starts a call to method on the server at base, an https URL,
+// and sends req. client must speak HTTP/2. Metadata keys are sent as
+// headers.
+func NewStream(ctx context.Context, client *http.Client, base, method string, md Metadata, req []byte) (*ClientStream, error) {
+	frame := make([]byte, 5, 5+len(req))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(req)))
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(base, "/")+method, bytes.NewReader(append(frame, req...)))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range md {
+		hr.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	hr.Header.Set("Content-Type", "application/grpc")
+	hr.Header.Set("Te", "trailers")
+	if d, ok := ctx.Deadline(); ok {
+		hr.Header.Set("Grpc-Timeout", strconv.FormatInt(max(time.Until(d).Milliseconds(), 1), 10)+"m")
+	}
+	resp, err := client.Do(hr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, Errorf(Unavailable, "HTTP status %d", resp.StatusCode)
+	}
+	return &ClientStream{resp: resp}, nil
+}
+
+// Recv returns the next response message. After the last one it returns
+// io.EOF if the call succeeded and its *Status otherwise.
+func (c *ClientStream) Recv() ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	var prefix [5]byte
+	if _, err := io.ReadFull(c.resp.Body, prefix[:]); err != nil {
+		if err == io.EOF {
+			io.Copy(io.Discard, c.resp.Body)
+			c.err = c.status()
+		} else {
+			c.err = StatusOf(err)
+		}
+		c.resp.Body.Close()
+		return nil, c.err
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(c.resp.Body, msg); err != nil {
+		c.err = Errorf(Internal, "truncated response message")
+		c.resp.Body.Close()
+		return nil, c.err
+	}
+	return msg, nil
+}
+
+// Close abandons the call.
+func (c *ClientStream) Close() error { return c.resp.Body.Close() }
+
+func (c *ClientStream) status() error {
+	code, err := strconv.Atoi(c.resp.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		return Errorf(Internal, "response has no grpc-status")
+	}
+	if code == int(OK) {
+		return io.EOF
+	}
+	return &Status{Code: Code(code), Message: DecodeMessage(c.resp.Trailer.Get("Grpc-Message"))}
+}
+
+// Invoke makes a unary call and returns its response message.
+func Invoke(ctx context.Context, client *http.Client, base, method string, md Metadata, req []byte) ([]byte, error) {
+	s, err := NewStream(ctx, client, base, method, md, req)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	resp, err := s.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Recv(); err != io.EOF {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,357 @@
+// Package grpc serves gRPC over net/http: unary and server-streaming
+// methods, status codes in trailers, metadata, deadlines from
+// grpc-timeout and interceptors. Messages are opaque bytes; callers encode
+// them, for example with protowire.
+//
+// net/http speaks HTTP/2 only over TLS, so the server must be run with a
+// TLS listener. Compression and client or bidirectional streaming are not
+// supported.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Code is a gRPC status code.
+type Code int
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+// MaxMessageSize bounds request messages.
+const MaxMessageSize = 4 << 20
+
+// Status is an error with a gRPC code. Handlers return one to choose the
+// code; any other error is sent as Unknown.
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string { return fmt.Sprintf("grpc: code %d: %s", s.Code, s.Message) }
+
+// Errorf returns a *Status.
+func Errorf(code Code, format string, args ...any) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// StatusOf returns err's status, treating context errors as Canceled and
+// DeadlineExceeded.
+func StatusOf(err error) *Status {
+	var s *Status
+	switch {
+	case err == nil:
+		return &Status{Code: OK}
+	case errors.As(err, &s):
+		return s
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Status{Code: DeadlineExceeded, Message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		return &Status{Code: Canceled, Message: err.Error()}
+	}
+	return &Status{Code: Unknown, Message: err.Error()}
+}
+
+// ─── metadata ───────────────────────────────────────────────────────────────
+
+// Metadata is the request headers a call was made with, keyed in lower
+// case. Pseudo-headers and the gRPC protocol headers are left out.
+type Metadata map[string][]string
+
+// Get returns the first value of key.
+func (md Metadata) Get(key string) string {
+	if v := md[strings.ToLower(key)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+type metadataKey struct{}
+
+type peerKey struct{}
+
+// PeerFromContext returns the remote address of the client of a call.
+func PeerFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(peerKey{}).(string)
+	return addr
+}
+
+// MetadataFromContext returns the incoming metadata of a call.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+func metadataOf(h http.Header) Metadata {
+	md := make(Metadata, len(h))
+	for k, v := range h {
+		k = strings.ToLower(k)
+		switch {
+		case k == "content-type", k == "te", k == "user-agent", strings.HasPrefix(k, "grpc-"):
+			continue
+		}
+		md[k] = v
+	}
+	return md
+}
+
+// ─── handlers ───────────────────────────────────────────────────────────────
+
+// Info describes the method being called.
+type Info struct {
+	FullMethod string // "/package.Service/Method"
+	Streaming  bool
+}
+
+// UnaryHandler handles one request message and returns one response.
+type UnaryHandler func(ctx context.Context, req []byte) ([]byte, error)
+
+// StreamHandler handles one request message and sends any number of
+// responses on s.
+type StreamHandler func(req []byte, s Stream) error
+
+// Stream is the sending side of a server-streaming call.
+type Stream interface {
+	Context() context.Context
+	Send(msg []byte) error
+}
+
+// UnaryInterceptor wraps every unary call. It may return early or call
+// next, possibly with a derived context.
+type UnaryInterceptor func(ctx context.Context, req []byte, info *Info, next UnaryHandler) ([]byte, error)
+
+// StreamInterceptor wraps every streaming call. WithContext derives a
+// stream that reports a different context.
+type StreamInterceptor func(req []byte, s Stream, info *Info, next StreamHandler) error
+
+// WithContext returns s with its context replaced by ctx.
+func WithContext(s Stream, ctx context.Context) Stream {
+	return &ctxStream{Stream: s, ctx: ctx}
+}
+
+type ctxStream struct {
+	Stream
+	ctx context.Context
+}
+
+func (s *ctxStream) Context() context.Context { return s.ctx }
+
+// Server routes gRPC calls to registered methods. Register methods and
+// set the interceptors before serving.
+type Server struct {
+	Unary  UnaryInterceptor
+	Stream StreamInterceptor
+
+	unary   map[string]UnaryHandler
+	streams map[string]StreamHandler
+}
+
+func NewServer() *Server {
+	return &Server{unary: make(map[string]UnaryHandler), streams: make(map[string]StreamHandler)}
+}
+
+// HandleUnary registers a unary method such as "/notes.v1.NotesService/GetNote".
+func (s *Server) HandleUnary(fullMethod string, h UnaryHandler) { s.unary[fullMethod] = h }
+
+// HandleStream registers a server-streaming method.
+func (s *Server) HandleStream(fullMethod string, h StreamHandler) { s.streams[fullMethod] = h }
+
+// Methods returns the registered method names.
+func (s *Server) Methods() []string {
+	var out []string
+	for m := range s.unary {
+		out = append(out, m)
+	}
+	for m := range s.streams {
+		out = append(out, m)
+	}
+	return out
+}
+
+// ServeHTTP implements the gRPC over HTTP/2 protocol.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires POST over HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	// Send the headers now, so a client of a quiet stream knows the call
+	// has started.
+	http.NewResponseController(w).Flush()
+	st := s.serve(w, r)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(st.Code)))
+	if st.Message != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(st.Message))
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) *Status {
+	if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+		return &Status{Code: Unimplemented, Message: "compression is not supported"}
+	}
+	ctx := context.WithValue(r.Context(), metadataKey{}, metadataOf(r.Header))
+	ctx = context.WithValue(ctx, peerKey{}, r.RemoteAddr)
+	if t := r.Header.Get("Grpc-Timeout"); t != "" {
+		d, ok := parseTimeout(t)
+		if !ok {
+			return &Status{Code: InvalidArgument, Message: "malformed grpc-timeout"}
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	method := r.URL.Path
+	unary, isUnary := s.unary[method]
+	stream, isStream := s.streams[method]
+	if !isUnary && !isStream {
+		return &Status{Code: Unimplemented, Message: "unknown method " + method}
+	}
+	req, err := readMessage(r.Body)
+	if err != nil {
+		return StatusOf(err)
+	}
+
+	info := &Info{FullMethod: method, Streaming: isStream}
+	if isUnary {
+		var resp []byte
+		if s.Unary != nil {
+			resp, err = s.Unary(ctx, req, info, unary)
+		} else {
+			resp, err = unary(ctx, req)
+		}
+		if err == nil {
+			err = writeMessage(w, resp)
+		}
+		return StatusOf(err)
+	}
+	ss := &serverStream{w: w, ctx: ctx}
+	if s.Stream != nil {
+		err = s.Stream(req, ss, info, stream)
+	} else {
+		err = stream(req, ss)
+	}
+	return StatusOf(err)
+}
+
+// readMessage reads the single request message of a unary or
+// server-streaming call.
+func readMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, Errorf(InvalidArgument, "missing request message")
+	}
+	if prefix[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > MaxMessageSize {
+		return nil, Errorf(ResourceExhausted, "request message exceeds %d bytes", MaxMessageSize)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, Errorf(InvalidArgument, "truncated request message")
+	}
+	return msg, nil
+}
+
+func writeMessage(w http.ResponseWriter, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	if _, err := w.Write(append(frame, msg...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+type serverStream struct {
+	w   http.ResponseWriter
+	ctx context.Context
+	mu  sync.Mutex
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+func (s *serverStream) Send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return writeMessage(s.w, msg)
+}
+
+// parseTimeout reads a grpc-timeout value such as "100m".
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	unit := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}[s[len(s)-1]]
+	if unit == 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// encodeMessage percent-encodes grpc-message as the protocol requires.
+func encodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 0x20 && c <= 0x7E && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// DecodeMessage undoes the percent-encoding of a grpc-message trailer.
+func DecodeMessage(s string) string {
+	if d, err := url.PathUnescape(s); err == nil {
+		return d
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package grpc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"goproject/internal/grpc"
+)
+
+func newServer(t *testing.T, s *grpc.Server) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(s)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUnary(t *testing.T) {
+	s := grpc.NewServer()
+	s.HandleUnary("/test.Echo/Echo", func(ctx context.Context, req []byte) ([]byte, error) {
+		if string(req) == "fail" {
+			return nil, grpc.Errorf(grpc.InvalidArgument, "bad input: %s", "100% wrong")
+		}
+		return append([]byte(grpc.MetadataFromContext(ctx).Get("x-name")+":"), req...), nil
+	})
+	srv := newServer(t, s)
+	ctx := context.Background()
+
+	resp, err := grpc.Invoke(ctx, srv.Client(), srv.URL, "/test.Echo/Echo", grpc.Metadata{"x-name": {"ann"}}, []byte("hi"))
+	if err != nil || string(resp) != "ann:hi" {
+		t.Fatalf("Invoke = %q, %v", resp, err)
+	}
+
+	_, err = grpc.Invoke(ctx, srv.Client(), srv.URL, "/test.Echo/Echo", nil, []byte("fail"))
+	if st := grpc.StatusOf(err); st.Code != grpc.InvalidArgument || st.Message != "bad input: 100% wrong" {
+		t.Errorf("status = %+v", st)
+	}
+
+	_, err = grpc.Invoke(ctx, srv.Client(), srv.URL, "/test.Echo/Missing", nil, nil)
+	if st := grpc.StatusOf(err); st.Code != grpc.Unimplemented {
+		t.Errorf("unknown method: status = %+v", st)
+	}
+}
+
+func TestRequiresHTTP2(t *testing.T) {
+	srv := httptest.NewServer(grpc.NewServer())
+	defer srv.Close()
+	resp, err := http.Post(srv.URL+"/test.Echo/Echo", "application/grpc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+}
+
+func TestStreamAndInterceptors(t *testing.T) {
+	s := grpc.NewServer()
+	type key struct{}
+	s.Stream = func(req []byte, st grpc.Stream, info *grpc.Info, next grpc.StreamHandler) error {
+		if grpc.MetadataFromContext(st.Context()).Get("authorization") != "secret" {
+			return grpc.Errorf(grpc.Unauthenticated, "no")
+		}
+		return next(req, grpc.WithContext(st, context.WithValue(st.Context(), key{}, info.FullMethod)))
+	}
+	s.HandleStream("/test.Count/Count", func(req []byte, st grpc.Stream) error {
+		method := st.Context().Value(key{}).(string)
+		for i := 0; i < 3; i++ {
+			if err := st.Send([]byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return grpc.Errorf(grpc.Aborted, "%s done", method)
+	})
+	srv := newServer(t, s)
+
+	_, err := grpc.Invoke(context.Background(), srv.Client(), srv.URL, "/test.Count/Count", nil, nil)
+	if st := grpc.StatusOf(err); st.Code != grpc.Unauthenticated {
+		t.Fatalf("without metadata: status = %+v", st)
+	}
+
+	cs, err := grpc.NewStream(context.Background(), srv.Client(), srv.URL, "/test.Count/Count", grpc.Metadata{"authorization": {"secret"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		msg, err := cs.Recv()
+		if err != nil || len(msg) != 1 || msg[0] != byte(i) {
+			t.Fatalf("message %d = %v, %v", i, msg, err)
+		}
+	}
+	_, err = cs.Recv()
+	if st := grpc.StatusOf(err); st.Code != grpc.Aborted || st.Message != "/test.Count/Count done" {
+		t.Errorf("final status = %+v", st)
+	}
+	if _, err := cs.Recv(); err == io.EOF || err == nil {
+		t.Errorf("Recv after end = %v", err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	s := grpc.NewServer()
+	s.HandleUnary("/test.Slow/Wait", func(ctx context.Context, req []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	srv := newServer(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := grpc.Invoke(ctx, srv.Client(), srv.URL, "/test.Slow/Wait", nil, nil)
+	if st := grpc.StatusOf(err); st.Code != grpc.DeadlineExceeded {
+		t.Errorf("status = %+v", st)
+	}
+}
@@ -0,0 +1,165 @@
+// Package health runs named health checks with timeouts and reports their
+// status and latency.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check reports whether a subsystem is healthy. It should honour ctx, but a
+// check that does not is still cut off at its timeout. Its goroutine is left
+// running until it returns, and meanwhile later runs of the check wait for
+// that call instead of starting another, so a stuck check leaves behind at
+// most one goroutine.
+type Check func(ctx context.Context) error
+
+// Registry holds the checks subsystems have registered.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]entry
+}
+
+type entry struct {
+	timeout time.Duration
+	check   Check
+	flight  *flight
+}
+
+// flight is the call of a check in progress, shared by every Run that
+// needs its result.
+type flight struct {
+	mu   sync.Mutex
+	call *call
+}
+
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]entry)}
+}
+
+// Register adds or replaces the check called name.
+func (r *Registry) Register(name string, timeout time.Duration, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = entry{timeout: timeout, check: check, flight: &flight{}}
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Report is the outcome of all checks. Status is ok only if every check
+// passed.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Run executes every check concurrently and waits for all of them.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	checks := make(map[string]entry, len(r.checks))
+	for k, v := range r.checks {
+		checks[k] = v
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string, e entry) {
+			defer wg.Done()
+			results[i] = run(ctx, name, e)
+		}(i, name, checks[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, res := range results {
+		if res.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, name string, e entry) Result {
+	start := time.Now()
+	c := e.flight.start(ctx, e)
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	var err error
+	select {
+	case <-c.done:
+		err = c.err
+	case <-ctx.Done():
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", e.timeout)
+		}
+	}
+
+	res := Result{
+		Name:      name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// start returns the check's call in progress, or starts one. The call gets
+// its own timeout and outlives the caller's cancellation, since other runs
+// may be waiting for it.
+func (f *flight) start(ctx context.Context, e entry) *call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.call != nil {
+		return f.call
+	}
+	c := &call{done: make(chan struct{})}
+	f.call = c
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.timeout)
+		defer func() {
+			if v := recover(); v != nil {
+				c.err = fmt.Errorf("check panicked: %v", v)
+			}
+			cancel()
+			f.mu.Lock()
+			f.call = nil
+			f.mu.Unlock()
+			close(c.done)
+		}()
+		c.err = e.check(ctx)
+	}()
+	return c
+}
@@ -0,0 +1,75 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"goproject/internal/health"
+)
+
+func TestRun(t *testing.T) {
+	r := health.NewRegistry()
+	r.Register("ok", time.Second, func(context.Context) error { return nil })
+	r.Register("broken", time.Second, func(context.Context) error { return errors.New("disk on fire") })
+	r.Register("stuck", 20*time.Millisecond, func(context.Context) error {
+		time.Sleep(time.Second) // ignores ctx on purpose
+		return nil
+	})
+
+	start := time.Now()
+	report := r.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("stuck check was not cut off, took %v", elapsed)
+	}
+	if report.Status != health.StatusFail {
+		t.Errorf("expected overall fail, got %s", report.Status)
+	}
+
+	got := map[string]health.Result{}
+	for _, res := range report.Checks {
+		got[res.Name] = res
+	}
+	if got["ok"].Status != health.StatusOK {
+		t.Errorf("ok check: %+v", got["ok"])
+	}
+	if got["broken"].Error != "disk on fire" {
+		t.Errorf("broken check: %+v", got["broken"])
+	}
+	if got["stuck"].Status != health.StatusFail {
+		t.Errorf("stuck check should time out: %+v", got["stuck"])
+	}
+}
+
+func TestStuckCheckRunsOnce(t *testing.T) {
+	r := health.NewRegistry()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	r.Register("stuck", 10*time.Millisecond, func(context.Context) error {
+		if calls.Add(1) == 1 {
+			<-release // ignores ctx on purpose
+		}
+		return nil
+	})
+
+	for range 3 {
+		if report := r.Run(context.Background()); report.Status != health.StatusFail {
+			t.Fatalf("stuck check = %+v", report.Checks)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check started %d times while the first call was stuck", n)
+	}
+
+	close(release)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if report := r.Run(context.Background()); report.Status == health.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("check never recovered once the stuck call returned")
+		}
+	}
+}
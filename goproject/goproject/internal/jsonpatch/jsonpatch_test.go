@@ -0,0 +1,79 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"goproject/internal/jsonpatch"
+)
+
+func equalJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("bad result %s: %v", got, err)
+	}
+	json.Unmarshal([]byte(want), &w)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Example from RFC 7396 section 3.
+	doc := `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`
+	patch := `{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`
+	got, err := jsonpatch.MergePatch([]byte(doc), []byte(patch))
+	if err != nil {
+		t.Fatalf("merge patch: %v", err)
+	}
+	equalJSON(t, got, `{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged","phoneNumber":"+01-123-456-7890"}`)
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"x"}]`, `{"foo":["bar","x"]}`},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"replace with null", `{"a":1}`, `[{"op":"replace","path":"/a","value":null}]`, `{"a":null}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"copy", `{"a":[1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":[1],"b":[1]}`},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/m~0n"}]`, `{}`},
+		{"test passes", `{"a":"b"}`, `[{"op":"test","path":"/a","value":"b"}]`, `{"a":"b"}`},
+	}
+	for _, c := range cases {
+		got, err := jsonpatch.Apply([]byte(c.doc), []byte(c.patch))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		equalJSON(t, got, c.want)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	cases := []struct {
+		name, doc, patch string
+		want             error
+	}{
+		{"test fails", `{"a":"b"}`, `[{"op":"test","path":"/a","value":"c"}]`, jsonpatch.ErrTestFailed},
+		{"missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, jsonpatch.ErrPathNotFound},
+		{"missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, jsonpatch.ErrPathNotFound},
+		{"index out of range", `{"a":[]}`, `[{"op":"add","path":"/a/1","value":1}]`, jsonpatch.ErrPathNotFound},
+		{"unknown op", `{}`, `[{"op":"frob","path":"/a"}]`, jsonpatch.ErrInvalidPatch},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, jsonpatch.ErrInvalidPatch},
+		{"not an array", `{}`, `{"op":"add"}`, jsonpatch.ErrInvalidPatch},
+	}
+	for _, c := range cases {
+		_, err := jsonpatch.Apply([]byte(c.doc), []byte(c.patch))
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package metrics_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"goproject/internal/metrics"
+)
+
+func TestExposition(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.NewCounter("requests_total", "Requests.", "route", "code")
+	c.Inc("/notes", "200")
+	c.Inc("/notes", "200")
+	c.Add(3, `/a"b`, "500")
+
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/notes")
+	h.Observe(0.5, "/notes")
+	h.Observe(5, "/notes")
+
+	r.NewGaugeFunc("users", "Users.", nil, func(emit func(float64, ...string)) { emit(7) })
+
+	var b strings.Builder
+	r.WriteTo(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE requests_total counter\n",
+		`requests_total{route="/notes",code="200"} 2` + "\n",
+		`requests_total{route="/a\"b",code="500"} 3` + "\n",
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{route="/notes",le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{route="/notes",le="1"} 2` + "\n",
+		`latency_seconds_bucket{route="/notes",le="+Inf"} 3` + "\n",
+		`latency_seconds_sum{route="/notes"} 5.55` + "\n",
+		`latency_seconds_count{route="/notes"} 3` + "\n",
+		"users 7\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.RegisterRuntime(r)
+	var b strings.Builder
+	r.WriteTo(&b)
+	for _, name := range []string{"go_goroutines ", "go_memstats_alloc_bytes ", "go_gc_cycles_total "} {
+		if !strings.Contains(b.String(), name) {
+			t.Errorf("missing %s", name)
+		}
+	}
+	for _, name := range []string{"go_memstats_mallocs_total", "go_gc_cycles_total", "go_gc_pause_seconds_total"} {
+		if !strings.Contains(b.String(), "# TYPE "+name+" counter\n") {
+			t.Errorf("%s is not a counter", name)
+		}
+	}
+}
+
+func TestRuntimeMetricsConcurrentScrapes(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.RegisterRuntime(r)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				var b strings.Builder
+				r.WriteTo(&b)
+				if !strings.Contains(b.String(), "go_memstats_next_gc_bytes ") {
+					t.Error("missing go_memstats_next_gc_bytes")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// RegisterRuntime adds Go runtime and process metrics to r. Memory
+// statistics are read once per scrape.
+func RegisterRuntime(r *Registry) {
+	start := float64(time.Now().Unix())
+
+	r.NewGaugeFunc("go_info", "Information about the Go environment.", []string{"version"}, func(emit func(float64, ...string)) {
+		emit(1, runtime.Version())
+	})
+	r.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", nil, func(emit func(float64, ...string)) {
+		emit(float64(runtime.NumGoroutine()))
+	})
+	r.NewGaugeFunc("go_gomaxprocs", "Value of GOMAXPROCS.", nil, func(emit func(float64, ...string)) {
+		emit(float64(runtime.GOMAXPROCS(0)))
+	})
+	r.NewGaugeFunc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", nil, func(emit func(float64, ...string)) {
+		emit(start)
+	})
+
+	r.register(memStats{})
+}
+
+// memStats writes every go_memstats_* and go_gc_* series from a single
+// runtime.ReadMemStats, so a scrape sees one consistent snapshot and
+// concurrent scrapes share nothing.
+type memStats struct{}
+
+var memStatsDescs = []struct {
+	desc
+	read func(*runtime.MemStats) float64
+}{
+	{desc{name: "go_memstats_alloc_bytes", help: "Bytes of allocated heap objects.", kind: "gauge"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.Alloc) }},
+	{desc{name: "go_memstats_sys_bytes", help: "Bytes of memory obtained from the OS.", kind: "gauge"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.Sys) }},
+	{desc{name: "go_memstats_heap_inuse_bytes", help: "Bytes in in-use heap spans.", kind: "gauge"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.HeapInuse) }},
+	{desc{name: "go_memstats_heap_objects", help: "Number of allocated heap objects.", kind: "gauge"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.HeapObjects) }},
+	{desc{name: "go_memstats_mallocs_total", help: "Cumulative count of heap objects allocated.", kind: "counter"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.Mallocs) }},
+	{desc{name: "go_gc_cycles_total", help: "Number of completed GC cycles.", kind: "counter"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.NumGC) }},
+	{desc{name: "go_gc_pause_seconds_total", help: "Cumulative time spent in GC stop-the-world pauses.", kind: "counter"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.PauseTotalNs) / 1e9 }},
+	{desc{name: "go_memstats_next_gc_bytes", help: "Heap size target of the next GC cycle.", kind: "gauge"},
+		func(ms *runtime.MemStats) float64 { return float64(ms.NextGC) }},
+}
+
+func (memStats) write(w *bufio.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	for _, d := range memStatsDescs {
+		d.header(w)
+		fmt.Fprintf(w, "%s %s\n", d.name, formatFloat(d.read(&ms)))
+	}
+}
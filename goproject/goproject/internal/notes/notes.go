@@ -3,13 +3,15 @@ package notes
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
 
 var (
-	ErrNotFound   = errors.New("note not found")
-	ErrForbidden  = errors.New("access denied")
+	ErrNotFound    = errors.New("note not found")
+	ErrForbidden   = errors.New("access denied")
+	ErrInvalidMove = errors.New("invalid move")
 )
 
 type Priority string
@@ -28,18 +30,99 @@ type Note struct {
 	Done      bool      `json:"done"`
 	Priority  Priority  `json:"priority"`
 	Tags      []string  `json:"tags"`
+	Pinned    bool      `json:"pinned"`
+	Position  string    `json:"position"` // fractional ordering key, per user
+	Version   int       `json:"version"`  // starts at 1, incremented by every write
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	seq   uint64                // store sequence number of the last write
+	clock map[string]fieldStamp // last write per editable field, for sync
+	last  ReplaceInput          // editable fields as of the last write
 }
 
 type Store struct {
-	mu      sync.RWMutex
-	notes   map[string]*Note
-	counter int
+	mu       sync.RWMutex
+	notes    map[string]*Note
+	counter  int
+	onChange []func(Change)
+
+	seq        uint64               // incremented by every write
+	tombstones map[string]Tombstone // deleted notes, by ID
+	clientIDs  map[string]clientID  // user + "/" + sync client ID → note
+	positions  map[string]string    // user → largest position key given out
+
+	retention time.Duration // how long tombstones and client IDs are kept
+	horizon   uint64        // newest sequence number of a forgotten tombstone
+	pruned    time.Time     // when prune last ran
+}
+
+// Change types.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change describes one write. Note is a copy taken at the time of the
+// write; for a deletion it is the note as it was, with its version bumped.
+// Fields lists the editable fields the write changed, such as "title" or
+// "done": all of them for a creation, none for a deletion.
+type Change struct {
+	Type   string
+	Note   Note
+	Fields []string
+}
+
+// OnChange registers fn to be called after every write. Calls are made with
+// the store locked, so they arrive in write order; fn must not block or
+// call back into the store.
+func (s *Store) OnChange(fn func(Change)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// changed bumps the version and sequence number of a note that was just
+// written, records which fields the write touched and notifies listeners.
+// Callers must hold s.mu.
+func (s *Store) changed(typ string, note *Note) {
+	note.Version++
+	if typ == ChangeUpdated {
+		note.UpdatedAt = time.Now()
+	}
+	s.seq++
+	note.seq = s.seq
+
+	current := note.editable()
+	if note.clock == nil {
+		note.clock = make(map[string]fieldStamp)
+	}
+	fields := changedFields(note.last, current, typ == ChangeCreated)
+	for _, f := range fields {
+		note.clock[f] = fieldStamp{version: note.Version, at: note.UpdatedAt}
+	}
+	note.last = current
+	if typ == ChangeDeleted {
+		s.tombstones[note.ID] = Tombstone{ID: note.ID, UserID: note.UserID, Version: note.Version, DeletedAt: time.Now(), seq: s.seq}
+	}
+	s.prune()
+
+	c := Change{Type: typ, Note: *note, Fields: fields}
+	c.Note.Tags = append([]string{}, note.Tags...)
+	for _, fn := range s.onChange {
+		fn(c)
+	}
 }
 
 func NewStore() *Store {
-	return &Store{notes: make(map[string]*Note)}
+	return &Store{
+		notes:      make(map[string]*Note),
+		tombstones: make(map[string]Tombstone),
+		clientIDs:  make(map[string]clientID),
+		positions:  make(map[string]string),
+		retention:  SyncRetention,
+	}
 }
 
 func (s *Store) newID() string {
@@ -52,6 +135,7 @@ type CreateInput struct {
 	Body     string   `json:"body"`
 	Priority Priority `json:"priority"`
 	Tags     []string `json:"tags"`
+	Pinned   bool     `json:"pinned"`
 }
 
 type UpdateInput struct {
@@ -60,12 +144,41 @@ type UpdateInput struct {
 	Done     *bool     `json:"done,omitempty"`
 	Priority *Priority `json:"priority,omitempty"`
 	Tags     []string  `json:"tags,omitempty"`
+	Pinned   *bool     `json:"pinned,omitempty"`
+}
+
+// ReplaceInput is the full set of user-editable fields of a note. PUT replaces
+// every field with the given values; absent fields take their zero value.
+type ReplaceInput struct {
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	Done     bool     `json:"done"`
+	Priority Priority `json:"priority"`
+	Tags     []string `json:"tags"`
+	Pinned   bool     `json:"pinned"`
+}
+
+// MoveInput places a note directly before or directly after another note.
+// Exactly one of Before and After must be set.
+type MoveInput struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
 }
 
 func (s *Store) Create(userID string, input CreateInput) *Note {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.create(userID, ReplaceInput{
+		Title:    input.Title,
+		Body:     input.Body,
+		Priority: input.Priority,
+		Tags:     input.Tags,
+		Pinned:   input.Pinned,
+	})
+}
 
+// create adds a note. Callers must hold s.mu.
+func (s *Store) create(userID string, input ReplaceInput) *Note {
 	now := time.Now()
 	priority := input.Priority
 	if priority == "" {
@@ -81,13 +194,16 @@ func (s *Store) Create(userID string, input CreateInput) *Note {
 		UserID:    userID,
 		Title:     input.Title,
 		Body:      input.Body,
-		Done:      false,
+		Done:      input.Done,
 		Priority:  priority,
 		Tags:      tags,
+		Pinned:    input.Pinned,
+		Position:  s.nextPosition(userID),
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 	s.notes[note.ID] = note
+	s.changed(ChangeCreated, note)
 	return note
 }
 
@@ -115,9 +231,30 @@ func (s *Store) List(userID string) []*Note {
 			result = append(result, n)
 		}
 	}
+	sortNotes(result)
 	return result
 }
 
+// CountByUser returns the number of notes each user owns.
+func (s *Store) CountByUser() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, n := range s.notes {
+		counts[n.UserID]++
+	}
+	return counts
+}
+
+// nextPosition returns a position key after all of the user's notes.
+// Callers must hold s.mu.
+func (s *Store) nextPosition(userID string) string {
+	p := keyAfter(s.positions[userID])
+	s.positions[userID] = p
+	return p
+}
+
 func (s *Store) Update(userID, noteID string, input UpdateInput) (*Note, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -145,10 +282,92 @@ func (s *Store) Update(userID, noteID string, input UpdateInput) (*Note, error)
 	if input.Tags != nil {
 		note.Tags = input.Tags
 	}
-	note.UpdatedAt = time.Now()
+	if input.Pinned != nil {
+		s.setPinned(note, *input.Pinned)
+	}
+	s.changed(ChangeUpdated, note)
+	return note, nil
+}
+
+// Replace overwrites every editable field of a note.
+func (s *Store) Replace(userID, noteID string, input ReplaceInput) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[noteID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if note.UserID != userID {
+		return nil, ErrForbidden
+	}
+	s.replace(note, input)
+	return note, nil
+}
+
+// Patch atomically reads a note's editable fields, passes them to fn and
+// stores the result. fn runs with the store locked, so no other write can
+// slip in between the read and the write; it must not call back into s.
+func (s *Store) Patch(userID, noteID string, fn func(ReplaceInput) (ReplaceInput, error)) (*Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[noteID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if note.UserID != userID {
+		return nil, ErrForbidden
+	}
+	input, err := fn(note.editable())
+	if err != nil {
+		return nil, err
+	}
+	s.replace(note, input)
 	return note, nil
 }
 
+func (n *Note) editable() ReplaceInput {
+	return ReplaceInput{
+		Title:    n.Title,
+		Body:     n.Body,
+		Done:     n.Done,
+		Priority: n.Priority,
+		Tags:     append([]string{}, n.Tags...),
+		Pinned:   n.Pinned,
+	}
+}
+
+// replace applies input to note and records the write. Callers must hold
+// s.mu.
+func (s *Store) replace(note *Note, input ReplaceInput) {
+	priority := input.Priority
+	if priority == "" {
+		priority = PriorityMedium
+	}
+	tags := input.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	note.Title = input.Title
+	note.Body = input.Body
+	note.Done = input.Done
+	note.Priority = priority
+	note.Tags = tags
+	s.setPinned(note, input.Pinned)
+	s.changed(ChangeUpdated, note)
+}
+
+// setPinned pins or unpins a note. A note that changes group moves to the
+// end of its new group. Callers must hold s.mu.
+func (s *Store) setPinned(note *Note, pinned bool) {
+	if note.Pinned == pinned {
+		return
+	}
+	note.Pinned = pinned
+	note.Position = s.nextPosition(note.UserID)
+}
+
 func (s *Store) Delete(userID, noteID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -161,5 +380,105 @@ func (s *Store) Delete(userID, noteID string) error {
 		return ErrForbidden
 	}
 	delete(s.notes, noteID)
+	s.changed(ChangeDeleted, note)
 	return nil
 }
+
+// DeleteUser deletes every note of a user, notifying listeners of each, and
+// forgets the user's tombstones and sync client IDs. It returns how many
+// notes were deleted.
+func (s *Store) DeleteUser(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []*Note
+	for _, n := range s.notes {
+		if n.UserID == userID {
+			list = append(list, n)
+		}
+	}
+	sortNotes(list)
+	for _, n := range list {
+		delete(s.notes, n.ID)
+		s.changed(ChangeDeleted, n)
+	}
+	for id, t := range s.tombstones {
+		if t.UserID == userID {
+			delete(s.tombstones, id)
+		}
+	}
+	for key := range s.clientIDs {
+		if strings.HasPrefix(key, userID+"/") {
+			delete(s.clientIDs, key)
+		}
+	}
+	delete(s.positions, userID)
+	return len(list)
+}
+
+// Move gives a note a new position directly before or after another note of
+// the same user. The moved note joins the target's pinned or unpinned group.
+// The new key is computed under the store lock from the target's current
+// neighbour, so concurrent moves are serialised and never produce duplicates.
+func (s *Store) Move(userID, noteID string, input MoveInput) (*Note, error) {
+	if (input.Before == "") == (input.After == "") {
+		return nil, ErrInvalidMove
+	}
+	targetID := input.Before
+	if targetID == "" {
+		targetID = input.After
+	}
+	if targetID == noteID {
+		return nil, ErrInvalidMove
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[noteID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if note.UserID != userID {
+		return nil, ErrForbidden
+	}
+	target, ok := s.notes[targetID]
+	if !ok || target.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	// The target's group, in listing order, without the note being moved.
+	var group []*Note
+	for _, n := range s.notes {
+		if n.UserID == userID && n.Pinned == target.Pinned && n.ID != noteID {
+			group = append(group, n)
+		}
+	}
+	sortNotes(group)
+
+	i := 0
+	for group[i].ID != targetID {
+		i++
+	}
+	lo, hi := "", ""
+	if input.Before != "" {
+		hi = target.Position
+		if i > 0 {
+			lo = group[i-1].Position
+		}
+	} else {
+		lo = target.Position
+		if i < len(group)-1 {
+			hi = group[i+1].Position
+		}
+	}
+
+	note.Pinned = target.Pinned
+	if hi == "" {
+		note.Position = s.nextPosition(userID)
+	} else {
+		note.Position = keyBetween(lo, hi)
+	}
+	s.changed(ChangeUpdated, note)
+	return note, nil
+}
@@ -1,9 +1,14 @@
 package notes_test
 
 import (
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"goproject/internal/notes"
+	"goproject/internal/validation"
 )
 
 func TestCreateAndList(t *testing.T) {
@@ -65,3 +70,387 @@ func TestGetUpdateDelete(t *testing.T) {
 		t.Errorf("expected ErrNotFound after delete, got %v", err)
 	}
 }
+
+func titles(list []*notes.Note) []string {
+	out := make([]string, len(list))
+	for i, n := range list {
+		out[i] = n.Title
+	}
+	return out
+}
+
+func TestPinnedAndMove(t *testing.T) {
+	s := notes.NewStore()
+	a := s.Create("u1", notes.CreateInput{Title: "a"})
+	b := s.Create("u1", notes.CreateInput{Title: "b"})
+	c := s.Create("u1", notes.CreateInput{Title: "c"})
+
+	if got := titles(s.List("u1")); strings.Join(got, "") != "abc" {
+		t.Fatalf("expected creation order abc, got %v", got)
+	}
+
+	// move c before a
+	if _, err := s.Move("u1", c.ID, notes.MoveInput{Before: a.ID}); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	// move a after b
+	if _, err := s.Move("u1", a.ID, notes.MoveInput{After: b.ID}); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if got := titles(s.List("u1")); strings.Join(got, "") != "cba" {
+		t.Fatalf("expected cba, got %v", got)
+	}
+
+	// pinned notes come first
+	pinned := true
+	if _, err := s.Update("u1", a.ID, notes.UpdateInput{Pinned: &pinned}); err != nil {
+		t.Fatalf("pin failed: %v", err)
+	}
+	if got := titles(s.List("u1")); strings.Join(got, "") != "acb" {
+		t.Fatalf("expected acb, got %v", got)
+	}
+
+	// moving next to a pinned note pins the moved note
+	moved, err := s.Move("u1", b.ID, notes.MoveInput{Before: a.ID})
+	if err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if !moved.Pinned {
+		t.Error("note moved into pinned group should be pinned")
+	}
+	if got := titles(s.List("u1")); strings.Join(got, "") != "bac" {
+		t.Fatalf("expected bac, got %v", got)
+	}
+
+	// invalid moves
+	if _, err := s.Move("u1", a.ID, notes.MoveInput{}); err != notes.ErrInvalidMove {
+		t.Errorf("expected ErrInvalidMove, got %v", err)
+	}
+	if _, err := s.Move("u1", a.ID, notes.MoveInput{Before: a.ID}); err != notes.ErrInvalidMove {
+		t.Errorf("expected ErrInvalidMove, got %v", err)
+	}
+	other := s.Create("u2", notes.CreateInput{Title: "x"})
+	if _, err := s.Move("u1", a.ID, notes.MoveInput{Before: other.ID}); err != notes.ErrNotFound {
+		t.Errorf("expected ErrNotFound for another user's note, got %v", err)
+	}
+}
+
+func TestConcurrentMovesKeepDistinctPositions(t *testing.T) {
+	s := notes.NewStore()
+	first := s.Create("u1", notes.CreateInput{Title: "first"})
+	var ids []string
+	for i := 0; i < 50; i++ {
+		ids = append(ids, s.Create("u1", notes.CreateInput{Title: "n"}).ID)
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			s.Move("u1", id, notes.MoveInput{Before: first.ID})
+		}(id)
+	}
+	wg.Wait()
+
+	list := s.List("u1")
+	seen := map[string]bool{}
+	for _, n := range list {
+		if seen[n.Position] {
+			t.Fatalf("duplicate position %q", n.Position)
+		}
+		seen[n.Position] = true
+	}
+	if list[len(list)-1].ID != first.ID {
+		t.Errorf("expected %s to be last, got %s", first.ID, list[len(list)-1].ID)
+	}
+}
+
+func TestAppendedPositionsStayShort(t *testing.T) {
+	s := notes.NewStore()
+	var ids []string
+	for i := 0; i < 5000; i++ {
+		ids = append(ids, s.Create("u1", notes.CreateInput{Title: "n"}).ID)
+	}
+	list := s.List("u1")
+	for i, n := range list {
+		if n.ID != ids[i] {
+			t.Fatalf("position %d holds %s, want %s", i, n.ID, ids[i])
+		}
+		if len(n.Position) > 5 {
+			t.Fatalf("note %d has position %q", i, n.Position)
+		}
+	}
+
+	// Moving the first note to the end again and again appends too.
+	first := s.Create("u2", notes.CreateInput{Title: "a"})
+	last := s.Create("u2", notes.CreateInput{Title: "b"})
+	for i := 0; i < 1000; i++ {
+		moved, err := s.Move("u2", first.ID, notes.MoveInput{After: last.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(moved.Position) > 4 {
+			t.Fatalf("move %d gave position %q", i, moved.Position)
+		}
+		first, last = last, moved
+	}
+	if got := s.List("u2"); got[1].ID != last.ID {
+		t.Errorf("last moved note is not last")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := notes.CreateInput{Title: "Buy milk", Priority: notes.PriorityLow, Tags: []string{"home"}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("expected valid input, got %v", err)
+	}
+
+	bad := notes.CreateInput{
+		Title:    strings.Repeat("x", notes.MaxTitleLen+1),
+		Priority: "urgent",
+		Tags:     []string{"a", "a", ""},
+	}
+	err := bad.Validate()
+	var verr *validation.Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *validation.Error, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, f := range verr.Fields {
+		fields[f.Field] = true
+	}
+	for _, want := range []string{"title", "priority", "tags[1]", "tags[2]"} {
+		if !fields[want] {
+			t.Errorf("expected error for %s, got %v", want, verr.Fields)
+		}
+	}
+
+	if err := (notes.CreateInput{}).Validate(); err == nil {
+		t.Error("missing title should be invalid")
+	}
+
+	empty := ""
+	prio := notes.Priority("urgent")
+	if err := (notes.UpdateInput{Title: &empty, Priority: &prio}).Validate(); err == nil {
+		t.Error("empty title and unknown priority should be invalid")
+	}
+	if err := (notes.UpdateInput{}).Validate(); err != nil {
+		t.Errorf("empty update should be valid, got %v", err)
+	}
+}
+
+func TestReplaceAndPatch(t *testing.T) {
+	s := notes.NewStore()
+	n := s.Create("u1", notes.CreateInput{Title: "Test", Body: "body", Tags: []string{"a"}, Priority: notes.PriorityHigh})
+
+	// replace resets absent fields
+	got, err := s.Replace("u1", n.ID, notes.ReplaceInput{Title: "New"})
+	if err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if got.Body != "" || len(got.Tags) != 0 || got.Priority != notes.PriorityMedium {
+		t.Errorf("replace should reset omitted fields, got %+v", got)
+	}
+
+	// patch sees the current fields and stores the result
+	got, err = s.Patch("u1", n.ID, func(in notes.ReplaceInput) (notes.ReplaceInput, error) {
+		if in.Title != "New" {
+			t.Errorf("patch saw stale title %q", in.Title)
+		}
+		in.Done = true
+		return in, nil
+	})
+	if err != nil || !got.Done || got.Title != "New" {
+		t.Fatalf("patch failed: %v %+v", err, got)
+	}
+
+	// a failing patch leaves the note untouched
+	boom := errors.New("boom")
+	_, err = s.Patch("u1", n.ID, func(in notes.ReplaceInput) (notes.ReplaceInput, error) {
+		in.Title = "changed"
+		return in, boom
+	})
+	if err != boom {
+		t.Errorf("expected boom, got %v", err)
+	}
+	if got, _ := s.Get("u1", n.ID); got.Title != "New" {
+		t.Errorf("failed patch modified the note: %q", got.Title)
+	}
+
+	if _, err := s.Replace("u2", n.ID, notes.ReplaceInput{Title: "x"}); err != notes.ErrForbidden {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestChangesCarryVersions(t *testing.T) {
+	s := notes.NewStore()
+	var changes []notes.Change
+	s.OnChange(func(c notes.Change) { changes = append(changes, c) })
+
+	n := s.Create("u1", notes.CreateInput{Title: "a", Tags: []string{"x"}})
+	s.Replace("u1", n.ID, notes.ReplaceInput{Title: "b", Tags: []string{"y"}})
+	s.Replace("u2", n.ID, notes.ReplaceInput{Title: "forbidden"})
+	s.Delete("u1", n.ID)
+
+	want := []struct {
+		typ     string
+		version int
+		title   string
+	}{
+		{notes.ChangeCreated, 1, "a"},
+		{notes.ChangeUpdated, 2, "b"},
+		{notes.ChangeDeleted, 3, "b"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Type != w.typ || c.Note.Version != w.version || c.Note.Title != w.title {
+			t.Errorf("change %d = %s v%d %q, want %s v%d %q", i, c.Type, c.Note.Version, c.Note.Title, w.typ, w.version, w.title)
+		}
+	}
+	if changes[0].Note.Tags[0] != "x" {
+		t.Error("change shares its tags with the stored note")
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	s := notes.NewStore()
+	a := s.Create("u1", notes.CreateInput{Title: "a"})
+	b := s.Create("u1", notes.CreateInput{Title: "b"})
+	s.Create("u2", notes.CreateInput{Title: "other"})
+
+	full, err := s.ChangesSince("u1", 0, 0)
+	if err != nil || len(full.Changes) != 2 || full.More {
+		t.Fatalf("full sync = %+v, %v", full, err)
+	}
+
+	title := "a2"
+	s.Update("u1", a.ID, notes.UpdateInput{Title: &title})
+	s.Delete("u1", b.ID)
+	delta, _ := s.ChangesSince("u1", full.Token, 1)
+	if !delta.More || len(delta.Changes) != 1 || delta.Changes[0].Note.Title != "a2" {
+		t.Fatalf("first page = %+v", delta)
+	}
+	delta, _ = s.ChangesSince("u1", delta.Token, 1)
+	if delta.More || len(delta.Changes) != 1 || delta.Changes[0].Tombstone == nil || delta.Changes[0].Tombstone.ID != b.ID {
+		t.Fatalf("second page = %+v", delta)
+	}
+	if empty, _ := s.ChangesSince("u1", delta.Token, 0); len(empty.Changes) != 0 || empty.Token != delta.Token {
+		t.Errorf("caught-up sync = %+v", empty)
+	}
+	if _, err := s.ChangesSince("u1", delta.Token+100, 0); err != notes.ErrSyncToken {
+		t.Errorf("expected ErrSyncToken, got %v", err)
+	}
+}
+
+func TestSyncResolvesConflicts(t *testing.T) {
+	s := notes.NewStore()
+	n := s.Create("u1", notes.CreateInput{Title: "a", Body: "body"})
+	created := n.UpdatedAt
+
+	// Another device edits the body; an offline edit of the title merges.
+	body := "server body"
+	s.Update("u1", n.ID, notes.UpdateInput{Body: &body})
+	title, clientBody := "client title", "client body"
+	r := s.Sync("u1", []notes.Mutation{{Op: notes.OpUpdate, ID: n.ID, BaseVersion: 1, UpdatedAt: created, Fields: notes.UpdateInput{Title: &title}}})[0]
+	if r.Status != notes.SyncMerged || r.Note.Title != title || r.Note.Body != body || r.Note.Version != 3 {
+		t.Fatalf("merge = %+v", r)
+	}
+
+	// An older edit of the same field loses, a newer one wins.
+	older := s.Sync("u1", []notes.Mutation{{Op: notes.OpUpdate, ID: n.ID, BaseVersion: 1, UpdatedAt: created, Fields: notes.UpdateInput{Body: &clientBody}}})[0]
+	if older.Status != notes.SyncConflict || older.Note.Body != body || older.Conflicts[0].Winner != "server" {
+		t.Fatalf("older edit = %+v", older)
+	}
+	newer := s.Sync("u1", []notes.Mutation{{Op: notes.OpUpdate, ID: n.ID, BaseVersion: 1, UpdatedAt: time.Now().Add(time.Minute), Fields: notes.UpdateInput{Body: &clientBody}}})[0]
+	if newer.Status != notes.SyncConflict || newer.Note.Body != clientBody || newer.Conflicts[0].Winner != "client" {
+		t.Fatalf("newer edit = %+v", newer)
+	}
+
+	// A stale delete loses to the edits; a current one wins, and replays.
+	stale := s.Sync("u1", []notes.Mutation{{Op: notes.OpDelete, ID: n.ID, BaseVersion: 1, UpdatedAt: created}})[0]
+	if stale.Status != notes.SyncConflict || stale.Note == nil {
+		t.Fatalf("stale delete = %+v", stale)
+	}
+	results := s.Sync("u1", []notes.Mutation{
+		{Op: notes.OpDelete, ID: n.ID, BaseVersion: newer.Note.Version},
+		{Op: notes.OpDelete, ID: n.ID, BaseVersion: newer.Note.Version},
+		{Op: notes.OpUpdate, ID: n.ID, BaseVersion: newer.Note.Version, Fields: notes.UpdateInput{Title: &title}},
+		{Op: notes.OpDelete, ID: "note_999"},
+	})
+	want := []string{notes.SyncApplied, notes.SyncApplied, notes.SyncConflict, notes.SyncRejected}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("result %d = %+v, want %s", i, r, want[i])
+		}
+	}
+	if !results[2].Deleted {
+		t.Error("edit of a deleted note should report the deletion")
+	}
+}
+
+func TestSyncClampsClientTime(t *testing.T) {
+	s := notes.NewStore()
+	n := s.Create("u1", notes.CreateInput{Title: "a"})
+	future := time.Now().Add(time.Hour)
+	first, second := "first", "second"
+	// The first mutation writes after the batch was received; the second,
+	// dated in the future but made on the old version, must not beat it.
+	results := s.Sync("u1", []notes.Mutation{
+		{Op: notes.OpUpdate, ID: n.ID, BaseVersion: 1, UpdatedAt: future, Fields: notes.UpdateInput{Title: &first}},
+		{Op: notes.OpUpdate, ID: n.ID, BaseVersion: 1, UpdatedAt: future, Fields: notes.UpdateInput{Title: &second}},
+	})
+	if r := results[1]; r.Status != notes.SyncConflict || r.Note.Title != first || r.Conflicts[0].Winner != "server" {
+		t.Fatalf("future-dated edit = %+v", r)
+	}
+	if r := s.Sync("u1", []notes.Mutation{{Op: notes.OpDelete, ID: n.ID, BaseVersion: 1, UpdatedAt: future}})[0]; r.Status != notes.SyncApplied {
+		t.Errorf("future-dated delete of an older write = %+v", r)
+	}
+}
+
+func TestSyncRetention(t *testing.T) {
+	s := notes.NewStore()
+	a := s.Create("u1", notes.CreateInput{Title: "a"})
+	title := "offline"
+	created := s.Sync("u1", []notes.Mutation{{Op: notes.OpCreate, ClientID: "c1", Fields: notes.UpdateInput{Title: &title}}})[0]
+	before, _ := s.ChangesSince("u1", 0, 0)
+	s.Delete("u1", a.ID)
+	after, _ := s.ChangesSince("u1", 0, 0)
+
+	time.Sleep(10 * time.Millisecond)
+	s.SetSyncRetention(5 * time.Millisecond)
+	if _, err := s.ChangesSince("u1", before.Token, 0); err != notes.ErrSyncToken {
+		t.Errorf("token from before a forgotten tombstone: %v", err)
+	}
+	if set, err := s.ChangesSince("u1", after.Token, 0); err != nil || len(set.Changes) != 0 {
+		t.Errorf("token from after it = %+v, %v", set, err)
+	}
+	if set, err := s.ChangesSince("u1", 0, 0); err != nil || len(set.Changes) != 1 {
+		t.Errorf("full sync = %+v, %v", set, err)
+	}
+	// The client ID is forgotten too, so a retry makes a new note.
+	again := s.Sync("u1", []notes.Mutation{{Op: notes.OpCreate, ClientID: "c1", Fields: notes.UpdateInput{Title: &title}}})[0]
+	if again.Note == nil || again.Note.ID == created.Note.ID {
+		t.Errorf("create after retention = %+v", again)
+	}
+}
+
+func TestSyncCreateIsIdempotent(t *testing.T) {
+	s := notes.NewStore()
+	title := "offline"
+	m := notes.Mutation{Op: notes.OpCreate, ClientID: "c1", Fields: notes.UpdateInput{Title: &title}}
+	first := s.Sync("u1", []notes.Mutation{m})[0]
+	again := s.Sync("u1", []notes.Mutation{m})[0]
+	if first.Status != notes.SyncApplied || again.Note == nil || again.Note.ID != first.Note.ID {
+		t.Fatalf("retried create = %+v, first %+v", again, first)
+	}
+	if n := len(s.List("u1")); n != 1 {
+		t.Errorf("got %d notes, want 1", n)
+	}
+	if bad := s.Sync("u1", []notes.Mutation{{Op: notes.OpCreate}})[0]; bad.Status != notes.SyncRejected {
+		t.Errorf("create without title = %+v", bad)
+	}
+}
@@ -0,0 +1,126 @@
+package notes
+
+import (
+	"sort"
+	"strings"
+)
+
+// positionDigits is the alphabet used for fractional ordering keys. It is in
+// ascending byte order so that keys compare correctly as plain strings.
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// keyBetween returns a position key that sorts strictly between a and b.
+// An empty a means "before everything", an empty b means "after everything".
+// Keys never end in the smallest digit, so there is always room to insert
+// another key in front of any existing one.
+func keyBetween(a, b string) string {
+	if b != "" {
+		// Strip the common prefix, treating a as padded with zero digits.
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + keyBetween(rest, b[n:])
+		}
+	}
+
+	lo := 0
+	if a != "" {
+		lo = strings.IndexByte(positionDigits, a[0])
+	}
+	hi := len(positionDigits)
+	if b != "" {
+		hi = strings.IndexByte(positionDigits, b[0])
+	}
+
+	if hi-lo > 1 {
+		return string(positionDigits[(lo+hi+1)/2])
+	}
+	// The first digits are adjacent.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(positionDigits[lo]) + keyBetween(rest, "")
+}
+
+// keyAfter returns a short key that sorts after a, for appending after the
+// last key. Below "z" it steps the first digit. From "z" on, keys are "z", a
+// digit giving the width of a counter, then the counter, which widens only
+// once it is used up: n appends need O(log n) digits, where keyBetween(a, "")
+// would need O(n).
+func keyAfter(a string) string {
+	if a == "" {
+		return string(positionDigits[len(positionDigits)/2])
+	}
+	if i := strings.IndexByte(positionDigits, a[0]); i < len(positionDigits)-1 {
+		return string(positionDigits[i+1])
+	}
+	width := 1
+	if len(a) > 1 {
+		width = strings.IndexByte(positionDigits, a[1]) + 1
+	}
+	counter := []byte(strings.Repeat(positionDigits[:1], width))
+	if len(a) > 2 {
+		copy(counter, a[2:])
+	}
+	if increment(counter) {
+		return "z" + string(positionDigits[width-1]) + string(counter)
+	}
+	if width == len(positionDigits) {
+		return a + keyAfter("")
+	}
+	return "z" + string(positionDigits[width]) + strings.Repeat(positionDigits[:1], width) + positionDigits[1:2]
+}
+
+// increment adds one to the counter d in place, skipping values that end in
+// the smallest digit. It reports false if d was already the largest value.
+func increment(d []byte) bool {
+	for {
+		i := len(d) - 1
+		for ; i >= 0 && d[i] == positionDigits[len(positionDigits)-1]; i-- {
+			d[i] = positionDigits[0]
+		}
+		if i < 0 {
+			return false
+		}
+		d[i] = positionDigits[strings.IndexByte(positionDigits, d[i])+1]
+		if d[len(d)-1] != positionDigits[0] {
+			return true
+		}
+	}
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return positionDigits[0]
+}
+
+// less reports whether a is listed before b: pinned notes first, then by
+// position, with creation order and ID as tie-breakers so the order is stable.
+func less(a, b *Note) bool {
+	if a.Pinned != b.Pinned {
+		return a.Pinned
+	}
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+func sortNotes(list []*Note) {
+	sort.Slice(list, func(i, j int) bool { return less(list[i], list[j]) })
+}
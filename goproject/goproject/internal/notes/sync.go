@@ -0,0 +1,439 @@
+package notes
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrSyncToken is returned by ChangesSince for a token the store never
+// issued, or one older than the retention window. Clients should discard
+// their copy and sync again from zero.
+var ErrSyncToken = errors.New("unknown sync token")
+
+// SyncRetention is how long a store keeps tombstones and sync client IDs by
+// default. A client that has not synced for longer must start again from
+// zero, since it may have missed deletions.
+const SyncRetention = 30 * 24 * time.Hour
+
+// clientID is the note a sync client's create made, and when.
+type clientID struct {
+	noteID string
+	at     time.Time
+}
+
+// SetSyncRetention changes how long tombstones and sync client IDs are
+// kept; see SyncRetention.
+func (s *Store) SetSyncRetention(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = d
+	s.pruned = time.Time{}
+	s.prune()
+}
+
+// prune forgets tombstones and client IDs older than the retention window,
+// remembering the newest forgotten tombstone so that tokens from before it
+// are refused. It runs at most once a minute (or once per window, if that
+// is shorter). Callers must hold s.mu for writing.
+func (s *Store) prune() {
+	now := time.Now()
+	if now.Sub(s.pruned) < min(time.Minute, s.retention) {
+		return
+	}
+	s.pruned = now
+	cutoff := now.Add(-s.retention)
+	for id, t := range s.tombstones {
+		if t.DeletedAt.Before(cutoff) {
+			s.horizon = max(s.horizon, t.seq)
+			delete(s.tombstones, id)
+		}
+	}
+	for key, c := range s.clientIDs {
+		if c.at.Before(cutoff) {
+			delete(s.clientIDs, key)
+		}
+	}
+}
+
+// Mutation operations.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Mutation statuses.
+const (
+	// SyncApplied means the mutation was based on the current version.
+	SyncApplied = "applied"
+	// SyncMerged means the note changed since the base version, but only in
+	// fields the mutation did not touch.
+	SyncMerged = "merged"
+	// SyncConflict means the mutation and a newer server write touched the
+	// same field. Each conflict is resolved as listed in Conflicts; a delete
+	// that loses leaves the note in place.
+	SyncConflict = "conflict"
+	// SyncRejected means nothing was written; Err says why.
+	SyncRejected = "rejected"
+)
+
+// fieldStamp records the last write to one editable field.
+type fieldStamp struct {
+	version int
+	at      time.Time
+}
+
+// Tombstone records a deleted note, so that clients that still hold it
+// learn of the deletion.
+type Tombstone struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Version   int       `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+
+	seq uint64
+}
+
+// SyncChange is one entry of a ChangeSet: the current state of a note, or
+// its tombstone.
+type SyncChange struct {
+	Note      *Note
+	Tombstone *Tombstone
+}
+
+// ChangeSet is the result of ChangesSince.
+type ChangeSet struct {
+	Changes []SyncChange
+	Token   uint64 // pass as since to get the changes after these
+	More    bool   // the limit was hit; call again with Token
+}
+
+// ChangesSince returns the user's notes and tombstones written after the
+// sync token since, oldest first, at most limit of them (no limit if limit
+// is zero). Each note appears once, in its latest state. Since zero returns
+// every note and no tombstones; a since from before a tombstone that has
+// been forgotten returns ErrSyncToken.
+func (s *Store) ChangesSince(userID string, since uint64, limit int) (ChangeSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if since > s.seq || since > 0 && since < s.horizon {
+		return ChangeSet{}, ErrSyncToken
+	}
+	type entry struct {
+		seq uint64
+		SyncChange
+	}
+	var entries []entry
+	for _, n := range s.notes {
+		if n.UserID == userID && n.seq > since {
+			c := *n
+			c.Tags = append([]string{}, n.Tags...)
+			entries = append(entries, entry{n.seq, SyncChange{Note: &c}})
+		}
+	}
+	if since > 0 {
+		for _, t := range s.tombstones {
+			if t.UserID == userID && t.seq > since {
+				t := t
+				entries = append(entries, entry{t.seq, SyncChange{Tombstone: &t}})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	set := ChangeSet{Token: s.seq}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+		set.Token = entries[limit-1].seq
+		set.More = true
+	}
+	for _, e := range entries {
+		set.Changes = append(set.Changes, e.SyncChange)
+	}
+	return set, nil
+}
+
+// Mutation is one offline edit sent by a sync client.
+type Mutation struct {
+	Op string `json:"op"`
+	// ClientID names a created note on the client, so that a create that is
+	// retried after a lost response does not make a second note.
+	ClientID string `json:"client_id,omitempty"`
+	// ID and BaseVersion identify the note and the version the client
+	// edited, for update and delete.
+	ID          string `json:"id,omitempty"`
+	BaseVersion int    `json:"base_version,omitempty"`
+	// UpdatedAt is when the edit was made on the client. It breaks
+	// conflicts: the later write wins, and the server wins a tie. Times
+	// after the server received the mutation count as that time, so a
+	// client with a fast clock cannot win every conflict.
+	UpdatedAt time.Time   `json:"updated_at"`
+	Fields    UpdateInput `json:"fields"`
+}
+
+// FieldConflict describes one field that the mutation and a newer server
+// write both changed.
+type FieldConflict struct {
+	Field  string `json:"field"`
+	Server any    `json:"server"`
+	Client any    `json:"client"`
+	Winner string `json:"winner"` // "server" or "client"
+}
+
+// MutationResult is the outcome of one Mutation. Note is a copy of the note
+// after the mutation, nil if it is deleted.
+type MutationResult struct {
+	Status    string
+	Note      *Note
+	Deleted   bool
+	Conflicts []FieldConflict
+	Err       error
+}
+
+// Sync applies a batch of mutations in order, as one write. Results are in
+// the order of muts. Conflicts are resolved per field: a field the server
+// has not written since BaseVersion takes the client's value; otherwise the
+// write with the later UpdatedAt wins.
+func (s *Store) Sync(userID string, muts []Mutation) []MutationResult {
+	received := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]MutationResult, len(muts))
+	for i, m := range muts {
+		if m.UpdatedAt.After(received) {
+			m.UpdatedAt = received
+		}
+		var r MutationResult
+		switch m.Op {
+		case OpCreate:
+			r = s.syncCreate(userID, m)
+		case OpUpdate:
+			r = s.syncUpdate(userID, m)
+		case OpDelete:
+			r = s.syncDelete(userID, m)
+		default:
+			r = rejected(errors.New(`op must be one of create, update, delete`))
+		}
+		if r.Note != nil {
+			c := *r.Note
+			c.Tags = append([]string{}, r.Note.Tags...)
+			r.Note = &c
+		}
+		results[i] = r
+	}
+	return results
+}
+
+func rejected(err error) MutationResult {
+	return MutationResult{Status: SyncRejected, Err: err}
+}
+
+func (s *Store) syncCreate(userID string, m Mutation) MutationResult {
+	key := userID + "/" + m.ClientID
+	if c, ok := s.clientIDs[key]; ok && m.ClientID != "" {
+		if n, ok := s.notes[c.noteID]; ok {
+			return MutationResult{Status: SyncApplied, Note: n}
+		}
+		return MutationResult{Status: SyncApplied, Deleted: true}
+	}
+	var in ReplaceInput
+	setFields(&in, m.Fields)
+	if err := (CreateInput{Title: in.Title, Body: in.Body, Priority: in.Priority, Tags: in.Tags}).Validate(); err != nil {
+		return rejected(err)
+	}
+	n := s.create(userID, in)
+	if m.ClientID != "" {
+		s.clientIDs[key] = clientID{noteID: n.ID, at: time.Now()}
+	}
+	return MutationResult{Status: SyncApplied, Note: n}
+}
+
+// owned returns the user's note, or reports whether the user's note was
+// deleted. Notes of other users are reported as not found.
+func (s *Store) owned(userID, id string) (note *Note, deleted bool, err error) {
+	if n, ok := s.notes[id]; ok && n.UserID == userID {
+		return n, false, nil
+	}
+	if t, ok := s.tombstones[id]; ok && t.UserID == userID {
+		return nil, true, nil
+	}
+	return nil, false, ErrNotFound
+}
+
+func (s *Store) syncUpdate(userID string, m Mutation) MutationResult {
+	note, deleted, err := s.owned(userID, m.ID)
+	switch {
+	case err != nil:
+		return rejected(err)
+	case deleted:
+		// The server deleted the note; a delete always wins over an edit
+		// of the deleted version, and the client may recreate the note.
+		return MutationResult{Status: SyncConflict, Deleted: true}
+	case m.BaseVersion > note.Version:
+		return rejected(errors.New("base_version is newer than the note"))
+	}
+	if err := m.Fields.Validate(); err != nil {
+		return rejected(err)
+	}
+
+	var client ReplaceInput
+	setFields(&client, m.Fields)
+	stale := m.BaseVersion < note.Version
+	current := note.editable()
+	next := note.editable()
+	var conflicts []FieldConflict
+	for _, f := range presentFields(m.Fields) {
+		clientVal, serverVal := field(client, f), field(current, f)
+		stamp := note.clock[f]
+		switch {
+		case stamp.version <= m.BaseVersion:
+			copyField(&next, client, f)
+		case equalField(client, current, f):
+			// Both sides made the same change.
+		case m.UpdatedAt.After(stamp.at):
+			copyField(&next, client, f)
+			conflicts = append(conflicts, FieldConflict{Field: f, Server: serverVal, Client: clientVal, Winner: "client"})
+		default:
+			conflicts = append(conflicts, FieldConflict{Field: f, Server: serverVal, Client: clientVal, Winner: "server"})
+		}
+	}
+	if len(changedFields(current, next, false)) > 0 {
+		s.replace(note, next)
+	}
+
+	r := MutationResult{Status: SyncApplied, Note: note, Conflicts: conflicts}
+	switch {
+	case len(conflicts) > 0:
+		r.Status = SyncConflict
+	case stale:
+		r.Status = SyncMerged
+	}
+	return r
+}
+
+func (s *Store) syncDelete(userID string, m Mutation) MutationResult {
+	note, deleted, err := s.owned(userID, m.ID)
+	switch {
+	case err != nil:
+		return rejected(err)
+	case deleted:
+		return MutationResult{Status: SyncApplied, Deleted: true}
+	case m.BaseVersion > note.Version:
+		return rejected(errors.New("base_version is newer than the note"))
+	case m.BaseVersion < note.Version && !m.UpdatedAt.After(note.UpdatedAt):
+		// The note was edited after the client's copy, and later than the
+		// client deleted it: keep the edit.
+		return MutationResult{Status: SyncConflict, Note: note}
+	}
+	delete(s.notes, note.ID)
+	s.changed(ChangeDeleted, note)
+	return MutationResult{Status: SyncApplied, Deleted: true}
+}
+
+// ─── field helpers ──────────────────────────────────────────────────────────
+
+var syncFields = []string{"title", "body", "done", "priority", "tags", "pinned"}
+
+// presentFields lists the fields set in an UpdateInput.
+func presentFields(in UpdateInput) []string {
+	var out []string
+	if in.Title != nil {
+		out = append(out, "title")
+	}
+	if in.Body != nil {
+		out = append(out, "body")
+	}
+	if in.Done != nil {
+		out = append(out, "done")
+	}
+	if in.Priority != nil {
+		out = append(out, "priority")
+	}
+	if in.Tags != nil {
+		out = append(out, "tags")
+	}
+	if in.Pinned != nil {
+		out = append(out, "pinned")
+	}
+	return out
+}
+
+// setFields copies the fields set in in onto r.
+func setFields(r *ReplaceInput, in UpdateInput) {
+	if in.Title != nil {
+		r.Title = *in.Title
+	}
+	if in.Body != nil {
+		r.Body = *in.Body
+	}
+	if in.Done != nil {
+		r.Done = *in.Done
+	}
+	if in.Priority != nil {
+		r.Priority = *in.Priority
+	}
+	if in.Tags != nil {
+		r.Tags = in.Tags
+	}
+	if in.Pinned != nil {
+		r.Pinned = *in.Pinned
+	}
+}
+
+func field(r ReplaceInput, name string) any {
+	switch name {
+	case "title":
+		return r.Title
+	case "body":
+		return r.Body
+	case "done":
+		return r.Done
+	case "priority":
+		return r.Priority
+	case "tags":
+		return r.Tags
+	case "pinned":
+		return r.Pinned
+	}
+	return nil
+}
+
+func copyField(dst *ReplaceInput, src ReplaceInput, name string) {
+	switch name {
+	case "title":
+		dst.Title = src.Title
+	case "body":
+		dst.Body = src.Body
+	case "done":
+		dst.Done = src.Done
+	case "priority":
+		dst.Priority = src.Priority
+	case "tags":
+		dst.Tags = src.Tags
+	case "pinned":
+		dst.Pinned = src.Pinned
+	}
+}
+
+func equalField(a, b ReplaceInput, name string) bool {
+	if name == "tags" {
+		return slices.Equal(a.Tags, b.Tags)
+	}
+	return field(a, name) == field(b, name)
+}
+
+// changedFields lists the fields that differ between a and b, or every
+// field if all is set.
+func changedFields(a, b ReplaceInput, all bool) []string {
+	var out []string
+	for _, f := range syncFields {
+		if all || !equalField(a, b, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
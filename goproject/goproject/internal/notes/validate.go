@@ -0,0 +1,102 @@
+package notes
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"goproject/internal/validation"
+)
+
+// Limits enforced by Validate.
+const (
+	MaxTitleLen = 200       // runes
+	MaxBodyLen  = 64 * 1024 // bytes
+	MaxTags     = 20
+	MaxTagLen   = 50 // runes
+)
+
+// Valid reports whether p is one of the known priorities.
+func (p Priority) Valid() bool {
+	switch p {
+	case PriorityLow, PriorityMedium, PriorityHigh:
+		return true
+	}
+	return false
+}
+
+// Validate checks a CreateInput and returns a *validation.Error listing every
+// invalid field, or nil. An empty priority is allowed and defaults to medium.
+func (in CreateInput) Validate() error {
+	var v validation.Error
+	if strings.TrimSpace(in.Title) == "" {
+		v.Add("title", "is required")
+	} else {
+		validateTitle(&v, in.Title)
+	}
+	validateBody(&v, in.Body)
+	if in.Priority != "" && !in.Priority.Valid() {
+		v.Add("priority", "must be one of low, medium, high")
+	}
+	validateTags(&v, in.Tags)
+	return v.Err()
+}
+
+// Validate checks the fields present in an UpdateInput.
+func (in UpdateInput) Validate() error {
+	var v validation.Error
+	if in.Title != nil {
+		if strings.TrimSpace(*in.Title) == "" {
+			v.Add("title", "must not be empty")
+		} else {
+			validateTitle(&v, *in.Title)
+		}
+	}
+	if in.Body != nil {
+		validateBody(&v, *in.Body)
+	}
+	if in.Priority != nil && !in.Priority.Valid() {
+		v.Add("priority", "must be one of low, medium, high")
+	}
+	validateTags(&v, in.Tags)
+	return v.Err()
+}
+
+// Validate checks a ReplaceInput. The rules match CreateInput.
+func (in ReplaceInput) Validate() error {
+	return CreateInput{Title: in.Title, Body: in.Body, Priority: in.Priority, Tags: in.Tags}.Validate()
+}
+
+func validateTitle(v *validation.Error, title string) {
+	if n := utf8.RuneCountInString(title); n > MaxTitleLen {
+		v.Add("title", "must be at most %d characters, got %d", MaxTitleLen, n)
+	}
+}
+
+func validateBody(v *validation.Error, body string) {
+	if len(body) > MaxBodyLen {
+		v.Add("body", "must be at most %d bytes, got %d", MaxBodyLen, len(body))
+	}
+	if !utf8.ValidString(body) {
+		v.Add("body", "must be valid UTF-8")
+	}
+}
+
+func validateTags(v *validation.Error, tags []string) {
+	if len(tags) > MaxTags {
+		v.Add("tags", "must have at most %d entries, got %d", MaxTags, len(tags))
+	}
+	seen := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		switch {
+		case strings.TrimSpace(tag) == "":
+			v.Add(field, "must not be empty")
+		case utf8.RuneCountInString(tag) > MaxTagLen:
+			v.Add(field, "must be at most %d characters", MaxTagLen)
+		case seen[tag]:
+			v.Add(field, "duplicate tag %q", tag)
+		}
+		seen[tag] = true
+	}
+}
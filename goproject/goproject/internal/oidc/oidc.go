@@ -0,0 +1,336 @@
+// Package oidc is a relying party for OpenID Connect providers using the
+// authorization code flow with PKCE. It discovers the provider's endpoints,
+// exchanges codes for ID tokens and verifies them against the provider's
+// published RS256 keys.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery    = errors.New("oidc: discovery failed")
+	ErrExchange     = errors.New("oidc: code exchange failed")
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+)
+
+// clockSkew is tolerated when checking token times.
+const clockSkew = time.Minute
+
+// Config identifies this client to a provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for a public client, which relies on PKCE alone
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+	Client       *http.Client
+}
+
+// Provider is a discovered OpenID provider.
+type Provider struct {
+	cfg                   Config
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey // by kid
+	fetched time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover reads the provider's /.well-known/openid-configuration.
+func Discover(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	var doc discoveryDocument
+	if err := getJSON(ctx, cfg.Client, strings.TrimSuffix(cfg.Issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if doc.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer is %q, want %q", ErrDiscovery, doc.Issuer, cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	return &Provider{
+		cfg:                   cfg,
+		AuthorizationEndpoint: doc.AuthorizationEndpoint,
+		TokenEndpoint:         doc.TokenEndpoint,
+		JWKSURI:               doc.JWKSURI,
+	}, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// ─── PKCE ─────────────────────────────────────────────────────────────────────
+
+// RandomString returns n random bytes, base64url encoded: suitable for
+// state, nonce and PKCE verifiers.
+func RandomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// S256Challenge derives the PKCE code challenge for verifier (RFC 7636).
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ─── flow ─────────────────────────────────────────────────────────────────────
+
+// AuthCodeURL is where to send the user to log in. state and nonce come
+// back in the redirect and the ID token; verifier is kept until Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	scopes := append([]string{"openid"}, slices.DeleteFunc(slices.Clone(p.cfg.Scopes), func(s string) bool { return s == "openid" })...)
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {S256Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange trades an authorization code for the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDToken, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s %s", ErrExchange, resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+// ─── ID tokens ────────────────────────────────────────────────────────────────
+
+// IDToken holds the claims of a verified ID token that callers use.
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Expiry            time.Time
+}
+
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience is a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// Verify checks an ID token's signature, issuer, audience, lifetime and
+// nonce (OpenID Connect Core §3.1.3.7).
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	invalid := func(format string, args ...any) (*IDToken, error) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+	}
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return invalid("malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return invalid("header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return invalid("unsupported alg %q", header.Alg)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return invalid("signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return invalid("bad signature")
+	}
+
+	var c idTokenClaims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return invalid("claims: %v", err)
+	}
+	now := time.Now()
+	switch {
+	case c.Issuer != p.cfg.Issuer:
+		return invalid("issuer %q", c.Issuer)
+	case c.Subject == "":
+		return invalid("no subject")
+	case !slices.Contains(c.Audience, p.cfg.ClientID):
+		return invalid("not issued for this client")
+	case len(c.Audience) > 1 && c.AuthorizedParty != p.cfg.ClientID:
+		return invalid("authorized party %q", c.AuthorizedParty)
+	case now.After(time.Unix(c.Expiry, 0).Add(clockSkew)):
+		return invalid("expired")
+	case time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)):
+		return invalid("issued in the future")
+	case c.Nonce != nonce:
+		return invalid("nonce mismatch")
+	}
+	return &IDToken{
+		Issuer:            c.Issuer,
+		Subject:           c.Subject,
+		Email:             c.Email,
+		EmailVerified:     c.EmailVerified,
+		Name:              c.Name,
+		PreferredUsername: c.PreferredUsername,
+		Expiry:            time.Unix(c.Expiry, 0),
+	}, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the signing key kid, fetching the key set again if it is
+// not known, since providers rotate keys. Refetches are at most a minute
+// apart, so made-up kids cannot hammer the provider.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.fetched) < time.Minute {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, p.cfg.Client, p.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("%w: fetching keys: %v", ErrInvalidToken, err)
+	}
+	p.keys = make(map[string]*rsa.PublicKey)
+	p.fetched = time.Now()
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
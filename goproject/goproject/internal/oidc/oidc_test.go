@@ -0,0 +1,114 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"goproject/internal/oidc"
+	"goproject/internal/oidc/oidctest"
+)
+
+var noRedirects = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+func setup(t *testing.T, secret string) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	mock := oidctest.NewProvider("notes", secret)
+	t.Cleanup(mock.Close)
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer: mock.URL, ClientID: "notes", ClientSecret: secret,
+		RedirectURL: "https://notes.example.com/callback", Scopes: []string{"email", "profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, p
+}
+
+// authorize follows the login redirect and returns the code and state the
+// provider sends back.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	resp, err := noRedirects.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("authorize: %s %v", resp.Status, err)
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	for _, secret := range []string{"", "s3cret"} {
+		mock, p := setup(t, secret)
+		mock.SetUser(oidctest.User{Subject: "abc", Email: "ann@example.com", PreferredUsername: "ann"})
+
+		verifier, nonce := oidc.RandomString(32), oidc.RandomString(16)
+		code, state := authorize(t, p.AuthCodeURL("st", nonce, verifier))
+		if state != "st" {
+			t.Errorf("state = %q", state)
+		}
+		if _, err := p.Exchange(context.Background(), code, "wrong-verifier", nonce); !errors.Is(err, oidc.ErrExchange) {
+			t.Errorf("wrong verifier: %v", err)
+		}
+
+		code, _ = authorize(t, p.AuthCodeURL("st", nonce, verifier))
+		tok, err := p.Exchange(context.Background(), code, verifier, nonce)
+		if err != nil {
+			t.Fatalf("exchange (secret %q): %v", secret, err)
+		}
+		if tok.Subject != "abc" || tok.Issuer != mock.URL || tok.Email != "ann@example.com" || !tok.EmailVerified {
+			t.Errorf("ID token = %+v", tok)
+		}
+		if _, err := p.Exchange(context.Background(), code, verifier, nonce); !errors.Is(err, oidc.ErrExchange) {
+			t.Errorf("reused code: %v", err)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	mock, p := setup(t, "")
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{"iss": mock.URL, "sub": "abc", "aud": "notes", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(), "nonce": "n"}
+	}
+	if _, err := p.Verify(context.Background(), mock.Sign(valid()), "n"); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+
+	for name, change := range map[string]func(map[string]any){
+		"issuer":     func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"audience":   func(c map[string]any) { c["aud"] = "someone-else" },
+		"azp":        func(c map[string]any) { c["aud"] = []string{"notes", "other"} },
+		"expired":    func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"future":     func(c map[string]any) { c["iat"] = now.Add(time.Hour).Unix() },
+		"nonce":      func(c map[string]any) { c["nonce"] = "replayed" },
+		"no subject": func(c map[string]any) { delete(c, "sub") },
+	} {
+		claims := valid()
+		change(claims)
+		if _, err := p.Verify(context.Background(), mock.Sign(claims), "n"); !errors.Is(err, oidc.ErrInvalidToken) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	tampered := mock.Sign(valid())
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	if _, err := p.Verify(context.Background(), tampered, "n"); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("bad signature: %v", err)
+	}
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	mock := oidctest.NewProvider("notes", "")
+	defer mock.Close()
+	if _, err := oidc.Discover(context.Background(), oidc.Config{Issuer: mock.URL + "/"}); !errors.Is(err, oidc.ErrDiscovery) {
+		t.Errorf("mismatched issuer: %v", err)
+	}
+}
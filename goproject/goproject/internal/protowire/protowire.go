@@ -0,0 +1,208 @@
+// Package protowire encodes and decodes the Protocol Buffers binary wire
+// format. It works on fields rather than messages: callers append the
+// fields of a message in order and walk them back with Unmarshal, so each
+// message type carries its own small marshal and unmarshal methods.
+//
+// Proto3 defaults are the caller's business: Append* always write, and the
+// helpers that skip zero values are named accordingly.
+package protowire
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Type is a wire type.
+type Type int
+
+const (
+	VarintType  Type = 0
+	Fixed64Type Type = 1
+	BytesType   Type = 2
+	Fixed32Type Type = 5
+)
+
+var (
+	ErrTruncated = errors.New("protowire: truncated message")
+	ErrOverflow  = errors.New("protowire: varint overflows 64 bits")
+	ErrWireType  = errors.New("protowire: unsupported wire type")
+	ErrFieldNum  = errors.New("protowire: invalid field number")
+)
+
+// ─── encoding ───────────────────────────────────────────────────────────────
+
+func AppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func AppendTag(b []byte, num int, t Type) []byte {
+	return AppendVarint(b, uint64(num)<<3|uint64(t))
+}
+
+// AppendBytes writes a length-delimited field: bytes, a string or an
+// encoded message.
+func AppendBytes(b []byte, num int, v []byte) []byte {
+	b = AppendTag(b, num, BytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func AppendString(b []byte, num int, v string) []byte {
+	b = AppendTag(b, num, BytesType)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func AppendUint(b []byte, num int, v uint64) []byte {
+	return AppendVarint(AppendTag(b, num, VarintType), v)
+}
+
+// AppendInt writes an int32, int64 or enum field.
+func AppendInt(b []byte, num int, v int64) []byte {
+	return AppendUint(b, num, uint64(v))
+}
+
+func AppendBool(b []byte, num int, v bool) []byte {
+	var x uint64
+	if v {
+		x = 1
+	}
+	return AppendUint(b, num, x)
+}
+
+// AppendStringIf, AppendIntIf and AppendBoolIf skip the proto3 default.
+func AppendStringIf(b []byte, num int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return AppendString(b, num, v)
+}
+
+func AppendIntIf(b []byte, num int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	return AppendInt(b, num, v)
+}
+
+func AppendBoolIf(b []byte, num int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return AppendBool(b, num, v)
+}
+
+// AppendTimestamp writes a google.protobuf.Timestamp, or nothing for the
+// zero time.
+func AppendTimestamp(b []byte, num int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = AppendIntIf(ts, 1, t.Unix())
+	ts = AppendIntIf(ts, 2, int64(t.Nanosecond()))
+	return AppendBytes(b, num, ts)
+}
+
+// ─── decoding ───────────────────────────────────────────────────────────────
+
+// Value is one decoded field. Varint holds varint and fixed values; Bytes
+// aliases the input for length-delimited ones.
+type Value struct {
+	Type   Type
+	Varint uint64
+	Bytes  []byte
+}
+
+func (v Value) Int() int64      { return int64(v.Varint) }
+func (v Value) Bool() bool      { return v.Varint != 0 }
+func (v Value) String() string  { return string(v.Bytes) }
+func (v Value) Float() float64  { return math.Float64frombits(v.Varint) }
+func (v Value) Uint() uint64    { return v.Varint }
+func (v Value) Message() []byte { return v.Bytes }
+
+func consumeVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b); i++ {
+		if i == 10 {
+			return 0, 0, ErrOverflow
+		}
+		v |= uint64(b[i]&0x7F) << (7 * i)
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, ErrTruncated
+}
+
+// Unmarshal calls fn for each field of the encoded message b, in order.
+// It stops at the first error from fn.
+func Unmarshal(b []byte, fn func(num int, v Value) error) error {
+	for len(b) > 0 {
+		key, n, err := consumeVarint(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		num, t := key>>3, Type(key&7)
+		if num == 0 || num > math.MaxInt32 {
+			return ErrFieldNum
+		}
+
+		v := Value{Type: t}
+		switch t {
+		case VarintType:
+			if v.Varint, n, err = consumeVarint(b); err != nil {
+				return err
+			}
+		case Fixed64Type, Fixed32Type:
+			n = 8
+			if t == Fixed32Type {
+				n = 4
+			}
+			if len(b) < n {
+				return ErrTruncated
+			}
+			for i := n - 1; i >= 0; i-- {
+				v.Varint = v.Varint<<8 | uint64(b[i])
+			}
+		case BytesType:
+			size, m, err := consumeVarint(b)
+			if err != nil {
+				return err
+			}
+			if size > uint64(len(b)-m) {
+				return ErrTruncated
+			}
+			v.Bytes = b[m : m+int(size)]
+			n = m + int(size)
+		default:
+			return ErrWireType
+		}
+		b = b[n:]
+		if err := fn(int(num), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Timestamp decodes a google.protobuf.Timestamp.
+func Timestamp(b []byte) (time.Time, error) {
+	var sec, nsec int64
+	err := Unmarshal(b, func(num int, v Value) error {
+		switch num {
+		case 1:
+			sec = v.Int()
+		case 2:
+			nsec = v.Int()
+		}
+		return nil
+	})
+	return time.Unix(sec, nsec).UTC(), err
+}
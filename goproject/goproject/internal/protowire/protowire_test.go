@@ -0,0 +1,81 @@
+package protowire_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"goproject/internal/protowire"
+)
+
+func TestAppendVarint(t *testing.T) {
+	// The example from the encoding guide: 150 is 96 01.
+	if got := protowire.AppendVarint(nil, 150); !bytes.Equal(got, []byte{0x96, 0x01}) {
+		t.Errorf("AppendVarint(150) = % x", got)
+	}
+	if got := protowire.AppendString(nil, 2, "testing"); !bytes.Equal(got, append([]byte{0x12, 0x07}, "testing"...)) {
+		t.Errorf("AppendString = % x", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	var b []byte
+	b = protowire.AppendString(b, 1, "hello")
+	b = protowire.AppendInt(b, 2, -1)
+	b = protowire.AppendBool(b, 3, true)
+	b = protowire.AppendStringIf(b, 4, "") // skipped
+	b = protowire.AppendTimestamp(b, 5, ts)
+	b = protowire.AppendString(b, 1, "again")
+
+	var got []int
+	err := protowire.Unmarshal(b, func(num int, v protowire.Value) error {
+		got = append(got, num)
+		switch num {
+		case 1:
+			if s := v.String(); s != "hello" && s != "again" {
+				t.Errorf("field 1 = %q", s)
+			}
+		case 2:
+			if v.Int() != -1 {
+				t.Errorf("field 2 = %d", v.Int())
+			}
+		case 3:
+			if !v.Bool() {
+				t.Error("field 3 = false")
+			}
+		case 5:
+			at, err := protowire.Timestamp(v.Message())
+			if err != nil || !at.Equal(ts) {
+				t.Errorf("field 5 = %v, %v", at, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 || got[3] != 5 {
+		t.Errorf("fields = %v, want [1 2 3 5 1]", got)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	nop := func(int, protowire.Value) error { return nil }
+	tests := []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{"truncated varint", []byte{0x08, 0x96}, protowire.ErrTruncated},
+		{"truncated bytes", []byte{0x0a, 0x05, 'a'}, protowire.ErrTruncated},
+		{"field zero", []byte{0x00, 0x01}, protowire.ErrFieldNum},
+		{"group", []byte{0x0b}, protowire.ErrWireType},
+		{"overflow", append([]byte{0x08}, bytes.Repeat([]byte{0xff}, 11)...), protowire.ErrOverflow},
+	}
+	for _, tt := range tests {
+		if err := protowire.Unmarshal(tt.in, nop); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package ratelimit provides keyed token-bucket rate limiting and
+// progressive lockout after repeated failures.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter keeps one token bucket per key. Each bucket holds up to Burst
+// tokens and refills at Rate tokens per second.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter allows burst requests at once and then n requests per period
+// for every key.
+func NewLimiter(n int, per time.Duration, burst int) *Limiter {
+	return &Limiter{
+		rate:    float64(n) / per.Seconds(),
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%1024 == 0 {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// prune drops buckets that have refilled completely, since a fresh bucket
+// behaves identically. Callers must hold l.mu.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Backoff locks a key out after Threshold consecutive failures. Each further
+// failure doubles the lockout, starting at Base and capped at Max. Failures
+// older than Max are forgotten.
+type Backoff struct {
+	mu        sync.Mutex
+	threshold int
+	base, max time.Duration
+	entries   map[string]*failures
+	calls     int
+	now       func() time.Time
+}
+
+type failures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func NewBackoff(threshold int, base, max time.Duration) *Backoff {
+	return &Backoff{
+		threshold: threshold,
+		base:      base,
+		max:       max,
+		entries:   make(map[string]*failures),
+		now:       time.Now,
+	}
+}
+
+// Locked reports whether key is currently locked out and for how long.
+func (b *Backoff) Locked(key string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, ok := b.entries[key]
+	if !ok {
+		return false, 0
+	}
+	if wait := f.lockedUntil.Sub(b.now()); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+// Fail records a failure for key and returns the lockout it triggered, if
+// any.
+func (b *Backoff) Fail(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.calls++
+	if b.calls%1024 == 0 {
+		for k, e := range b.entries {
+			if now.Sub(e.last) > b.max {
+				delete(b.entries, k)
+			}
+		}
+	}
+
+	f, ok := b.entries[key]
+	if !ok || now.Sub(f.last) > b.max {
+		f = &failures{}
+		b.entries[key] = f
+	}
+	f.count++
+	f.last = now
+	if f.count < b.threshold {
+		return 0
+	}
+
+	lock := b.base << (f.count - b.threshold)
+	if lock > b.max || lock <= 0 {
+		lock = b.max
+	}
+	f.lockedUntil = now.Add(lock)
+	return lock
+}
+
+// Reset forgets the failures recorded for key.
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
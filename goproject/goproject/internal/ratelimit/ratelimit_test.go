@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := NewLimiter(1, time.Second, 3)
+	l.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("ip"); !ok {
+			t.Fatalf("request %d should be allowed by burst", i)
+		}
+	}
+	ok, wait := l.Allow("ip")
+	if ok {
+		t.Fatal("fourth request should be limited")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("unexpected retry after %v", wait)
+	}
+
+	// other keys have their own bucket
+	if ok, _ := l.Allow("other"); !ok {
+		t.Error("other key should not be limited")
+	}
+
+	clock.advance(time.Second)
+	if ok, _ := l.Allow("ip"); !ok {
+		t.Error("bucket should have refilled one token")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := NewBackoff(3, time.Second, 10*time.Second)
+	b.now = clock.now
+
+	if lock := b.Fail("alice"); lock != 0 {
+		t.Errorf("first failure should not lock, got %v", lock)
+	}
+	b.Fail("alice")
+	if lock := b.Fail("alice"); lock != time.Second {
+		t.Errorf("third failure should lock for 1s, got %v", lock)
+	}
+	if locked, wait := b.Locked("alice"); !locked || wait != time.Second {
+		t.Errorf("expected 1s lock, got %v %v", locked, wait)
+	}
+
+	clock.advance(time.Second)
+	if locked, _ := b.Locked("alice"); locked {
+		t.Error("lock should have expired")
+	}
+	if lock := b.Fail("alice"); lock != 2*time.Second {
+		t.Errorf("lock should double, got %v", lock)
+	}
+	for i := 0; i < 5; i++ {
+		b.Fail("alice")
+	}
+	if _, wait := b.Locked("alice"); wait != 10*time.Second {
+		t.Errorf("lock should be capped at max, got %v", wait)
+	}
+
+	b.Reset("alice")
+	if locked, _ := b.Locked("alice"); locked {
+		t.Error("reset should clear the lock")
+	}
+}
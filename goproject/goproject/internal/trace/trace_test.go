@@ -0,0 +1,130 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"goproject/internal/trace"
+)
+
+func TestTraceparent(t *testing.T) {
+	const h = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := trace.ParseTraceparent(h)
+	if !ok || !sc.Sampled {
+		t.Fatalf("ParseTraceparent(%q) = %+v, %v", h, sc, ok)
+	}
+	if got := sc.Traceparent(); got != h {
+		t.Errorf("round trip = %q", got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, ok := trace.ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent(%q) accepted", bad)
+		}
+	}
+}
+
+type memExporter struct {
+	mu      sync.Mutex
+	batches [][]byte
+}
+
+func (m *memExporter) Export(_ context.Context, b []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, b)
+	return nil
+}
+
+type otlp struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string `json:"traceId"`
+				SpanID       string `json:"spanId"`
+				ParentSpanID string `json:"parentSpanId"`
+				Name         string `json:"name"`
+				Status       struct {
+					Code int `json:"code"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func TestSpansExportAsOTLP(t *testing.T) {
+	exp := &memExporter{}
+	tr := trace.NewTracer("test", 1, exp)
+
+	remote, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := trace.ContextWithRemoteParent(context.Background(), remote)
+	ctx, root := tr.Start(ctx, "root", trace.KindServer)
+	_, child := tr.Start(ctx, "child", trace.KindInternal)
+	child.SetAttr("n", 3)
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+	root.End()
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exp.batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(exp.batches))
+	}
+	var req otlp
+	if err := json.Unmarshal(exp.batches[0], &req); err != nil {
+		t.Fatal(err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if r.TraceID != remote.TraceID.String() || r.ParentSpanID != remote.SpanID.String() {
+		t.Errorf("root did not continue remote trace: %+v", r)
+	}
+	if c.TraceID != r.TraceID || c.ParentSpanID != r.SpanID {
+		t.Errorf("child not parented to root: %+v", c)
+	}
+	if c.Status.Code != 2 || r.Status.Code != 0 {
+		t.Errorf("status codes = %d, %d", c.Status.Code, r.Status.Code)
+	}
+}
+
+func TestUnsampledSpansPropagateButAreNotExported(t *testing.T) {
+	var buf bytes.Buffer
+	tr := trace.NewTracer("test", 0, trace.NewWriterExporter(&buf))
+	_, span := tr.Start(context.Background(), "x", trace.KindServer)
+	span.End()
+	tr.Shutdown(context.Background())
+
+	if !span.SpanContext().IsValid() {
+		t.Error("unsampled span has no trace context")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unsampled span exported: %s", buf.String())
+	}
+}
+
+func TestNilTracerIsNoop(t *testing.T) {
+	var tr *trace.Tracer
+	ctx, span := tr.Start(context.Background(), "x", trace.KindInternal)
+	span.SetAttr("k", "v")
+	span.End()
+	if trace.SpanFromContext(ctx) != nil {
+		t.Error("nil tracer stored a span")
+	}
+}
@@ -0,0 +1,46 @@
+// Package validation describes invalid input field by field, so that every
+// API reports it in the same shape whatever the input was for.
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes a problem with a single input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is returned when an input has one or more invalid fields.
+type Error struct {
+	Fields []FieldError
+}
+
+// Field returns an Error for a single invalid field.
+func Field(field, message string) *Error {
+	return &Error{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+// Add records a problem with field.
+func (e *Error) Add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns e, or nil if no field was added, so that a validator can
+// collect problems in an Error and return the result directly.
+func (e *Error) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,28 @@
+package validation_test
+
+import (
+	"errors"
+	"testing"
+
+	"goproject/internal/validation"
+)
+
+func TestError(t *testing.T) {
+	var v validation.Error
+	if v.Err() != nil {
+		t.Fatal("empty Error is not nil")
+	}
+	v.Add("title", "is required")
+	v.Add("tags[1]", "duplicate tag %q", "x")
+	err := v.Err()
+	var verr *validation.Error
+	if !errors.As(err, &verr) || len(verr.Fields) != 2 {
+		t.Fatalf("Err() = %v", err)
+	}
+	if want := `invalid input: title: is required; tags[1]: duplicate tag "x"`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if f := validation.Field("code", "is required").Fields; len(f) != 1 || f[0].Field != "code" {
+		t.Errorf("Field = %v", f)
+	}
+}
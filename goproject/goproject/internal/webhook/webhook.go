@@ -0,0 +1,561 @@
+// Package webhook delivers events to HTTP endpoints registered by users.
+// Every delivery is signed with the webhook's secret, retried with
+// exponential backoff and kept in a per-webhook log from which it can be
+// replayed. A webhook whose deliveries keep failing is disabled. A fixed
+// pool of workers sends the deliveries, and a bounded queue holds those
+// waiting to be sent or retried.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("webhook: not found")
+	ErrInvalidURL   = errors.New("webhook: URL must be an absolute http or https URL")
+	ErrInvalidEvent = errors.New("webhook: unknown event")
+	ErrNoEvents     = errors.New("webhook: at least one event is required")
+	ErrLimit        = errors.New("webhook: too many webhooks")
+	ErrDisabled     = errors.New("webhook: disabled")
+	ErrClosed       = errors.New("webhook: dispatcher closed")
+	ErrQueueFull    = errors.New("webhook: delivery queue full")
+)
+
+// Request headers sent with every delivery.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Delivery states.
+const (
+	StatePending   = "pending"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// Config tunes a Dispatcher.
+type Config struct {
+	Client       *http.Client  // nil means NewClient(10*time.Second, false)
+	Events       []string      // event types that webhooks may subscribe to
+	MaxAttempts  int           // per delivery, including the first
+	Backoff      time.Duration // wait before the first retry; doubles after each
+	MaxBackoff   time.Duration // cap on the wait between retries
+	DisableAfter int           // consecutive failed deliveries that disable a webhook
+	MaxPerUser   int           // webhooks per user, 0 for no limit
+	LogSize      int           // deliveries kept per webhook
+	Workers      int           // requests sent at once, 0 for 4
+	QueueSize    int           // deliveries waiting to be sent or retried, 0 for 1000
+}
+
+// Webhook is a registered endpoint.
+type Webhook struct {
+	ID             string
+	UserID         string
+	URL            string
+	Events         []string
+	Secret         string
+	Active         bool
+	DisabledReason string
+	Failures       int // consecutive failed deliveries
+	CreatedAt      time.Time
+}
+
+// Attempt is one HTTP request of a delivery.
+type Attempt struct {
+	At         time.Time
+	StatusCode int // 0 if no response was received
+	Error      string
+	Duration   time.Duration
+}
+
+// Delivery is one event sent to one webhook.
+type Delivery struct {
+	ID          string
+	WebhookID   string
+	Event       string
+	Payload     []byte
+	State       string
+	Attempts    []Attempt
+	NextAttempt time.Time // zero unless a retry is scheduled
+	Redelivery  string    // ID of the delivery this one replays
+	CreatedAt   time.Time
+}
+
+// Dispatcher stores webhooks and delivers events to them in the background.
+type Dispatcher struct {
+	cfg Config
+
+	mu      sync.Mutex
+	hooks   map[string]*Webhook
+	log     map[string][]*Delivery // by webhook ID, oldest first
+	pending int                    // deliveries queued or waiting for a retry
+	closed  bool
+
+	// queue holds deliveries ready to be sent. It has room for QueueSize,
+	// and pending never exceeds that, so sending to it never blocks.
+	queue chan job
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// job is a delivery and the number of attempts already made.
+type job struct {
+	h     *Webhook
+	dl    *Delivery
+	tries int
+}
+
+// NewDispatcher starts the workers; Close stops them.
+func NewDispatcher(cfg Config) *Dispatcher {
+	if cfg.Client == nil {
+		cfg.Client = NewClient(10*time.Second, false)
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	d := &Dispatcher{
+		cfg:   cfg,
+		hooks: make(map[string]*Webhook),
+		log:   make(map[string][]*Delivery),
+		queue: make(chan job, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	d.wg.Add(cfg.Workers)
+	for range cfg.Workers {
+		go d.work()
+	}
+	return d
+}
+
+func newID(prefix string, n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (d *Dispatcher) check(rawURL string, events []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if len(events) == 0 {
+		return ErrNoEvents
+	}
+	for _, e := range events {
+		if !slices.Contains(d.cfg.Events, e) {
+			return fmt.Errorf("%w %q", ErrInvalidEvent, e)
+		}
+	}
+	return nil
+}
+
+// owned returns the user's webhook. Callers must hold d.mu.
+func (d *Dispatcher) owned(userID, id string) (*Webhook, error) {
+	h, ok := d.hooks[id]
+	if !ok || h.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return h, nil
+}
+
+func (h *Webhook) copy() Webhook {
+	c := *h
+	c.Events = slices.Clone(h.Events)
+	return c
+}
+
+// Create registers a webhook with a new secret, which signs every delivery.
+// The secret is in the returned Webhook, as in those returned by List, Get
+// and RotateSecret.
+func (d *Dispatcher) Create(userID, rawURL string, events []string) (Webhook, error) {
+	if err := d.check(rawURL, events); err != nil {
+		return Webhook{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cfg.MaxPerUser > 0 {
+		n := 0
+		for _, h := range d.hooks {
+			if h.UserID == userID {
+				n++
+			}
+		}
+		if n >= d.cfg.MaxPerUser {
+			return Webhook{}, ErrLimit
+		}
+	}
+	h := &Webhook{
+		ID:        newID("wh_", 8),
+		UserID:    userID,
+		URL:       rawURL,
+		Events:    slices.Clone(events),
+		Secret:    newID("whsec_", 24),
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	d.hooks[h.ID] = h
+	return h.copy(), nil
+}
+
+// List returns the user's webhooks, oldest first.
+func (d *Dispatcher) List(userID string) []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []Webhook
+	for _, h := range d.hooks {
+		if h.UserID == userID {
+			out = append(out, h.copy())
+		}
+	}
+	slices.SortFunc(out, func(a, b Webhook) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out
+}
+
+func (d *Dispatcher) Get(userID, id string) (Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, err := d.owned(userID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return h.copy(), nil
+}
+
+// Update changes a webhook's URL, events and whether it is active.
+// Activating a disabled webhook clears its failure count.
+func (d *Dispatcher) Update(userID, id, rawURL string, events []string, active bool) (Webhook, error) {
+	if err := d.check(rawURL, events); err != nil {
+		return Webhook{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, err := d.owned(userID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	h.URL = rawURL
+	h.Events = slices.Clone(events)
+	if active && !h.Active {
+		h.Failures = 0
+		h.DisabledReason = ""
+	}
+	if !active && h.Active {
+		h.DisabledReason = "disabled by user"
+	}
+	h.Active = active
+	return h.copy(), nil
+}
+
+// RotateSecret replaces a webhook's secret. Attempts from then on, including
+// retries of earlier deliveries, are signed with the new one.
+func (d *Dispatcher) RotateSecret(userID, id string) (Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, err := d.owned(userID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	h.Secret = newID("whsec_", 24)
+	return h.copy(), nil
+}
+
+// Delete removes a webhook and its delivery log. Retries still scheduled
+// for it are abandoned.
+func (d *Dispatcher) Delete(userID, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.owned(userID, id); err != nil {
+		return err
+	}
+	delete(d.hooks, id)
+	delete(d.log, id)
+	return nil
+}
+
+// Deliveries returns the logged deliveries of a webhook, newest first.
+func (d *Dispatcher) Deliveries(userID, id string) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.owned(userID, id); err != nil {
+		return nil, err
+	}
+	log := d.log[id]
+	out := make([]Delivery, len(log))
+	for i, dl := range log {
+		out[len(log)-1-i] = dl.copy()
+	}
+	return out, nil
+}
+
+func (dl *Delivery) copy() Delivery {
+	c := *dl
+	c.Attempts = slices.Clone(dl.Attempts)
+	return c
+}
+
+// Publish sends an event to each of the user's active webhooks that
+// subscribes to it. The payload is a JSON object with the event's id, type,
+// creation time and data. Publish does not block on delivery.
+func (d *Dispatcher) Publish(userID, event string, data any) {
+	body, err := json.Marshal(struct {
+		ID        string    `json:"id"`
+		Type      string    `json:"type"`
+		CreatedAt time.Time `json:"created_at"`
+		Data      any       `json:"data"`
+	}{newID("evt_", 8), event, time.Now().UTC(), data})
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	for _, h := range d.hooks {
+		if h.UserID == userID && h.Active && slices.Contains(h.Events, event) {
+			d.enqueue(h, event, body, "")
+		}
+	}
+}
+
+// Redeliver sends the payload of a logged delivery again, as a new
+// delivery. It returns ErrQueueFull rather than log a delivery that cannot
+// be sent.
+func (d *Dispatcher) Redeliver(userID, id, deliveryID string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, err := d.owned(userID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	i := slices.IndexFunc(d.log[id], func(dl *Delivery) bool { return dl.ID == deliveryID })
+	switch {
+	case i < 0:
+		return Delivery{}, ErrNotFound
+	case !h.Active:
+		return Delivery{}, ErrDisabled
+	case d.closed:
+		return Delivery{}, ErrClosed
+	case d.pending >= d.cfg.QueueSize:
+		return Delivery{}, ErrQueueFull
+	}
+	orig := d.log[id][i]
+	return d.enqueue(h, orig.Event, orig.Payload, orig.ID).copy(), nil
+}
+
+// enqueue logs a delivery and queues it for sending. If the queue is full
+// the delivery fails at once, without counting towards disabling the
+// webhook. Callers must hold d.mu.
+func (d *Dispatcher) enqueue(h *Webhook, event string, payload []byte, replays string) *Delivery {
+	dl := &Delivery{
+		ID:         newID("dlv_", 8),
+		WebhookID:  h.ID,
+		Event:      event,
+		Payload:    payload,
+		State:      StatePending,
+		Redelivery: replays,
+		CreatedAt:  time.Now(),
+	}
+	log := append(d.log[h.ID], dl)
+	if d.cfg.LogSize > 0 && len(log) > d.cfg.LogSize {
+		log = slices.Delete(log, 0, len(log)-d.cfg.LogSize)
+	}
+	d.log[h.ID] = log
+
+	if d.pending >= d.cfg.QueueSize {
+		dl.State = StateFailed
+		dl.Attempts = []Attempt{{At: time.Now(), Error: ErrQueueFull.Error()}}
+		return dl
+	}
+	d.pending++
+	d.queue <- job{h: h, dl: dl}
+	return dl
+}
+
+// Err returns ErrClosed once the dispatcher is closed, and nil before.
+func (d *Dispatcher) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close stops the workers and waits for requests in flight to finish, or
+// for ctx to be done. Deliveries that were queued or waiting for a retry
+// stay pending.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.done)
+	}
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ─── delivery ───────────────────────────────────────────────────────────────
+
+// backoff returns the wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(failed int) time.Duration {
+	wait := d.cfg.Backoff
+	for i := 1; i < failed && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.MaxBackoff)
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case j := <-d.queue:
+			d.attempt(j)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// attempt sends a queued delivery once, then finishes it or schedules the
+// next try. A waiting retry holds a timer and its queue slot, not a worker.
+func (d *Dispatcher) attempt(j job) {
+	h, dl := j.h, j.dl
+	d.mu.Lock()
+	current := d.hooks[h.ID] == h && h.Active
+	target, secret := h.URL, h.Secret
+	d.mu.Unlock()
+	if !current {
+		d.finish(h, dl, false, false)
+		return
+	}
+
+	a, gone := d.send(target, secret, dl)
+	d.mu.Lock()
+	dl.Attempts = append(dl.Attempts, a)
+	dl.NextAttempt = time.Time{}
+	d.mu.Unlock()
+
+	j.tries++
+	ok := a.Error == ""
+	if ok || gone || j.tries >= d.cfg.MaxAttempts {
+		if gone {
+			d.disable(h, "endpoint returned 410 Gone")
+		}
+		d.finish(h, dl, ok, true)
+		return
+	}
+
+	wait := d.backoff(j.tries)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dl.NextAttempt = time.Now().Add(wait)
+	time.AfterFunc(wait, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if !d.closed {
+			d.queue <- j
+		}
+	})
+}
+
+// send makes one attempt. gone reports a 410 response, which means the
+// receiver wants no more deliveries.
+func (d *Dispatcher) send(target, secret string, dl *Delivery) (a Attempt, gone bool) {
+	a.At = time.Now()
+	defer func() { a.Duration = time.Since(a.At) }()
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(dl.Payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notes-webhooks/1")
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	req.Header.Set(SignatureHeader, Sign(secret, a.At.Unix(), dl.Payload))
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		a.Error = err.Error()
+		return a, false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = "unexpected status " + resp.Status
+	}
+	return a, resp.StatusCode == http.StatusGone
+}
+
+// finish records the outcome of a delivery and frees its queue slot. Only
+// deliveries that were actually attempted count towards disabling the
+// webhook.
+func (d *Dispatcher) finish(h *Webhook, dl *Delivery, ok, counted bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending--
+	if ok {
+		dl.State = StateSucceeded
+		h.Failures = 0
+		return
+	}
+	dl.State = StateFailed
+	if !counted {
+		return
+	}
+	h.Failures++
+	if d.cfg.DisableAfter > 0 && h.Failures >= d.cfg.DisableAfter && h.Active {
+		h.Active = false
+		h.DisabledReason = fmt.Sprintf("%d consecutive deliveries failed", h.Failures)
+	}
+}
+
+func (d *Dispatcher) disable(h *Webhook, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h.Active = false
+	h.DisabledReason = reason
+}
@@ -0,0 +1,246 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"goproject/internal/webhook"
+)
+
+// receiver records requests and answers with the next queued status, or
+// 200 once the queue is empty.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	got      chan *http.Request
+	bodies   chan []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses, got: make(chan *http.Request, 100), bodies: make(chan []byte, 100)}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		status := http.StatusOK
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+		}
+		rc.mu.Unlock()
+		rc.got <- r
+		rc.bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) next(t *testing.T) (*http.Request, []byte) {
+	t.Helper()
+	select {
+	case r := <-rc.got:
+		return r, <-rc.bodies
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+		return nil, nil
+	}
+}
+
+func newDispatcher(t *testing.T) *webhook.Dispatcher {
+	d := webhook.NewDispatcher(webhook.Config{
+		Client:       webhook.NewClient(time.Second, true),
+		Events:       []string{"note.created", "note.deleted"},
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+		DisableAfter: 2,
+		LogSize:      10,
+	})
+	t.Cleanup(func() { d.Close(context.Background()) })
+	return d
+}
+
+// wait polls until the webhook's newest delivery is no longer pending.
+func wait(t *testing.T, d *webhook.Dispatcher, userID, id string) webhook.Delivery {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		log, _ := d.Deliveries(userID, id)
+		if len(log) > 0 && log[0].State != webhook.StatePending {
+			return log[0]
+		}
+	}
+	t.Fatal("delivery still pending")
+	return webhook.Delivery{}
+}
+
+func TestSignedDelivery(t *testing.T) {
+	rc := newReceiver(t)
+	d := newDispatcher(t)
+	h, err := d.Create("u1", rc.URL, []string{"note.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Publish("u1", "note.deleted", nil) // not subscribed
+	d.Publish("u2", "note.created", nil) // another user
+	d.Publish("u1", "note.created", map[string]string{"title": "a"})
+
+	r, body := rc.next(t)
+	if r.Header.Get(webhook.EventHeader) != "note.created" || !strings.Contains(string(body), `"title":"a"`) {
+		t.Errorf("delivery = %v %s", r.Header, body)
+	}
+	if err := webhook.Verify(h.Secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+		t.Errorf("signature: %v", err)
+	}
+	if err := webhook.Verify("wrong", r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != webhook.ErrSignature {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if dl := wait(t, d, "u1", h.ID); dl.State != webhook.StateSucceeded || r.Header.Get(webhook.DeliveryHeader) != dl.ID {
+		t.Errorf("logged delivery = %+v", dl)
+	}
+}
+
+func TestRetryDisableAndRedeliver(t *testing.T) {
+	rc := newReceiver(t, 500, 502)
+	d := newDispatcher(t)
+	h, _ := d.Create("u1", rc.URL, []string{"note.created"})
+
+	d.Publish("u1", "note.created", nil)
+	dl := wait(t, d, "u1", h.ID)
+	if dl.State != webhook.StateSucceeded || len(dl.Attempts) != 3 || dl.Attempts[0].StatusCode != 500 {
+		t.Fatalf("retried delivery = %+v", dl)
+	}
+
+	rc.mu.Lock()
+	rc.statuses = []int{500, 500, 500, 500, 500, 500}
+	rc.mu.Unlock()
+	d.Publish("u1", "note.created", nil)
+	wait(t, d, "u1", h.ID)
+	d.Publish("u1", "note.created", nil)
+	failed := wait(t, d, "u1", h.ID)
+	if failed.State != webhook.StateFailed {
+		t.Fatalf("delivery = %+v", failed)
+	}
+	if h, _ = d.Get("u1", h.ID); h.Active || h.Failures != 2 {
+		t.Fatalf("webhook after repeated failures = %+v", h)
+	}
+	if _, err := d.Redeliver("u1", h.ID, failed.ID); err != webhook.ErrDisabled {
+		t.Errorf("redeliver to disabled webhook: %v", err)
+	}
+
+	h, _ = d.Update("u1", h.ID, h.URL, h.Events, true)
+	again, err := d.Redeliver("u1", h.ID, failed.ID)
+	if err != nil || again.Redelivery != failed.ID || string(again.Payload) != string(failed.Payload) {
+		t.Fatalf("redelivery = %+v, %v", again, err)
+	}
+	if dl := wait(t, d, "u1", h.ID); dl.ID != again.ID || dl.State != webhook.StateSucceeded {
+		t.Errorf("redelivery = %+v", dl)
+	}
+}
+
+func TestGoneDisablesImmediately(t *testing.T) {
+	rc := newReceiver(t, http.StatusGone)
+	d := newDispatcher(t)
+	h, _ := d.Create("u1", rc.URL, []string{"note.created"})
+	d.Publish("u1", "note.created", nil)
+	if dl := wait(t, d, "u1", h.ID); len(dl.Attempts) != 1 {
+		t.Errorf("410 was retried: %+v", dl)
+	}
+	if h, _ = d.Get("u1", h.ID); h.Active {
+		t.Error("410 should disable the webhook")
+	}
+}
+
+func TestValidationAndPrivateAddresses(t *testing.T) {
+	d := newDispatcher(t)
+	if _, err := d.Create("u1", "ftp://example.com", []string{"note.created"}); err != webhook.ErrInvalidURL {
+		t.Errorf("ftp URL: %v", err)
+	}
+	if _, err := d.Create("u1", "https://example.com", nil); err != webhook.ErrNoEvents {
+		t.Errorf("no events: %v", err)
+	}
+	if _, err := d.Create("u1", "https://example.com", []string{"note.moved"}); err == nil {
+		t.Error("unknown event accepted")
+	}
+	if _, err := d.Get("u2", "missing"); err != webhook.ErrNotFound {
+		t.Errorf("missing webhook: %v", err)
+	}
+
+	rc := newReceiver(t)
+	_, err := webhook.NewClient(time.Second, false).Post(rc.URL, "application/json", nil)
+	if err == nil || !strings.Contains(err.Error(), webhook.ErrPrivateAddress.Error()) {
+		t.Errorf("loopback delivery: %v", err)
+	}
+}
+
+func TestQueueBoundsDeliveries(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer srv.Close()
+	d := webhook.NewDispatcher(webhook.Config{
+		Client:      webhook.NewClient(5*time.Second, true),
+		Events:      []string{"note.created"},
+		MaxAttempts: 1,
+		Workers:     1,
+		QueueSize:   2,
+		LogSize:     10,
+	})
+	defer d.Close(context.Background())
+	h, _ := d.Create("u1", srv.URL, []string{"note.created"})
+
+	for range 3 {
+		d.Publish("u1", "note.created", nil)
+	}
+	log, _ := d.Deliveries("u1", h.ID)
+	if len(log) != 3 || log[0].State != webhook.StateFailed || log[0].Attempts[0].Error != webhook.ErrQueueFull.Error() {
+		t.Fatalf("delivery past the queue = %+v", log[0])
+	}
+	if _, err := d.Redeliver("u1", h.ID, log[0].ID); err != webhook.ErrQueueFull {
+		t.Errorf("redeliver with a full queue: %v", err)
+	}
+	if h, _ = d.Get("u1", h.ID); h.Failures != 0 {
+		t.Errorf("dropped delivery counted as a failure: %+v", h)
+	}
+
+	close(release)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		log, _ = d.Deliveries("u1", h.ID)
+		if log[1].State == webhook.StateSucceeded && log[2].State == webhook.StateSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued deliveries = %+v", log[1:])
+		}
+	}
+	if _, err := d.Redeliver("u1", h.ID, log[0].ID); err != nil {
+		t.Errorf("redeliver once the queue drained: %v", err)
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	rc := newReceiver(t)
+	d := newDispatcher(t)
+	h, _ := d.Create("u1", rc.URL, []string{"note.created"})
+	if _, err := d.RotateSecret("u2", h.ID); err != webhook.ErrNotFound {
+		t.Errorf("rotate another user's webhook: %v", err)
+	}
+	rotated, err := d.RotateSecret("u1", h.ID)
+	if err != nil || rotated.Secret == h.Secret || rotated.Secret == "" {
+		t.Fatalf("rotated = %+v, %v", rotated, err)
+	}
+
+	d.Publish("u1", "note.created", nil)
+	r, body := rc.next(t)
+	if err := webhook.Verify(rotated.Secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+		t.Errorf("new secret: %v", err)
+	}
+	if err := webhook.Verify(h.Secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != webhook.ErrSignature {
+		t.Errorf("old secret: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goproject/internal/websocket"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455 section 1.3.
+	if got := websocket.AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey = %q", got)
+	}
+}
+
+// client is just enough of a WebSocket client to drive the server.
+type client struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, url string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake failed: %s %v", resp.Status, resp.Header)
+	}
+	return &client{conn: conn, br: br}
+}
+
+func (c *client) send(fin bool, opcode byte, p []byte) {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80 | byte(len(p))}
+	frame = append(frame, mask...)
+	for i, x := range p {
+		frame = append(frame, x^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *client) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(h[1] & 0x7F)
+	if n == 126 {
+		var b [2]byte
+		io.ReadFull(c.br, b[:])
+		n = int(binary.BigEndian.Uint16(b[:]))
+	}
+	p := make([]byte, n)
+	io.ReadFull(c.br, p)
+	return h[0] & 0x0F, p
+}
+
+func TestEchoPingAndClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 200)))
+		for {
+			op, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(op, p)
+		}
+	}))
+	defer srv.Close()
+
+	c := dial(t, srv.URL)
+	if op, p := c.read(t); op != websocket.TextMessage || len(p) != 200 {
+		t.Fatalf("greeting = %d %d bytes", op, len(p))
+	}
+
+	c.send(true, websocket.PingMessage, []byte("hi"))
+	if op, p := c.read(t); op != websocket.PongMessage || string(p) != "hi" {
+		t.Errorf("ping answered with %d %q", op, p)
+	}
+
+	c.send(false, websocket.TextMessage, []byte("hel"))
+	c.send(true, 0, []byte("lo"))
+	if op, p := c.read(t); op != websocket.TextMessage || string(p) != "hello" {
+		t.Errorf("echo = %d %q", op, p)
+	}
+
+	c.send(true, websocket.CloseMessage, []byte{0x03, 0xE8})
+	if op, p := c.read(t); op != websocket.CloseMessage || binary.BigEndian.Uint16(p) != websocket.CloseNormal {
+		t.Errorf("close answered with %d %v", op, p)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if _, err := websocket.Upgrade(rec, httptest.NewRequest("GET", "/", nil)); err != websocket.ErrNotWebSocket {
+		t.Errorf("err = %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	if _, err := websocket.Upgrade(rec, req); err != websocket.ErrVersion {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,424 @@
+// Package notesv1 holds the messages of notes.proto with hand-written
+// protobuf encoding. Field numbers must match the .proto file.
+package notesv1
+
+import (
+	"time"
+
+	"goproject/internal/protowire"
+)
+
+// Full method names, as used in gRPC request paths.
+const (
+	AuthRegister = "/notes.v1.AuthService/Register"
+	AuthLogin    = "/notes.v1.AuthService/Login"
+
+	NotesList   = "/notes.v1.NotesService/ListNotes"
+	NotesGet    = "/notes.v1.NotesService/GetNote"
+	NotesCreate = "/notes.v1.NotesService/CreateNote"
+	NotesUpdate = "/notes.v1.NotesService/UpdateNote"
+	NotesDelete = "/notes.v1.NotesService/DeleteNote"
+	NotesMove   = "/notes.v1.NotesService/MoveNote"
+	NotesWatch  = "/notes.v1.NotesService/WatchNotes"
+)
+
+type Priority int32
+
+const (
+	PriorityUnspecified Priority = 0
+	PriorityLow         Priority = 1
+	PriorityMedium      Priority = 2
+	PriorityHigh        Priority = 3
+)
+
+// fields is the signature of each message's field decoder.
+type fields func(num int, v protowire.Value) error
+
+func unmarshal(b []byte, fn fields) error { return protowire.Unmarshal(b, fn) }
+
+// ─── auth ───────────────────────────────────────────────────────────────────
+
+type Credentials struct {
+	Username string
+	Password string
+}
+
+func (m *Credentials) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.Username)
+	b = protowire.AppendStringIf(b, 2, m.Password)
+	return b
+}
+
+func (m *Credentials) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.Username = v.String()
+		case 2:
+			m.Password = v.String()
+		}
+		return nil
+	})
+}
+
+type User struct {
+	ID       string
+	Username string
+}
+
+func (m *User) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.ID)
+	b = protowire.AppendStringIf(b, 2, m.Username)
+	return b
+}
+
+func (m *User) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.ID = v.String()
+		case 2:
+			m.Username = v.String()
+		}
+		return nil
+	})
+}
+
+type AuthResponse struct {
+	Token string
+	User  *User
+}
+
+func (m *AuthResponse) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.Token)
+	if m.User != nil {
+		b = protowire.AppendBytes(b, 2, m.User.Marshal())
+	}
+	return b
+}
+
+func (m *AuthResponse) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.Token = v.String()
+		case 2:
+			m.User = &User{}
+			return m.User.Unmarshal(v.Message())
+		}
+		return nil
+	})
+}
+
+// ─── notes ──────────────────────────────────────────────────────────────────
+
+type Note struct {
+	ID        string
+	UserID    string
+	Title     string
+	Body      string
+	Done      bool
+	Priority  Priority
+	Tags      []string
+	Pinned    bool
+	Position  string
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (m *Note) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.ID)
+	b = protowire.AppendStringIf(b, 2, m.UserID)
+	b = protowire.AppendStringIf(b, 3, m.Title)
+	b = protowire.AppendStringIf(b, 4, m.Body)
+	b = protowire.AppendBoolIf(b, 5, m.Done)
+	b = protowire.AppendIntIf(b, 6, int64(m.Priority))
+	for _, t := range m.Tags {
+		b = protowire.AppendString(b, 7, t)
+	}
+	b = protowire.AppendBoolIf(b, 8, m.Pinned)
+	b = protowire.AppendStringIf(b, 9, m.Position)
+	b = protowire.AppendIntIf(b, 10, m.Version)
+	b = protowire.AppendTimestamp(b, 11, m.CreatedAt)
+	b = protowire.AppendTimestamp(b, 12, m.UpdatedAt)
+	return b
+}
+
+func (m *Note) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		var err error
+		switch num {
+		case 1:
+			m.ID = v.String()
+		case 2:
+			m.UserID = v.String()
+		case 3:
+			m.Title = v.String()
+		case 4:
+			m.Body = v.String()
+		case 5:
+			m.Done = v.Bool()
+		case 6:
+			m.Priority = Priority(v.Int())
+		case 7:
+			m.Tags = append(m.Tags, v.String())
+		case 8:
+			m.Pinned = v.Bool()
+		case 9:
+			m.Position = v.String()
+		case 10:
+			m.Version = v.Int()
+		case 11:
+			m.CreatedAt, err = protowire.Timestamp(v.Message())
+		case 12:
+			m.UpdatedAt, err = protowire.Timestamp(v.Message())
+		}
+		return err
+	})
+}
+
+type ListNotesResponse struct {
+	Notes []*Note
+}
+
+func (m *ListNotesResponse) Marshal() []byte {
+	var b []byte
+	for _, n := range m.Notes {
+		b = protowire.AppendBytes(b, 1, n.Marshal())
+	}
+	return b
+}
+
+func (m *ListNotesResponse) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		if num == 1 {
+			n := &Note{}
+			m.Notes = append(m.Notes, n)
+			return n.Unmarshal(v.Message())
+		}
+		return nil
+	})
+}
+
+// IDRequest is GetNoteRequest and DeleteNoteRequest, which have the same
+// fields.
+type IDRequest struct {
+	ID string
+}
+
+func (m *IDRequest) Marshal() []byte { return protowire.AppendStringIf(nil, 1, m.ID) }
+
+func (m *IDRequest) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		if num == 1 {
+			m.ID = v.String()
+		}
+		return nil
+	})
+}
+
+type CreateNoteRequest struct {
+	Title    string
+	Body     string
+	Priority Priority
+	Tags     []string
+	Pinned   bool
+}
+
+func (m *CreateNoteRequest) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.Title)
+	b = protowire.AppendStringIf(b, 2, m.Body)
+	b = protowire.AppendIntIf(b, 3, int64(m.Priority))
+	for _, t := range m.Tags {
+		b = protowire.AppendString(b, 4, t)
+	}
+	b = protowire.AppendBoolIf(b, 5, m.Pinned)
+	return b
+}
+
+func (m *CreateNoteRequest) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.Title = v.String()
+		case 2:
+			m.Body = v.String()
+		case 3:
+			m.Priority = Priority(v.Int())
+		case 4:
+			m.Tags = append(m.Tags, v.String())
+		case 5:
+			m.Pinned = v.Bool()
+		}
+		return nil
+	})
+}
+
+// UpdateNoteRequest leaves fields that are nil unchanged.
+type UpdateNoteRequest struct {
+	ID       string
+	Title    *string
+	Body     *string
+	Done     *bool
+	Priority *Priority
+	Tags     *[]string
+	Pinned   *bool
+}
+
+func (m *UpdateNoteRequest) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.ID)
+	if m.Title != nil {
+		b = protowire.AppendString(b, 2, *m.Title)
+	}
+	if m.Body != nil {
+		b = protowire.AppendString(b, 3, *m.Body)
+	}
+	if m.Done != nil {
+		b = protowire.AppendBool(b, 4, *m.Done)
+	}
+	if m.Priority != nil {
+		b = protowire.AppendInt(b, 5, int64(*m.Priority))
+	}
+	if m.Tags != nil {
+		var tags []byte
+		for _, t := range *m.Tags {
+			tags = protowire.AppendString(tags, 1, t)
+		}
+		b = protowire.AppendBytes(b, 6, tags)
+	}
+	if m.Pinned != nil {
+		b = protowire.AppendBool(b, 7, *m.Pinned)
+	}
+	return b
+}
+
+func (m *UpdateNoteRequest) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.ID = v.String()
+		case 2:
+			s := v.String()
+			m.Title = &s
+		case 3:
+			s := v.String()
+			m.Body = &s
+		case 4:
+			d := v.Bool()
+			m.Done = &d
+		case 5:
+			p := Priority(v.Int())
+			m.Priority = &p
+		case 6:
+			tags := []string{}
+			m.Tags = &tags
+			return unmarshal(v.Message(), func(num int, v protowire.Value) error {
+				if num == 1 {
+					tags = append(tags, v.String())
+					*m.Tags = tags
+				}
+				return nil
+			})
+		case 7:
+			p := v.Bool()
+			m.Pinned = &p
+		}
+		return nil
+	})
+}
+
+type MoveNoteRequest struct {
+	ID     string
+	Before string
+	After  string
+}
+
+func (m *MoveNoteRequest) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendStringIf(b, 1, m.ID)
+	b = protowire.AppendStringIf(b, 2, m.Before)
+	b = protowire.AppendStringIf(b, 3, m.After)
+	return b
+}
+
+func (m *MoveNoteRequest) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.ID = v.String()
+		case 2:
+			m.Before = v.String()
+		case 3:
+			m.After = v.String()
+		}
+		return nil
+	})
+}
+
+type WatchNotesRequest struct {
+	AfterEventID uint64
+}
+
+func (m *WatchNotesRequest) Marshal() []byte {
+	if m.AfterEventID == 0 {
+		return nil
+	}
+	return protowire.AppendUint(nil, 1, m.AfterEventID)
+}
+
+func (m *WatchNotesRequest) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		if num == 1 {
+			m.AfterEventID = v.Uint()
+		}
+		return nil
+	})
+}
+
+type NoteEvent struct {
+	ID      uint64
+	Type    string
+	NoteID  string
+	Version int64
+	Note    *Note
+}
+
+func (m *NoteEvent) Marshal() []byte {
+	var b []byte
+	if m.ID != 0 {
+		b = protowire.AppendUint(b, 1, m.ID)
+	}
+	b = protowire.AppendStringIf(b, 2, m.Type)
+	b = protowire.AppendStringIf(b, 3, m.NoteID)
+	b = protowire.AppendIntIf(b, 4, m.Version)
+	if m.Note != nil {
+		b = protowire.AppendBytes(b, 5, m.Note.Marshal())
+	}
+	return b
+}
+
+func (m *NoteEvent) Unmarshal(b []byte) error {
+	return unmarshal(b, func(num int, v protowire.Value) error {
+		switch num {
+		case 1:
+			m.ID = v.Uint()
+		case 2:
+			m.Type = v.String()
+		case 3:
+			m.NoteID = v.String()
+		case 4:
+			m.Version = v.Int()
+		case 5:
+			m.Note = &Note{}
+			return m.Note.Unmarshal(v.Message())
+		}
+		return nil
+	})
+}